@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/keithpaterson/resweave-utils/logging"
+	"github.com/keithpaterson/resweave-utils/request"
 
 	"github.com/mortedecai/resweave"
 	"go.uber.org/zap"
@@ -15,6 +16,7 @@ import (
 var (
 	ErrCancelNotAllowed = errors.New("cancel not allowed")
 	ErrRequestTimeout   = errors.New("request timed out")
+	ErrRewindFailed     = errors.New("failed to rewind request body")
 )
 
 // wrapper around net/http/Client
@@ -100,6 +102,12 @@ func (c *httpClient) Execute(req *http.Request) (*http.Response, error) {
 	var lastErr error // keep the last error
 	var resp *http.Response
 	for c.retryHandler.SafeToRetry() {
+		if lastErr != nil {
+			if err := c.rewindBody(req); err != nil {
+				return nil, err
+			}
+		}
+
 		var err error
 		resp, err = c.tryDoRequest(req)
 		if err != nil {
@@ -108,7 +116,7 @@ func (c *httpClient) Execute(req *http.Request) (*http.Response, error) {
 				return nil, err
 			}
 
-			c.Infow("backing off due to", "error", err)
+			c.Infow("backing off due to", "error", err, "route", routeOf(req))
 			err = c.doBackoff()
 			if err != nil {
 				return nil, err
@@ -139,6 +147,31 @@ func (c *httpClient) tryDoRequest(req *http.Request) (*http.Response, error) {
 	return resp, err
 }
 
+// prefer the route template (if the request has one) so that logs aren't cluttered with ids and query strings
+func routeOf(req *http.Request) string {
+	if template, ok := request.RouteTemplate(req); ok {
+		return template
+	}
+	return req.URL.Path
+}
+
+// re-creates the request body before a retry, since the previous attempt will have consumed it; a body that can't be
+// re-created can't be retried, since the retry would send whatever is left of it
+func (c *httpClient) rewindBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.GetBody == nil {
+		return fmt.Errorf("%w: the body can't be rewound", ErrRewindFailed)
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRewindFailed, err)
+	}
+	req.Body = body
+	return nil
+}
+
 func (c *httpClient) doBackoff() error {
 	c.Infow("start backoff", "timeout", c.backoff.Timeout())
 	boC := c.backoff.Start()
@@ -1,8 +1,13 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/keithpaterson/resweave-utils/request"
@@ -64,7 +69,7 @@ func getNoBodyRequestFunction(method string) newNoBodyRequestFn {
 	return nil
 }
 
-type newBodyRequestFn func(string, request.BodyDataProvider) (*http.Request, error)
+type newBodyRequestFn func(string, request.BodyProvider) (*http.Request, error)
 
 func getBodyRequestFunction(method string) newBodyRequestFn {
 	switch method {
@@ -196,6 +201,100 @@ var _ = Describe("Client", func() {
 			Entry("with 2 timeouts and 2 retry succeeds", 2, 2, false),
 			Entry("with 3 timeouts and 2 retry times out", 3, 2, true),
 		)
+		DescribeTable("Timeout with Retry re-sends the request body",
+			func(bodyFn request.BodyProvider) {
+				// Arrange
+				svc := test.HttpService().
+					WithMethod(http.MethodPost).
+					WithPath("/test").
+					WithBinaryBody([]byte("test data")).
+					WithTimeouts(1).
+					ReturnStatusCode(http.StatusOK)
+				host, tearDown := svc.Start()
+				defer tearDown()
+
+				client := newTestHTTPClient().
+					WithRetryHandler(NewRetryCounter(1)).
+					WithBackoff(StaticBackoff(5 * time.Millisecond))
+				req, err := request.NewPostRequest(host+"/test", bodyFn)
+				Expect(err).ToNot(HaveOccurred())
+
+				// Act
+				resp, err := client.Execute(req)
+				if resp != nil {
+					defer resp.Body.Close()
+				}
+
+				// Assert
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(svc.GetCallCount()).To(Equal(2))
+			},
+			Entry("with binary body", request.WithBinaryBody([]byte("test data"))),
+			Entry("with stream body", request.WithReaderBody(bytes.NewReader([]byte("test data")), 9, "text/plain")),
+		)
+		It("should re-send a file body that the transport closed", func() {
+			// Arrange
+			svc := test.HttpService().
+				WithMethod(http.MethodPost).
+				WithPath("/test").
+				WithBinaryBody([]byte("test data")).
+				WithTimeouts(1).
+				ReturnStatusCode(http.StatusOK)
+			host, tearDown := svc.Start()
+			defer tearDown()
+
+			path := filepath.Join(GinkgoT().TempDir(), "upload.txt")
+			Expect(os.WriteFile(path, []byte("test data"), 0o600)).To(Succeed())
+			file, err := os.Open(path)
+			Expect(err).ToNot(HaveOccurred())
+			defer file.Close()
+
+			client := newTestHTTPClient().
+				WithRetryHandler(NewRetryCounter(1)).
+				WithBackoff(StaticBackoff(5 * time.Millisecond))
+			req, err := request.NewPostRequest(host+"/test", request.WithReaderBody(file, 9, "text/plain"))
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			resp, err := client.Execute(req)
+			if resp != nil {
+				defer resp.Body.Close()
+			}
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(svc.GetCallCount()).To(Equal(2))
+		})
+		It("should not retry a body that can't be rewound", func() {
+			// Arrange
+			svc := test.HttpService().
+				WithMethod(http.MethodPost).
+				WithPath("/test").
+				WithBinaryBody([]byte("test data")).
+				WithTimeouts(1).
+				ReturnStatusCode(http.StatusOK)
+			host, tearDown := svc.Start()
+			defer tearDown()
+
+			client := newTestHTTPClient().
+				WithRetryHandler(NewRetryCounter(1)).
+				WithBackoff(StaticBackoff(5 * time.Millisecond))
+			body := request.WithReaderBody(io.MultiReader(strings.NewReader("test data")), -1, "text/plain")
+			req, err := request.NewPostRequest(host+"/test", body)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			resp, err := client.Execute(req)
+			if resp != nil {
+				defer resp.Body.Close()
+			}
+
+			// Assert
+			Expect(err).To(MatchError(ErrRewindFailed))
+			Expect(svc.GetCallCount()).To(Equal(1))
+		})
 		It("should allow for canceling a long-running operation", func() {
 			// Arrange
 			svc := test.HttpService().
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+)
+
+var (
+	ErrSubscriptionFailed = errors.New("event subscription failed")
+)
+
+// Handles events received by Subscribe(); returning an error ends the subscription.
+type EventHandler func(response.Event) error
+
+// Receive server-sent events, reconnecting when the connection is lost.
+//
+// Subscribe blocks until the handler returns an error, the client's context is canceled (see Cancel), the server
+// responds with 204 (No Content) to say that there are no more events, or the retry handler gives up.
+//
+// Reconnects are delayed by the client's backoff, or by the server's retry value if it has sent one, and send the
+// id of the last event received (Last-Event-ID) so that the server can resume the stream.  The retry handler is
+// reset whenever an event is received, so a server that keeps closing the stream without sending anything will
+// eventually exhaust it.
+//
+// Responses other than 200 (or 204) are not retried, since the server has refused the subscription.
+func (c *httpClient) Subscribe(req *http.Request, handle EventHandler) error {
+	// the client's timeout would end long-lived streams, so streams use a copy without one
+	streamClient := *c.Client
+	streamClient.Timeout = 0
+
+	if c.backoff != nil {
+		c.backoff.Reset()
+	}
+	if c.retryHandler != nil {
+		c.retryHandler.Reset()
+	}
+
+	lastEventId := req.Header.Get(header.LastEventId)
+	var serverRetry time.Duration
+	var lastErr error
+	for c.retryHandler.SafeToRetry() {
+		received, err := c.readEvents(&streamClient, req, &lastEventId, &serverRetry, handle)
+		if received {
+			c.retryHandler.Reset()
+			if c.backoff != nil {
+				c.backoff.Reset()
+			}
+		}
+		var stop *stopSubscription
+		if errors.As(err, &stop) {
+			return stop.err
+		}
+		if c.context.Err() != nil {
+			return c.context.Err()
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		lastErr = err
+
+		c.Infow("reconnecting event stream due to", "error", err, "route", routeOf(req), "lastEventId", lastEventId)
+		if err = c.waitToReconnect(serverRetry); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s: last error: %w", ErrSubscriptionFailed, c.retryHandler.State(), lastErr)
+}
+
+// ends the subscription without reconnecting; err is returned by Subscribe()
+type stopSubscription struct {
+	err error
+}
+
+func (s *stopSubscription) Error() string {
+	if s.err == nil {
+		return "subscription ended"
+	}
+	return s.err.Error()
+}
+
+// Connects and passes events to the handler until the stream ends; returns true if any events were received.
+func (c *httpClient) readEvents(streamClient *http.Client, req *http.Request, lastEventId *string, serverRetry *time.Duration, handle EventHandler) (bool, error) {
+	attempt := req.Clone(c.context)
+	attempt.Header.Set(header.Accept, header.MimeTypeEventStream)
+	if *lastEventId != "" {
+		attempt.Header.Set(header.LastEventId, *lastEventId)
+	}
+
+	resp, err := streamClient.Do(attempt)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return false, &stopSubscription{}
+	case resp.StatusCode != http.StatusOK:
+		return false, &stopSubscription{err: fmt.Errorf("%w: %w", ErrSubscriptionFailed, response.ParseResponse(resp, http.StatusOK))}
+	case !strings.HasPrefix(resp.Header.Get(header.ContentType), header.MimeTypeEventStream):
+		return false, &stopSubscription{err: fmt.Errorf("%w: unexpected content type %q", ErrSubscriptionFailed, resp.Header.Get(header.ContentType))}
+	}
+
+	reader := response.NewEventReader(resp.Body)
+	received := false
+	for {
+		event, err := reader.Next()
+		*lastEventId = reader.LastEventID()
+		if reader.Retry() > 0 {
+			*serverRetry = reader.Retry()
+		}
+		if err != nil {
+			return received, err
+		}
+		received = true
+		if err = handle(event); err != nil {
+			return received, &stopSubscription{err: err}
+		}
+	}
+}
+
+func (c *httpClient) waitToReconnect(serverRetry time.Duration) error {
+	if serverRetry <= 0 {
+		if c.backoff == nil {
+			c.retryHandler.Advance()
+			return nil
+		}
+		return c.doBackoff()
+	}
+
+	timer := time.NewTimer(serverRetry)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		c.retryHandler.Advance()
+	case <-c.context.Done():
+		return c.context.Err()
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/request"
+	"github.com/keithpaterson/resweave-utils/response"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// serves each connection with the next handler; connections after the last handler get 204 (No Content)
+type eventService struct {
+	handlers    []http.HandlerFunc
+	calls       atomic.Int32
+	mtx         sync.Mutex
+	lastEventId []string
+}
+
+func (s *eventService) lastEventIds() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.lastEventId
+}
+
+func (s *eventService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := int(s.calls.Add(1)) - 1
+	s.mtx.Lock()
+	s.lastEventId = append(s.lastEventId, r.Header.Get(header.LastEventId))
+	s.mtx.Unlock()
+	if call >= len(s.handlers) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.handlers[call](w, r)
+}
+
+func sendEvents(events ...response.Event) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stream, err := response.NewWriter(w).WithRequest(r).NewEventStream()
+		Expect(err).ToNot(HaveOccurred())
+		defer stream.Close()
+		for _, event := range events {
+			Expect(stream.Send(event)).To(Succeed())
+		}
+	}
+}
+
+var _ = Describe("Subscribe", func() {
+	var svc *eventService
+	var server *httptest.Server
+	var client *httpClient
+	var received []response.Event
+	collect := func(event response.Event) error {
+		received = append(received, event)
+		return nil
+	}
+	subscribe := func(handle EventHandler) error {
+		req, err := request.NewGetRequest(server.URL + "/events")
+		Expect(err).ToNot(HaveOccurred())
+		return client.Subscribe(req, handle)
+	}
+
+	BeforeEach(func() {
+		svc = &eventService{}
+		server = httptest.NewServer(svc)
+		DeferCleanup(server.Close)
+		client = newTestHTTPClient().
+			WithRetryHandler(NewRetryCounter(2)).
+			WithBackoff(StaticBackoff(5 * time.Millisecond))
+		received = nil
+	})
+
+	It("should reconnect with the last event id until the server sends 204", func() {
+		// Arrange
+		svc.handlers = []http.HandlerFunc{
+			sendEvents(response.Event{ID: "1", Data: "one"}, response.Event{ID: "2", Event: "update", Data: "two"}),
+			sendEvents(response.Event{ID: "3", Data: "three"}),
+		}
+
+		// Act
+		err := subscribe(collect)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(received).To(Equal([]response.Event{
+			{ID: "1", Data: "one"},
+			{ID: "2", Event: "update", Data: "two"},
+			{ID: "3", Data: "three"},
+		}))
+		Expect(svc.lastEventIds()).To(Equal([]string{"", "2", "3"}))
+	})
+
+	It("should wait for the server's retry value before reconnecting", func() {
+		// Arrange
+		client.WithBackoff(StaticBackoff(time.Minute))
+		svc.handlers = []http.HandlerFunc{
+			sendEvents(response.Event{Data: "one", Retry: 10 * time.Millisecond}),
+		}
+		start := time.Now()
+
+		// Act
+		err := subscribe(collect)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+		Expect(svc.calls.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("should give up when the server keeps closing the stream without sending events", func() {
+		// Arrange
+		empty := sendEvents()
+		svc.handlers = []http.HandlerFunc{empty, empty, empty, empty}
+
+		// Act
+		err := subscribe(collect)
+
+		// Assert
+		Expect(err).To(MatchError(ErrSubscriptionFailed))
+		Expect(err).To(MatchError(io.EOF))
+		Expect(svc.calls.Load()).To(BeEquivalentTo(3))
+	})
+
+	It("should reset the retry handler when events are received", func() {
+		// Arrange
+		empty := sendEvents()
+		svc.handlers = []http.HandlerFunc{empty, empty, sendEvents(response.Event{Data: "one"}), empty}
+
+		// Act
+		err := subscribe(collect)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(received).To(HaveLen(1))
+		Expect(svc.calls.Load()).To(BeEquivalentTo(5))
+	})
+
+	DescribeTable("should not reconnect when the server refuses the subscription",
+		func(handler http.HandlerFunc, expectErr error) {
+			// Arrange
+			svc.handlers = []http.HandlerFunc{handler}
+
+			// Act
+			err := subscribe(collect)
+
+			// Assert
+			Expect(err).To(MatchError(ErrSubscriptionFailed))
+			if expectErr != nil {
+				Expect(err).To(MatchError(expectErr))
+			}
+			Expect(svc.calls.Load()).To(BeEquivalentTo(1))
+		},
+		Entry("with an error response", func(w http.ResponseWriter, r *http.Request) {
+			_ = response.NewWriter(w).WriteErrorResponse(http.StatusForbidden, response.SvcErrorInvalidMethod)
+		}, response.SvcErrorInvalidMethod),
+		Entry("with the wrong content type", func(w http.ResponseWriter, r *http.Request) {
+			_ = response.NewWriter(w).WriteJsonResponse(http.StatusOK, []string{"not", "events"})
+		}, nil),
+	)
+
+	It("should stop when the handler returns an error", func() {
+		// Arrange
+		errStop := errors.New("stop")
+		svc.handlers = []http.HandlerFunc{
+			sendEvents(response.Event{Data: "one"}, response.Event{Data: "two"}),
+		}
+
+		// Act
+		err := subscribe(func(event response.Event) error {
+			received = append(received, event)
+			return errStop
+		})
+
+		// Assert
+		Expect(err).To(MatchError(errStop))
+		Expect(received).To(HaveLen(1))
+		Expect(svc.calls.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should stop when the client is canceled", func() {
+		// Arrange
+		svc.handlers = []http.HandlerFunc{
+			func(w http.ResponseWriter, r *http.Request) {
+				sendEvents(response.Event{Data: "one"})(w, r)
+				<-r.Context().Done()
+			},
+		}
+
+		// Act
+		err := subscribe(func(event response.Event) error {
+			return client.Cancel()
+		})
+
+		// Assert
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(svc.calls.Load()).To(BeEquivalentTo(1))
+	})
+})
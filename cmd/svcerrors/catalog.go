@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrorDuplicateCode = errors.New("duplicate service error code")
+	ErrorParseFailed   = errors.New("failed to parse package")
+)
+
+// the functions that declare service errors and the argument that holds the HTTP status (-1 if there isn't one)
+var declarationFuncs = map[string]int{
+	"NewServiceError":     -1,
+	"DeclareServiceError": 2,
+}
+
+// One service error declaration
+type CatalogEntry struct {
+	Code        int    `json:"code"`
+	Name        string `json:"name"`
+	Package     string `json:"package"`
+	Status      int    `json:"status,omitempty"`
+	Description string `json:"description"`
+	Position    string `json:"-"`
+}
+
+// All of the declarations found, sorted by code
+type Catalog []CatalogEntry
+
+// Find the package-level service error declarations in the go files in each directory (tests are ignored).
+//
+// Only declarations with literal codes and descriptions are included, e.g.
+//
+//	var ErrSvcInvalidWhatsit = response.NewServiceError(20000, "invalid whatsit")
+//	var ErrSvcNoSuchWhatsit = response.DeclareServiceError(20001, "no such whatsit", http.StatusNotFound)
+func Scan(dirs ...string) (Catalog, error) {
+	catalog := make(Catalog, 0)
+	fset := token.NewFileSet()
+	for _, dir := range dirs {
+		pkgs, err := parser.ParseDir(fset, dir, isSourceFile, 0)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrorParseFailed, dir, err)
+		}
+		for _, pkg := range pkgs {
+			for _, file := range pkg.Files {
+				catalog = append(catalog, scanFile(fset, pkg.Name, file)...)
+			}
+		}
+	}
+
+	sort.SliceStable(catalog, func(i, j int) bool {
+		if catalog[i].Code != catalog[j].Code {
+			return catalog[i].Code < catalog[j].Code
+		}
+		return catalog[i].Position < catalog[j].Position
+	})
+	return catalog, nil
+}
+
+func isSourceFile(info fs.FileInfo) bool {
+	return !strings.HasSuffix(info.Name(), "_test.go")
+}
+
+func scanFile(fset *token.FileSet, pkgName string, file *ast.File) []CatalogEntry {
+	entries := make([]CatalogEntry, 0)
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for index, value := range valueSpec.Values {
+				if index >= len(valueSpec.Names) {
+					break
+				}
+				if entry, ok := parseDeclaration(value); ok {
+					entry.Name = valueSpec.Names[index].Name
+					entry.Package = pkgName
+					entry.Position = fset.Position(value.Pos()).String()
+					entries = append(entries, entry)
+				}
+			}
+		}
+	}
+	return entries
+}
+
+// Recognizes NewServiceError(code, "description") and DeclareServiceError(code, "description", status), with or
+// without a package qualifier.
+func parseDeclaration(expr ast.Expr) (CatalogEntry, bool) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return CatalogEntry{}, false
+	}
+	statusArg, ok := declarationFuncs[funcName(call.Fun)]
+	if !ok || len(call.Args) < 2 {
+		return CatalogEntry{}, false
+	}
+
+	var entry CatalogEntry
+	var err error
+	if entry.Code, err = intLiteral(call.Args[0]); err != nil {
+		return CatalogEntry{}, false
+	}
+	if entry.Description, err = stringLiteral(call.Args[1]); err != nil {
+		return CatalogEntry{}, false
+	}
+	if statusArg >= 0 && statusArg < len(call.Args) {
+		entry.Status = statusValue(call.Args[statusArg])
+	}
+	return entry, true
+}
+
+func funcName(expr ast.Expr) string {
+	switch fn := expr.(type) {
+	case *ast.Ident:
+		return fn.Name
+	case *ast.SelectorExpr:
+		return fn.Sel.Name
+	}
+	return ""
+}
+
+func intLiteral(expr ast.Expr) (int, error) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		return 0, strconv.ErrSyntax
+	}
+	value, err := strconv.ParseInt(lit.Value, 0, 0)
+	return int(value), err
+}
+
+func stringLiteral(expr ast.Expr) (string, error) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", strconv.ErrSyntax
+	}
+	return strconv.Unquote(lit.Value)
+}
+
+// the names of net/http status constants that don't match their status text
+var statusNameExceptions = map[string]int{
+	"StatusNonAuthoritativeInfo": http.StatusNonAuthoritativeInfo,
+	"StatusTeapot":               http.StatusTeapot,
+}
+
+// Accepts an integer literal or a net/http status constant (e.g. http.StatusNotFound); returns 0 for anything else
+func statusValue(expr ast.Expr) int {
+	if value, err := intLiteral(expr); err == nil {
+		return value
+	}
+	selector, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return 0
+	}
+	if pkg, ok := selector.X.(*ast.Ident); !ok || pkg.Name != "http" {
+		return 0
+	}
+	return statusByName(selector.Sel.Name)
+}
+
+// net/http status constants are named after their status text, e.g. StatusNotFound is "Not Found"
+func statusByName(name string) int {
+	if status, found := statusNameExceptions[name]; found {
+		return status
+	}
+	for status := 100; status < 600; status++ {
+		text := http.StatusText(status)
+		if text != "" && "Status"+strings.NewReplacer(" ", "", "-", "").Replace(text) == name {
+			return status
+		}
+	}
+	return 0
+}
+
+// Reports every code that is declared more than once
+func (c Catalog) Duplicates() error {
+	var errs []error
+	for index := 1; index < len(c); index++ {
+		if c[index].Code == c[index-1].Code {
+			errs = append(errs, fmt.Errorf("%w: %d: %s (%s) and %s (%s)", ErrorDuplicateCode, c[index].Code,
+				c[index-1].Name, c[index-1].Position, c[index].Name, c[index].Position))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Catalog", func() {
+	Context("Scan", func() {
+		It("should find literal service error declarations", func() {
+			// Act
+			catalog, err := Scan("testdata/valid")
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(catalog).To(HaveLen(4))
+			for index := range catalog {
+				Expect(catalog[index].Position).To(HavePrefix("testdata/valid/errors.go:"))
+				catalog[index].Position = ""
+			}
+			Expect(catalog).To(Equal(Catalog{
+				{Code: 20000, Name: "ErrSvcInvalidWhatsit", Package: "whatsit", Description: "invalid whatsit"},
+				{Code: 20001, Name: "ErrSvcNoSuchWhatsit", Package: "whatsit", Status: http.StatusNotFound, Description: "no such whatsit"},
+				{Code: 20002, Name: "ErrSvcBrokenWhatsit", Package: "whatsit", Status: http.StatusServiceUnavailable, Description: "broken | whatsit"},
+				{Code: 20003, Name: "ErrSvcTeapot", Package: "whatsit", Status: http.StatusTeapot, Description: "whatsit is a teapot"},
+			}))
+			Expect(catalog.Duplicates()).To(Succeed())
+		})
+		It("should find the built-in service errors", func() {
+			// Act
+			catalog, err := Scan("../../response")
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(catalog).To(ContainElement(HaveField("Name", "SvcErrorInvalidResourceId")))
+			Expect(catalog.Duplicates()).To(Succeed())
+		})
+		It("should return an error when the directory cannot be parsed", func() {
+			_, err := Scan("testdata/missing")
+			Expect(err).To(MatchError(ErrorParseFailed))
+		})
+	})
+
+	Context("Duplicates", func() {
+		It("should report duplicate codes", func() {
+			// Arrange
+			catalog, err := Scan("testdata/duplicate")
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			err = catalog.Duplicates()
+
+			// Assert
+			Expect(err).To(MatchError(ErrorDuplicateCode))
+			Expect(err.Error()).To(ContainSubstring("20000: ErrSvcInvalidWhatsit"))
+			Expect(err.Error()).To(ContainSubstring("ErrSvcAlsoInvalid"))
+		})
+	})
+
+	DescribeTable("statusByName",
+		func(name string, expect int) {
+			Expect(statusByName(name)).To(Equal(expect))
+		},
+		Entry(nil, "StatusOK", http.StatusOK),
+		Entry(nil, "StatusNonAuthoritativeInfo", http.StatusNonAuthoritativeInfo),
+		Entry(nil, "StatusMultiStatus", http.StatusMultiStatus),
+		Entry(nil, "StatusRequestURITooLong", http.StatusRequestURITooLong),
+		Entry(nil, "StatusUnprocessableEntity", http.StatusUnprocessableEntity),
+		Entry(nil, "StatusHTTPVersionNotSupported", http.StatusHTTPVersionNotSupported),
+		Entry(nil, "StatusUnknown", 0),
+	)
+})
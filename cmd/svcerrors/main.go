@@ -0,0 +1,73 @@
+// Generates a catalog of service errors (see response.NewServiceError) as Markdown, JSON or an OpenAPI fragment.
+//
+// Usage:
+//
+//	svcerrors [-format markdown|json|openapi] [-o file] [dir ...]
+//
+// Each directory is scanned for package-level service error declarations; the current directory is used if none
+// are given.  The command fails if two declarations share a code.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "svcerrors:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("svcerrors", flag.ContinueOnError)
+	format := flags.String("format", FormatMarkdown, "output format: "+strings.Join(formatNames(), ", "))
+	output := flags.String("o", "", "output file (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	render, found := renderers[*format]
+	if !found {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	dirs := flags.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	catalog, err := Scan(dirs...)
+	if err != nil {
+		return err
+	}
+	if err = catalog.Duplicates(); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return render(stdout, catalog)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err = render(file, catalog); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func formatNames() []string {
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
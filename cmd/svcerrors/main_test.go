@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/keithpaterson/resweave-utils/header"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("svcerrors", func() {
+	It("should write markdown by default", func() {
+		// Arrange
+		var out bytes.Buffer
+
+		// Act
+		err := run([]string{"testdata/valid"}, &out)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(ContainSubstring("| Code | Name | HTTP Status | Description |\n"))
+		Expect(out.String()).To(ContainSubstring("| 20000 | `whatsit.ErrSvcInvalidWhatsit` |  | invalid whatsit |\n"))
+		Expect(out.String()).To(ContainSubstring("| 20002 | `whatsit.ErrSvcBrokenWhatsit` | 503 Service Unavailable | broken \\| whatsit |\n"))
+	})
+	It("should write json", func() {
+		// Arrange
+		var out bytes.Buffer
+
+		// Act
+		err := run([]string{"-format", FormatJson, "testdata/valid"}, &out)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		var catalog Catalog
+		Expect(json.Unmarshal(out.Bytes(), &catalog)).To(Succeed())
+		Expect(catalog).To(HaveLen(4))
+		Expect(catalog[1]).To(Equal(CatalogEntry{Code: 20001, Name: "ErrSvcNoSuchWhatsit", Package: "whatsit", Status: 404, Description: "no such whatsit"}))
+	})
+	It("should write an openapi fragment to a file", func() {
+		// Arrange
+		path := filepath.Join(GinkgoT().TempDir(), "errors.json")
+
+		// Act
+		err := run([]string{"-format", FormatOpenAPI, "-o", path, "testdata/valid"}, nil)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		raw, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		var fragment struct {
+			Components struct {
+				Schemas   map[string]map[string]interface{} `json:"schemas"`
+				Responses map[string]struct {
+					Content map[string]interface{} `json:"content"`
+				} `json:"responses"`
+			} `json:"components"`
+		}
+		Expect(json.Unmarshal(raw, &fragment)).To(Succeed())
+		Expect(fragment.Components.Schemas).To(HaveKey("ServiceError"))
+		for _, schema := range []string{"ServiceError", "Problem"} {
+			Expect(fragment.Components.Schemas[schema]["properties"]).To(And(
+				HaveKey("code"), HaveKey("correlationId"), HaveKey("violations"), HaveKey("metadata"), HaveKey("retry"), HaveKey("help"),
+			))
+		}
+		Expect(fragment.Components.Schemas).To(And(HaveKey("FieldViolation"), HaveKey("RetryHint"), HaveKey("HelpLink")))
+		Expect(fragment.Components.Responses["ServiceError"].Content).To(And(
+			HaveKey(header.MimeTypeJson), HaveKey(header.MimeTypeProblemJson),
+		))
+		Expect(fragment.Components.Schemas["ServiceErrorCode"]["enum"]).To(Equal([]interface{}{20000.0, 20001.0, 20002.0, 20003.0}))
+		Expect(fragment.Components.Schemas["ServiceErrorCode"]["x-enum-varnames"]).To(HaveLen(4))
+	})
+	It("should fail on duplicate codes", func() {
+		var out bytes.Buffer
+		err := run([]string{"testdata/duplicate"}, &out)
+		Expect(err).To(MatchError(ErrorDuplicateCode))
+		Expect(out.Len()).To(BeZero())
+	})
+	It("should fail on an unknown format", func() {
+		err := run([]string{"-format", "yaml", "testdata/valid"}, nil)
+		Expect(err).To(MatchError(ContainSubstring(`unknown format "yaml"`)))
+	})
+})
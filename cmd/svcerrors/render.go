@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+)
+
+// Output formats
+const (
+	FormatMarkdown = "markdown"
+	FormatJson     = "json"
+	FormatOpenAPI  = "openapi"
+)
+
+var renderers = map[string]func(io.Writer, Catalog) error{
+	FormatMarkdown: renderMarkdown,
+	FormatJson:     renderJson,
+	FormatOpenAPI:  renderOpenAPI,
+}
+
+func renderMarkdown(w io.Writer, catalog Catalog) error {
+	var sb strings.Builder
+	sb.WriteString("# Service Errors\n\n")
+	sb.WriteString("| Code | Name | HTTP Status | Description |\n")
+	sb.WriteString("|---:|---|---|---|\n")
+	for _, entry := range catalog {
+		fmt.Fprintf(&sb, "| %d | `%s.%s` | %s | %s |\n", entry.Code, entry.Package, entry.Name,
+			statusDescription(entry.Status), strings.ReplaceAll(entry.Description, "|", `\|`))
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func statusDescription(status int) string {
+	if status == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
+
+func renderJson(w io.Writer, catalog Catalog) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(catalog)
+}
+
+// Writes an OpenAPI "components" fragment describing the service error bodies (both the plain json and the
+// problem+json forms) and the known codes
+func renderOpenAPI(w io.Writer, catalog Catalog) error {
+	codes := make([]int, 0, len(catalog))
+	names := make([]string, 0, len(catalog))
+	descriptions := make([]string, 0, len(catalog))
+	for _, entry := range catalog {
+		codes = append(codes, entry.Code)
+		names = append(names, entry.Name)
+		descriptions = append(descriptions, entry.Description)
+	}
+
+	ref := func(name string) map[string]interface{} {
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	str := map[string]interface{}{"type": "string"}
+	// the members that both forms have; see response.errorDetails
+	details := map[string]interface{}{
+		"correlationId": map[string]interface{}{"type": "string", "description": "identifies the logged error when it was redacted"},
+		"violations":    map[string]interface{}{"type": "array", "items": ref("FieldViolation")},
+		"metadata":      map[string]interface{}{"type": "object", "additionalProperties": true},
+		"retry":         ref("RetryHint"),
+		"help":          map[string]interface{}{"type": "array", "items": ref("HelpLink")},
+	}
+	withDetails := func(properties map[string]interface{}) map[string]interface{} {
+		for name, schema := range details {
+			properties[name] = schema
+		}
+		return properties
+	}
+
+	fragment := map[string]interface{}{
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"ServiceErrorCode": map[string]interface{}{
+					"type":                "integer",
+					"enum":                codes,
+					"x-enum-varnames":     names,
+					"x-enum-descriptions": descriptions,
+				},
+				"ServiceError": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"code", "description"},
+					"properties": withDetails(map[string]interface{}{
+						"code":        ref("ServiceErrorCode"),
+						"description": str,
+						"wrapped":     str,
+					}),
+				},
+				"Problem": map[string]interface{}{
+					"type":        "object",
+					"description": "RFC 9457 problem details",
+					"properties": withDetails(map[string]interface{}{
+						"type":     map[string]interface{}{"type": "string", "format": "uri-reference"},
+						"title":    str,
+						"status":   map[string]interface{}{"type": "integer"},
+						"detail":   str,
+						"instance": str,
+						"code":     ref("ServiceErrorCode"),
+					}),
+					"additionalProperties": true,
+				},
+				"FieldViolation": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"field", "reason"},
+					"properties": map[string]interface{}{
+						"field":  str,
+						"reason": str,
+						"value":  map[string]interface{}{},
+					},
+				},
+				"RetryHint": map[string]interface{}{
+					"type":       "object",
+					"required":   []string{"afterSeconds"},
+					"properties": map[string]interface{}{"afterSeconds": map[string]interface{}{"type": "integer"}},
+				},
+				"HelpLink": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"url"},
+					"properties": map[string]interface{}{
+						"description": str,
+						"url":         map[string]interface{}{"type": "string", "format": "uri"},
+					},
+				},
+			},
+			"responses": map[string]interface{}{
+				"ServiceError": map[string]interface{}{
+					"description": "A service error",
+					"content": map[string]interface{}{
+						header.MimeTypeJson:        map[string]interface{}{"schema": ref("ServiceError")},
+						header.MimeTypeProblemJson: map[string]interface{}{"schema": ref("Problem")},
+					},
+				},
+			},
+		},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(fragment)
+}
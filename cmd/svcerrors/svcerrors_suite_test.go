@@ -0,0 +1,13 @@
+package main_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestSvcErrors(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SvcErrors Suite")
+}
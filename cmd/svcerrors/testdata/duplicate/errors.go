@@ -0,0 +1,8 @@
+package whatsit
+
+import "github.com/keithpaterson/resweave-utils/response"
+
+var (
+	ErrSvcInvalidWhatsit = response.NewServiceError(20000, "invalid whatsit")
+	ErrSvcAlsoInvalid    = response.NewServiceError(20000, "also invalid")
+)
@@ -0,0 +1,19 @@
+package whatsit
+
+import (
+	"net/http"
+
+	"github.com/keithpaterson/resweave-utils/response"
+)
+
+var (
+	ErrSvcInvalidWhatsit = response.NewServiceError(20000, "invalid whatsit")
+	ErrSvcNoSuchWhatsit  = response.DeclareServiceError(20001, "no such whatsit", http.StatusNotFound)
+	ErrSvcBrokenWhatsit  = response.DeclareServiceError(0x4e22, "broken | whatsit", 503)
+	ErrSvcTeapot         = response.DeclareServiceError(20003, "whatsit is a teapot", http.StatusTeapot)
+
+	// not literals, so these are skipped
+	whatsitCode         = 20004
+	ErrSvcDynamic       = response.NewServiceError(whatsitCode, "dynamic whatsit")
+	ErrSvcNotAnError, _ = http.NewRequest(http.MethodGet, "/", nil)
+)
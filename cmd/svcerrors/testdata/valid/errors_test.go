@@ -0,0 +1,5 @@
+package whatsit
+
+import "github.com/keithpaterson/resweave-utils/response"
+
+var errSvcTestOnly = response.NewServiceError(20000, "test errors are ignored")
@@ -2,13 +2,43 @@ package header
 
 // commonly used headers
 const (
-	Accept         = "Accept"
-	AcceptEncoding = "Accept-Encoding"
-	ContentType    = "Content-Type"
+	Accept             = "Accept"
+	AcceptEncoding     = "Accept-Encoding"
+	AcceptLanguage     = "Accept-Language"
+	AcceptPatch        = "Accept-Patch"
+	Authorization      = "Authorization"
+	CacheControl       = "Cache-Control"
+	ContentLanguage    = "Content-Language"
+	ContentType        = "Content-Type"
+	CorrelationId      = "X-Correlation-Id"
+	ETag               = "ETag"
+	IdempotencyKey     = "Idempotency-Key"
+	IdempotentReplayed = "Idempotent-Replayed" // set on responses replayed for a repeated Idempotency-Key
+	IfMatch            = "If-Match"
+	IfModifiedSince    = "If-Modified-Since"
+	IfNoneMatch        = "If-None-Match"
+	IfRange            = "If-Range"
+	IfUnmodifiedSince  = "If-Unmodified-Since"
+	LastEventId        = "Last-Event-ID"
+	Link               = "Link"
+	Location           = "Location"
+	RetryAfter         = "Retry-After"
+	StreamError        = "X-Stream-Error" // trailer reporting a failure after a streamed response has started
+	Trailer            = "Trailer"
+	Vary               = "Vary"
 )
 
 // commonly-used MIME types
 const (
-	MimeTypeBinary = "application/octet-stream"
-	MimeTypeJson   = "application/json"
+	MimeTypeBinary        = "application/octet-stream"
+	MimeTypeEventStream   = "text/event-stream"
+	MimeTypeJson          = "application/json"
+	MimeTypeProblemJson   = "application/problem+json"
+	MimeTypeMergePatch    = "application/merge-patch+json"
+	MimeTypeJsonPatch     = "application/json-patch+json"
+	MimeTypeXml           = "application/xml"
+	MimeTypeCbor          = "application/cbor"
+	MimeTypeProtobuf      = "application/x-protobuf"
+	MimeTypeForm          = "application/x-www-form-urlencoded"
+	MimeTypeMultipartForm = "multipart/form-data"
 )
@@ -0,0 +1,218 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrorMissingMethod     = errors.New("missing method")
+	ErrorInvalidTemplate   = errors.New("invalid path template")
+	ErrorMissingPathParam  = errors.New("missing path parameter")
+	ErrorUnknownPathParam  = errors.New("unknown path parameter")
+	ErrorInvalidHeaderName = errors.New("invalid header name")
+)
+
+// Fluent request builder; use this when a request needs more than a uri and a body.
+//
+// e.g.
+//
+//	req, err := request.New(http.MethodGet).
+//	  URL("https://api.test.org/{org}/items/{id}").
+//	  PathParam("org", "acme").
+//	  PathParam("id", 123).
+//	  Query("limit", 10).
+//	  Header("Authorization", "Bearer "+token).
+//	  Build()
+//
+// Problems are collected as the request is built and reported together by Build().
+type Builder struct {
+	ctx        context.Context
+	method     string
+	template   string
+	pathParams map[string]string
+	query      url.Values
+	headers    http.Header
+	body       BodyProvider
+	errs       []error
+}
+
+func New(method string) *Builder {
+	return &Builder{
+		ctx:        context.Background(),
+		method:     method,
+		pathParams: make(map[string]string),
+		query:      make(url.Values),
+		headers:    make(http.Header),
+	}
+}
+
+func (b *Builder) Context(ctx context.Context) *Builder {
+	b.ctx = ctx
+	return b
+}
+
+// The uri, which may contain path parameters in braces, e.g. "/orgs/{org}/items/{id}".
+//
+// The template is attached to the request (see RouteTemplate()) so that it can be used in place of the
+// actual uri for logging and metrics.
+func (b *Builder) URL(template string) *Builder {
+	b.template = template
+	return b
+}
+
+// Set the value of a path parameter; the value is formatted with fmt.Sprint and escaped as a path segment.
+func (b *Builder) PathParam(name string, value interface{}) *Builder {
+	b.pathParams[name] = fmt.Sprint(value)
+	return b
+}
+
+// Add query parameter values; calling this more than once with the same name repeats the key.
+// Each value is formatted with fmt.Sprint.
+func (b *Builder) Query(name string, values ...interface{}) *Builder {
+	for _, value := range values {
+		b.query.Add(name, fmt.Sprint(value))
+	}
+	return b
+}
+
+// Add a header value; calling this more than once with the same name adds more values.
+//
+// Headers set here replace any header set by the body provider, e.g. Content-Type.
+func (b *Builder) Header(name string, value string) *Builder {
+	if !isToken(name) {
+		b.errs = append(b.errs, fmt.Errorf("%w: %q", ErrorInvalidHeaderName, name))
+		return b
+	}
+	b.headers.Add(name, value)
+	return b
+}
+
+func (b *Builder) Body(bodyFn BodyProvider) *Builder {
+	b.body = bodyFn
+	return b
+}
+
+// Validate the settings and create the request.
+//
+// All problems that can be detected are reported together (using errors.Join).
+func (b *Builder) Build() (*http.Request, error) {
+	errs := append([]error{}, b.errs...)
+	if b.method == "" {
+		errs = append(errs, ErrorMissingMethod)
+	}
+
+	uri, err := b.expandTemplate()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	var req *http.Request
+	if b.body != nil {
+		req, err = newRequestWithBody(b.method, uri, b.body)
+	} else {
+		req, err = newRequest(b.method, uri, http.NoBody)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range b.headers {
+		req.Header[name] = values
+	}
+	return WithRouteTemplate(req.WithContext(b.ctx), b.template), nil
+}
+
+// Replaces the path parameters and adds the query parameters
+func (b *Builder) expandTemplate() (string, error) {
+	if b.template == "" {
+		return "", ErrorMissingUri
+	}
+
+	var errs []error
+	used := make(map[string]bool)
+	var expanded strings.Builder
+	for remaining := b.template; remaining != ""; {
+		start := strings.IndexAny(remaining, "{}")
+		if start < 0 {
+			expanded.WriteString(remaining)
+			break
+		}
+		if remaining[start] == '}' {
+			errs = append(errs, fmt.Errorf("%w: unexpected '}' in %q", ErrorInvalidTemplate, b.template))
+			break
+		}
+		end := strings.IndexAny(remaining[start+1:], "{}")
+		if end < 0 || remaining[start+1+end] != '}' {
+			errs = append(errs, fmt.Errorf("%w: unterminated '{' in %q", ErrorInvalidTemplate, b.template))
+			break
+		}
+		end += start + 1
+
+		expanded.WriteString(remaining[:start])
+		name := remaining[start+1 : end]
+		if value, found := b.pathParams[name]; found {
+			expanded.WriteString(url.PathEscape(value))
+			used[name] = true
+		} else {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrorMissingPathParam, name))
+		}
+		remaining = remaining[end+1:]
+	}
+
+	for name := range b.pathParams {
+		if !used[name] {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrorUnknownPathParam, name))
+		}
+	}
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	u, err := url.Parse(expanded.String())
+	if err != nil {
+		return "", err
+	}
+	if len(b.query) > 0 {
+		query := u.Query()
+		for name, values := range b.query {
+			query[name] = append(query[name], values...)
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
+
+// header names must be valid http tokens (RFC 7230)
+func isToken(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+type routeTemplateKey struct{}
+
+// Attach a route template (e.g. "/orgs/{org}/items/{id}") to a request.
+// The Builder does this for you.
+func WithRouteTemplate(req *http.Request, template string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), routeTemplateKey{}, template))
+}
+
+// Returns the route template attached to the request, if any.
+func RouteTemplate(req *http.Request) (string, bool) {
+	template, ok := req.Context().Value(routeTemplateKey{}).(string)
+	return template, ok
+}
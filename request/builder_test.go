@@ -0,0 +1,119 @@
+package request
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type builderContextKey struct{}
+
+var _ = Describe("Request Builder", func() {
+	It("should build a request from a template", func() {
+		// Arrange
+		ctx := context.WithValue(context.Background(), builderContextKey{}, "value")
+
+		// Act
+		req, err := New(http.MethodPost).
+			Context(ctx).
+			URL("https://api.test.org/{org}/items/{id}?sort=name").
+			PathParam("org", "acme/widgets").
+			PathParam("id", 123).
+			Query("limit", 10).
+			Query("tag", "red", "green").
+			Query("tag", "blue").
+			Header("X-Request-Id", "abc").
+			Header(header.ContentType, "application/vnd.test+json").
+			Body(WithJsonBody(testData{Name: "widget"})).
+			Build()
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(req.Method).To(Equal(http.MethodPost))
+		Expect(req.URL.Host).To(Equal("api.test.org"))
+		Expect(req.URL.EscapedPath()).To(Equal("/acme%2Fwidgets/items/123"))
+		Expect(req.URL.Query()).To(HaveKeyWithValue("limit", []string{"10"}))
+		Expect(req.URL.Query()).To(HaveKeyWithValue("tag", []string{"red", "green", "blue"}))
+		Expect(req.URL.Query()).To(HaveKeyWithValue("sort", []string{"name"}))
+		Expect(req.Header.Get("X-Request-Id")).To(Equal("abc"))
+		Expect(req.Header.Values(header.ContentType)).To(Equal([]string{"application/vnd.test+json"}))
+		Expect(req.Context().Value(builderContextKey{})).To(Equal("value"))
+
+		template, ok := RouteTemplate(req)
+		Expect(ok).To(BeTrue())
+		Expect(template).To(Equal("https://api.test.org/{org}/items/{id}?sort=name"))
+
+		raw, err := io.ReadAll(req.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(raw)).To(Equal(`{"name":"widget"}`))
+	})
+	It("should build a request without a body", func() {
+		// Act
+		req, err := New(http.MethodGet).URL("/items").Build()
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(req.URL.String()).To(Equal("/items"))
+		Expect(req.Body).To(Equal(http.NoBody))
+		Expect(req.Header.Get(header.ContentType)).To(BeEmpty())
+	})
+	It("should report all of the problems together", func() {
+		// Act
+		req, err := New("").
+			URL("/orgs/{org}/items/{id}").
+			PathParam("id", 1).
+			PathParam("group", "a").
+			Header("Bad Header", "value").
+			Build()
+
+		// Assert
+		Expect(req).To(BeNil())
+		Expect(err).To(MatchError(ErrorMissingMethod))
+		Expect(err).To(MatchError(ErrorMissingPathParam))
+		Expect(err).To(MatchError(ContainSubstring(`"org"`)))
+		Expect(err).To(MatchError(ErrorUnknownPathParam))
+		Expect(err).To(MatchError(ContainSubstring(`"group"`)))
+		Expect(err).To(MatchError(ErrorInvalidHeaderName))
+	})
+	DescribeTable("should reject invalid templates",
+		func(template string, expectErr error) {
+			// Act
+			req, err := New(http.MethodGet).URL(template).Build()
+
+			// Assert
+			Expect(req).To(BeNil())
+			Expect(err).To(MatchError(expectErr))
+		},
+		Entry("with no uri", "", ErrorMissingUri),
+		Entry("with unterminated parameter", "/items/{id", ErrorInvalidTemplate),
+		Entry("with nested parameter", "/items/{i{d}}", ErrorInvalidTemplate),
+		Entry("with unexpected close", "/items/id}", ErrorInvalidTemplate),
+	)
+	It("should return body provider errors", func() {
+		// Act
+		req, err := New(http.MethodPost).URL("/items").Body(WithTestDataProvider([]byte("not json"))).Build()
+
+		// Assert
+		Expect(req).To(BeNil())
+		Expect(err).To(MatchError(HavePrefix("invalid character")))
+	})
+	It("should not have a route template unless one was attached", func() {
+		// Arrange
+		req, err := NewGetRequest("/items/1")
+		Expect(err).ToNot(HaveOccurred())
+
+		// Act
+		_, ok := RouteTemplate(req)
+		req = WithRouteTemplate(req, "/items/{id}")
+		template, attached := RouteTemplate(req)
+
+		// Assert
+		Expect(ok).To(BeFalse())
+		Expect(attached).To(BeTrue())
+		Expect(template).To(Equal("/items/{id}"))
+	})
+})
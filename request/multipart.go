@@ -0,0 +1,255 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/keithpaterson/resweave-utils/header"
+)
+
+var (
+	ErrorWritingMultipart = errors.New("failed to write multipart body")
+)
+
+// Builds a "multipart/form-data" body from simple fields and file parts.
+//
+// Parts are written in the order they were added.  File parts are read from the provided
+// io.Reader only when the body is generated.
+//
+// e.g.
+//
+//	body := NewMultipartBody().
+//	  WithField("description", "holiday photos").
+//	  WithFilePart("photo", "beach.png", "image/png", file)
+//	req, err := NewPostRequest("http://test.org/upload", WithMultipartBody(body))
+type MultipartBody struct {
+	boundary string
+	parts    []multipartPart
+}
+
+type multipartPart struct {
+	fieldName   string
+	fileName    string
+	contentType string
+	reader      io.Reader
+}
+
+func NewMultipartBody() *MultipartBody {
+	return &MultipartBody{parts: make([]multipartPart, 0)}
+}
+
+// Override the randomly-generated boundary; mostly useful when you need repeatable output (e.g. in tests)
+func (m *MultipartBody) WithBoundary(boundary string) *MultipartBody {
+	m.boundary = boundary
+	return m
+}
+
+// Add a simple form field
+func (m *MultipartBody) WithField(name string, value string) *MultipartBody {
+	m.parts = append(m.parts, multipartPart{fieldName: name, reader: strings.NewReader(value)})
+	return m
+}
+
+// Add a file part with the MIME type "application/octet-stream"
+func (m *MultipartBody) WithFile(fieldName string, fileName string, reader io.Reader) *MultipartBody {
+	return m.WithFilePart(fieldName, fileName, header.MimeTypeBinary, reader)
+}
+
+// Add a file part with a specific MIME type
+func (m *MultipartBody) WithFilePart(fieldName string, fileName string, contentType string, reader io.Reader) *MultipartBody {
+	m.parts = append(m.parts, multipartPart{fieldName: fieldName, fileName: fileName, contentType: contentType, reader: reader})
+	return m
+}
+
+// Makes a multipart writer using the given boundary, or a random one if the boundary is empty
+func (m *MultipartBody) newWriter(w io.Writer, boundary string) (*multipart.Writer, error) {
+	mpw := multipart.NewWriter(w)
+	if boundary != "" {
+		if err := mpw.SetBoundary(boundary); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrorWritingMultipart, err)
+		}
+	}
+	return mpw, nil
+}
+
+// Writes all of the parts and closes the multipart writer
+func (m *MultipartBody) writeParts(mpw *multipart.Writer) error {
+	for _, part := range m.parts {
+		if err := part.writeTo(mpw); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrorWritingMultipart, part.fieldName, err)
+		}
+	}
+	if err := mpw.Close(); err != nil {
+		return fmt.Errorf("%w: %w", ErrorWritingMultipart, err)
+	}
+	return nil
+}
+
+func (p multipartPart) writeTo(mpw *multipart.Writer) error {
+	h := make(textproto.MIMEHeader)
+	disposition := fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(p.fieldName))
+	if p.fileName != "" {
+		disposition = fmt.Sprintf(`%s; filename="%s"`, disposition, escapeQuotes(p.fileName))
+	}
+	h.Set("Content-Disposition", disposition)
+	if p.contentType != "" {
+		h.Set(header.ContentType, p.contentType)
+	}
+
+	w, err := mpw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	if p.reader == nil {
+		return nil
+	}
+	_, err = io.Copy(w, p.reader)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// Body Data Provider for multipart bodies.
+//
+// The parts are buffered in memory when the request is created; use WithMultipartStream() to avoid that.
+func WithMultipartBody(body *MultipartBody) BodyDataProvider {
+	return func() ([]byte, string, error) {
+		var buf bytes.Buffer
+		mpw, err := body.newWriter(&buf, body.boundary)
+		if err != nil {
+			return nil, "", err
+		}
+		if err = body.writeParts(mpw); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), mpw.FormDataContentType(), nil
+	}
+}
+
+// Body Stream Provider for multipart bodies.
+//
+// The parts are streamed to the request as it is sent, so large files are never held in memory; nothing is read
+// until the body is.  The body can only be rewound (for retries) if every part's reader implements io.Seeker.
+func WithMultipartStream(body *MultipartBody) BodyStreamProvider {
+	return func() (StreamBody, error) {
+		offsets, canRewind := body.seekOffsets()
+
+		// a rewound stream must use the same boundary as the original one since the MIME type has already been set
+		// on the request, so the boundary is chosen up front
+		mpw, err := body.newWriter(io.Discard, body.boundary)
+		if err != nil {
+			return StreamBody{}, err
+		}
+		boundary := mpw.Boundary()
+
+		current := body.stream(boundary)
+		stream := StreamBody{Reader: current, Length: -1, MimeType: mpw.FormDataContentType()}
+		if canRewind {
+			stream.Rewind = func() (io.Reader, error) {
+				// the previous stream may still be reading the parts, so stop it before seeking
+				current.Close()
+				if err := body.seekTo(offsets); err != nil {
+					return nil, err
+				}
+				current = body.stream(boundary)
+				return current, nil
+			}
+		}
+		return stream, nil
+	}
+}
+
+// The parts written into a pipe; writing starts on the first read, so that a request that is never sent doesn't
+// leave anything running
+type partStream struct {
+	body     *MultipartBody
+	boundary string
+
+	mu     sync.Mutex
+	reader *io.PipeReader
+	done   chan struct{} // closed once the parts are no longer being read
+	closed bool
+}
+
+func (m *MultipartBody) stream(boundary string) *partStream {
+	return &partStream{body: m, boundary: boundary}
+}
+
+func (ps *partStream) Read(p []byte) (int, error) {
+	ps.mu.Lock()
+	if ps.closed {
+		ps.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	if ps.reader == nil {
+		ps.start()
+	}
+	reader := ps.reader
+	ps.mu.Unlock()
+	return reader.Read(p)
+}
+
+// Closes the reader and waits for the writer to finish with the parts
+func (ps *partStream) Close() error {
+	ps.mu.Lock()
+	ps.closed = true
+	reader, done := ps.reader, ps.done
+	ps.mu.Unlock()
+
+	if reader != nil {
+		reader.Close()
+		<-done
+	}
+	return nil
+}
+
+// Starts writing the parts into a pipe; called with the lock held
+func (ps *partStream) start() {
+	pr, pw := io.Pipe()
+	ps.reader, ps.done = pr, make(chan struct{})
+	go func() {
+		defer close(ps.done)
+		mpw, err := ps.body.newWriter(pw, ps.boundary)
+		if err == nil {
+			err = ps.body.writeParts(mpw)
+		}
+		// closing with a nil error is the same as Close(); the reader receives io.EOF
+		pw.CloseWithError(err)
+	}()
+}
+
+// Records the current offset of each part so that the parts can be re-read later
+func (m *MultipartBody) seekOffsets() ([]int64, bool) {
+	offsets := make([]int64, len(m.parts))
+	for index, part := range m.parts {
+		seeker, ok := part.reader.(io.Seeker)
+		if !ok {
+			return nil, false
+		}
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, false
+		}
+		offsets[index] = offset
+	}
+	return offsets, true
+}
+
+func (m *MultipartBody) seekTo(offsets []int64) error {
+	for index, part := range m.parts {
+		if _, err := part.reader.(io.Seeker).Seek(offsets[index], io.SeekStart); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrorRewindingBody, part.fieldName, err)
+		}
+	}
+	return nil
+}
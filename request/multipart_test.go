@@ -0,0 +1,108 @@
+package request
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/mocks"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+)
+
+type partRecord struct {
+	fieldName   string
+	fileName    string
+	contentType string
+	data        string
+}
+
+func readMultipartRequest(req *http.Request) []partRecord {
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get(header.ContentType))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(mediaType).To(Equal(header.MimeTypeMultipartForm))
+
+	records := make([]partRecord, 0)
+	reader := multipart.NewReader(req.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		Expect(err).ToNot(HaveOccurred())
+		data, err := io.ReadAll(part)
+		Expect(err).ToNot(HaveOccurred())
+		records = append(records, partRecord{
+			fieldName:   part.FormName(),
+			fileName:    part.FileName(),
+			contentType: part.Header.Get(header.ContentType),
+			data:        string(data),
+		})
+	}
+	return records
+}
+
+var _ = Describe("Multipart Body", func() {
+	It("should write fields and files in order", func() {
+		// Arrange
+		body := NewMultipartBody().
+			WithField("description", "holiday photos").
+			WithFile("raw", "data.bin", strings.NewReader("binary data")).
+			WithFilePart("photo", `the "beach".png`, "image/png", strings.NewReader("png data"))
+
+		// Act
+		req, err := NewPostRequest("http://test.org/upload", WithMultipartBody(body))
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(readMultipartRequest(req)).To(Equal([]partRecord{
+			{fieldName: "description", data: "holiday photos"},
+			{fieldName: "raw", fileName: "data.bin", contentType: header.MimeTypeBinary, data: "binary data"},
+			{fieldName: "photo", fileName: `the "beach".png`, contentType: "image/png", data: "png data"},
+		}))
+	})
+	It("should use the boundary when provided", func() {
+		// Arrange
+		body := NewMultipartBody().WithBoundary("test-boundary").WithField("name", "value")
+
+		// Act
+		req, err := NewPostRequest("http://test.org/upload", WithMultipartBody(body))
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(req.Header.Get(header.ContentType)).To(Equal("multipart/form-data; boundary=test-boundary"))
+	})
+	It("should return an error when the boundary is invalid", func() {
+		// Arrange
+		body := NewMultipartBody().WithBoundary("not a valid boundary because it is far too long to be used by the multipart writer")
+
+		// Act
+		req, err := NewPostRequest("http://test.org/upload", WithMultipartBody(body))
+
+		// Assert
+		Expect(req).To(BeNil())
+		Expect(err).To(MatchError(ErrorWritingMultipart))
+	})
+	It("should return an error when a file part cannot be read", func() {
+		// Arrange
+		ctrl := gomock.NewController(GinkgoT())
+		defer ctrl.Finish()
+		mockReader := mocks.NewMockReadCloser(ctrl)
+		mockReader.EXPECT().Read(gomock.Any()).Return(0, errors.New("irreconcilable differences"))
+
+		body := NewMultipartBody().WithFile("raw", "data.bin", mockReader)
+
+		// Act
+		req, err := NewPostRequest("http://test.org/upload", WithMultipartBody(body))
+
+		// Assert
+		Expect(req).To(BeNil())
+		Expect(err).To(MatchError(ErrorWritingMultipart))
+		Expect(err).To(MatchError(ContainSubstring("irreconcilable differences")))
+	})
+})
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 
 	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
 )
 
 // Errors
@@ -16,8 +19,18 @@ var (
 	ErrorMarshalingBody = errors.New("failed to marshal body")
 )
 
+// Provides the request body as a byte slice.
 type BodyDataProvider func() (data []byte, mimeType string, err error)
 
+func (p BodyDataProvider) streamBody() (StreamBody, error) {
+	data, mimeType, err := p()
+	if err != nil {
+		return StreamBody{}, err
+	}
+	// http.NewRequest recognizes *bytes.Reader and sets the content length and rewind (GetBody) itself
+	return StreamBody{Reader: bytes.NewReader(data), Length: int64(len(data)), MimeType: mimeType}, nil
+}
+
 // Body Data Providers
 
 func WithNoBody() BodyDataProvider {
@@ -40,6 +53,26 @@ func WithJsonBody(object interface{}) BodyDataProvider {
 	}
 }
 
+// Encodes the object using the codec registered for the MIME type (see rw.RegisterCodec)
+func WithBody(object interface{}, mimeType string) BodyDataProvider {
+	return func() ([]byte, string, error) {
+		var raw []byte
+		if object != nil {
+			var err error
+			raw, err = rw.Marshal(object, mimeType)
+			if err != nil {
+				return nil, "", fmt.Errorf("%w: %w", ErrorMarshalingBody, err)
+			}
+		}
+		return WithCustomBody(raw, mimeType)()
+	}
+}
+
+// Encodes the values as "application/x-www-form-urlencoded", e.g. for OAuth token requests.
+func WithFormBody(values url.Values) BodyDataProvider {
+	return WithCustomBody([]byte(values.Encode()), header.MimeTypeForm)
+}
+
 func WithBinaryBody(data []byte) BodyDataProvider {
 	return WithCustomBody(data, header.MimeTypeBinary)
 }
@@ -53,49 +86,56 @@ func WithCustomBody(data []byte, mimeType string) BodyDataProvider {
 // Request Creators
 
 func NewGetRequest(uri string) (*http.Request, error) {
-	return newRequest(http.MethodGet, uri, nil)
+	return newRequest(http.MethodGet, uri, http.NoBody)
 }
 
 func NewDeleteRequest(uri string) (*http.Request, error) {
-	return newRequest(http.MethodDelete, uri, nil)
+	return newRequest(http.MethodDelete, uri, http.NoBody)
 }
 
-func NewPostRequest(uri string, bodyFn BodyDataProvider) (*http.Request, error) {
+func NewPostRequest(uri string, bodyFn BodyProvider) (*http.Request, error) {
 	return newRequestWithBody(http.MethodPost, uri, bodyFn)
 }
 
-func NewPutRequest(uri string, bodyFn BodyDataProvider) (*http.Request, error) {
+func NewPutRequest(uri string, bodyFn BodyProvider) (*http.Request, error) {
 	return newRequestWithBody(http.MethodPut, uri, bodyFn)
 }
 
-func NewPatchRequest(uri string, bodyFn BodyDataProvider) (*http.Request, error) {
+func NewPatchRequest(uri string, bodyFn BodyProvider) (*http.Request, error) {
 	return newRequestWithBody(http.MethodPatch, uri, bodyFn)
 }
 
-func newRequest(method string, uri string, body []byte) (*http.Request, error) {
+func newRequest(method string, uri string, body io.Reader) (*http.Request, error) {
 	if uri == "" {
 		return nil, ErrorMissingUri
 	}
-	req, err := http.NewRequest(method, uri, bytes.NewBuffer(body))
+	req, err := http.NewRequest(method, uri, body)
 	if err != nil {
 		return nil, err
 	}
 	return req, nil
 }
 
-func newRequestWithBody(method string, uri string, bodyFn BodyDataProvider) (*http.Request, error) {
-	raw, mimeType, err := bodyFn()
+func newRequestWithBody(method string, uri string, bodyFn BodyProvider) (*http.Request, error) {
+	// check the uri first so that we don't open streams that will never be read
+	if uri == "" {
+		return nil, ErrorMissingUri
+	}
+
+	body, err := bodyFn.streamBody()
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := newRequest(method, uri, raw)
+	req, err := newRequest(method, uri, body.Reader)
 	if err != nil {
+		body.close()
 		return nil, err
 	}
+	body.applyTo(req)
 
-	if mimeType != "" {
-		req.Header.Add(header.ContentType, mimeType)
+	if body.MimeType != "" {
+		req.Header.Add(header.ContentType, body.MimeType)
 	}
 	return req, nil
 }
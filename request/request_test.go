@@ -6,8 +6,10 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"net/url"
 
 	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"golang.org/x/text/cases"
@@ -76,7 +78,7 @@ var _ = Describe("Request Helpers", func() {
 		// (for now) we can test all the data requests in a loop
 		testdata := []struct {
 			method    string
-			requestFn func(string, BodyDataProvider) (*http.Request, error)
+			requestFn func(string, BodyProvider) (*http.Request, error)
 		}{
 			{http.MethodPut, NewPutRequest}, {http.MethodPost, NewPostRequest}, {http.MethodPatch, NewPatchRequest},
 		}
@@ -143,6 +145,34 @@ var _ = Describe("Request Helpers", func() {
 					Expect(err).To(BeNil())
 					Expect(raw).To(Equal([]byte("test data")))
 				})
+				It("should return a request when encoded data is valid", func() {
+					data := testData{Name: "valid request"}
+					req, err := test.requestFn("foo.com", WithBody(data, header.MimeTypeXml))
+					Expect(req.Method).To(Equal(test.method))
+					Expect(err).To(BeNil())
+					Expect(req.Header.Get(header.ContentType)).To(Equal(header.MimeTypeXml))
+
+					raw, err := io.ReadAll(req.Body)
+					Expect(err).To(BeNil())
+					Expect(string(raw)).To(Equal("<testData><Name>valid request</Name><Cost>0</Cost></testData>"))
+				})
+				It("should return an error when the mime type has no codec", func() {
+					req, err := test.requestFn("foo.com", WithBody(testData{Name: "valid name"}, "text/csv"))
+					Expect(req).To(BeNil())
+					Expect(err).To(MatchError(ErrorMarshalingBody))
+					Expect(err).To(MatchError(rw.ErrorUnsupportedMimeType))
+				})
+				It("should return a request when form data is valid", func() {
+					values := url.Values{"grant_type": {"client_credentials"}, "scope": {"read write"}}
+					req, err := test.requestFn("foo.com", WithFormBody(values))
+					Expect(req.Method).To(Equal(test.method))
+					Expect(err).To(BeNil())
+					Expect(req.Header.Get(header.ContentType)).To(Equal(header.MimeTypeForm))
+
+					raw, err := io.ReadAll(req.Body)
+					Expect(err).To(BeNil())
+					Expect(string(raw)).To(Equal("grant_type=client_credentials&scope=read+write"))
+				})
 			})
 		}
 	})
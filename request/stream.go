@@ -0,0 +1,122 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+var (
+	ErrorOpeningBody   = errors.New("failed to open body")
+	ErrorRewindingBody = errors.New("failed to rewind body")
+)
+
+// Describes a request body that is read from an io.Reader rather than held in memory.
+type StreamBody struct {
+	Reader   io.Reader
+	Length   int64  // the content length, or -1 if it isn't known
+	MimeType string // optional
+	// Optional; returns a reader positioned at the start of the body.
+	// The client uses this to re-send the body when a request is retried.
+	Rewind func() (io.Reader, error)
+}
+
+// Provides the request body as a stream.
+type BodyStreamProvider func() (StreamBody, error)
+
+func (p BodyStreamProvider) streamBody() (StreamBody, error) {
+	return p()
+}
+
+// The New*Request functions accept either a BodyDataProvider or a BodyStreamProvider
+type BodyProvider interface {
+	streamBody() (StreamBody, error)
+}
+
+func (b StreamBody) applyTo(req *http.Request) {
+	if b.Length > 0 {
+		req.ContentLength = b.Length
+	}
+	if b.Rewind != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			reader, err := b.Rewind()
+			if err != nil {
+				return nil, err
+			}
+			if rc, ok := reader.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return io.NopCloser(reader), nil
+		}
+	}
+}
+
+// used if the request can't be created; the body would otherwise be closed by the client
+func (b StreamBody) close() {
+	if closer, ok := b.Reader.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// Body Stream Providers
+
+// Streams the body from an existing reader.
+//
+// Pass -1 as the length if it isn't known.  If the reader implements io.Seeker the body can be
+// rewound for retries.  The reader is never closed (even if it is an io.Closer); that is up to the caller, once
+// the request is done.
+func WithReaderBody(reader io.Reader, length int64, mimeType string) BodyStreamProvider {
+	return func() (StreamBody, error) {
+		// the client closes the body after each attempt, which would leave nothing to rewind
+		stream := StreamBody{Reader: io.NopCloser(reader), Length: length, MimeType: mimeType}
+
+		if seeker, ok := reader.(io.Seeker); ok {
+			start, err := seeker.Seek(0, io.SeekCurrent)
+			if err == nil {
+				stream.Rewind = func() (io.Reader, error) {
+					if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+						return nil, fmt.Errorf("%w: %w", ErrorRewindingBody, err)
+					}
+					return io.NopCloser(reader), nil
+				}
+			}
+		}
+		return stream, nil
+	}
+}
+
+// Streams the body straight from a file.
+//
+// The file is opened when the request is created and is closed by the client once the request has been sent.
+func WithFileBody(path string, mimeType string) BodyStreamProvider {
+	return func() (StreamBody, error) {
+		file, size, err := openBodyFile(path)
+		if err != nil {
+			return StreamBody{}, err
+		}
+
+		rewind := func() (io.Reader, error) {
+			file, _, err := openBodyFile(path)
+			if err != nil {
+				return nil, err
+			}
+			return file, nil
+		}
+		return StreamBody{Reader: file, Length: size, MimeType: mimeType, Rewind: rewind}, nil
+	}
+}
+
+func openBodyFile(path string) (*os.File, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrorOpeningBody, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("%w: %w", ErrorOpeningBody, err)
+	}
+	return file, info.Size(), nil
+}
@@ -0,0 +1,239 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing/iotest"
+	"time"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// counts the reads, so that tests can tell when the body is read
+type countingReader struct {
+	io.Reader
+	reads atomic.Int32
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	cr.reads.Add(1)
+	return cr.Reader.Read(p)
+}
+
+func readAndRewind(req *http.Request) (string, string) {
+	first, err := io.ReadAll(req.Body)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(req.GetBody).ToNot(BeNil())
+
+	body, err := req.GetBody()
+	Expect(err).ToNot(HaveOccurred())
+	defer body.Close()
+	second, err := io.ReadAll(body)
+	Expect(err).ToNot(HaveOccurred())
+	return string(first), string(second)
+}
+
+var _ = Describe("Stream Body Providers", func() {
+	Context("WithReaderBody", func() {
+		It("should not let the request close the reader", func() {
+			// Arrange
+			path := filepath.Join(GinkgoT().TempDir(), "upload.txt")
+			Expect(os.WriteFile(path, []byte("file data"), 0o600)).To(Succeed())
+			file, err := os.Open(path)
+			Expect(err).ToNot(HaveOccurred())
+			defer file.Close()
+			req, err := NewPutRequest("foo.com", WithReaderBody(file, 9, "text/plain"))
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			Expect(req.Body.Close()).To(Succeed())
+
+			// Assert
+			body, err := req.GetBody()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body.Close()).To(Succeed())
+			data, err := io.ReadAll(body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("file data"))
+		})
+		It("should stream from a seekable reader and rewind it", func() {
+			// Act
+			req, err := NewPutRequest("foo.com", WithReaderBody(strings.NewReader("test data"), 9, "text/plain"))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req.ContentLength).To(Equal(int64(9)))
+			Expect(req.Header.Get(header.ContentType)).To(Equal("text/plain"))
+			first, second := readAndRewind(req)
+			Expect(first).To(Equal("test data"))
+			Expect(second).To(Equal("test data"))
+		})
+		It("should not rewind a reader that cannot seek", func() {
+			// Act
+			req, err := NewPutRequest("foo.com", WithReaderBody(io.MultiReader(strings.NewReader("test data")), -1, ""))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req.ContentLength).To(Equal(int64(0)))
+			Expect(req.Header.Get(header.ContentType)).To(BeEmpty())
+			Expect(req.GetBody).To(BeNil())
+			data, err := io.ReadAll(req.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("test data"))
+		})
+	})
+
+	Context("WithFileBody", func() {
+		var path string
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "upload.bin")
+			Expect(os.WriteFile(path, []byte("file data"), 0o600)).To(Succeed())
+		})
+		It("should stream the file and rewind it", func() {
+			// Act
+			req, err := NewPostRequest("foo.com", WithFileBody(path, header.MimeTypeBinary))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req.ContentLength).To(Equal(int64(9)))
+			Expect(req.Header.Get(header.ContentType)).To(Equal(header.MimeTypeBinary))
+			first, second := readAndRewind(req)
+			Expect(first).To(Equal("file data"))
+			Expect(second).To(Equal("file data"))
+			Expect(req.Body.Close()).To(Succeed())
+		})
+		It("should return an error when the file cannot be opened", func() {
+			// Act
+			req, err := NewPostRequest("foo.com", WithFileBody(path+".missing", header.MimeTypeBinary))
+
+			// Assert
+			Expect(req).To(BeNil())
+			Expect(err).To(MatchError(ErrorOpeningBody))
+		})
+		It("should not open the file when uri is empty", func() {
+			// Arrange
+			opened := false
+			provider := BodyStreamProvider(func() (StreamBody, error) {
+				opened = true
+				return WithFileBody(path, header.MimeTypeBinary)()
+			})
+
+			// Act
+			req, err := NewPostRequest("", provider)
+
+			// Assert
+			Expect(req).To(BeNil())
+			Expect(err).To(Equal(ErrorMissingUri))
+			Expect(opened).To(BeFalse())
+		})
+	})
+
+	Context("WithMultipartStream", func() {
+		It("should stream the parts and rewind them with the same boundary", func() {
+			// Arrange
+			body := NewMultipartBody().
+				WithField("description", "holiday photos").
+				WithFilePart("photo", "beach.png", "image/png", bytes.NewReader([]byte("png data")))
+
+			// Act
+			req, err := NewPostRequest("http://test.org/upload", WithMultipartStream(body))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			first, second := readAndRewind(req)
+			Expect(first).ToNot(BeEmpty())
+			Expect(second).To(Equal(first))
+
+			req.Body = io.NopCloser(strings.NewReader(first))
+			Expect(readMultipartRequest(req)).To(Equal([]partRecord{
+				{fieldName: "description", data: "holiday photos"},
+				{fieldName: "photo", fileName: "beach.png", contentType: "image/png", data: "png data"},
+			}))
+		})
+		It("should stop the previous stream before rewinding", func() {
+			// Arrange
+			data := strings.Repeat("png data ", 10000)
+			body := NewMultipartBody().WithFilePart("photo", "beach.png", "image/png", strings.NewReader(data))
+			req, err := NewPostRequest("http://test.org/upload", WithMultipartStream(body))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = io.ReadFull(req.Body, make([]byte, 100))
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			rewound, err := req.GetBody()
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			_, err = io.ReadAll(req.Body)
+			Expect(err).To(MatchError(io.ErrClosedPipe))
+			req.Body = rewound
+			Expect(readMultipartRequest(req)).To(Equal([]partRecord{
+				{fieldName: "photo", fileName: "beach.png", contentType: "image/png", data: data},
+			}))
+		})
+		It("should not read the parts until the body is read", func() {
+			// Arrange
+			reader := &countingReader{Reader: strings.NewReader("png data")}
+			body := NewMultipartBody().WithFilePart("photo", "beach.png", "image/png", reader)
+
+			// Act
+			req, err := NewPostRequest("http://test.org/upload", WithMultipartStream(body))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Consistently(reader.reads.Load, 50*time.Millisecond).Should(BeZero())
+			Expect(readMultipartRequest(req)).To(Equal([]partRecord{
+				{fieldName: "photo", fileName: "beach.png", contentType: "image/png", data: "png data"},
+			}))
+			Expect(reader.reads.Load()).ToNot(BeZero())
+		})
+		It("should not read the parts of a body that is closed unread", func() {
+			// Arrange
+			reader := &countingReader{Reader: strings.NewReader("png data")}
+			body := NewMultipartBody().WithFilePart("photo", "beach.png", "image/png", reader)
+			req, err := NewPostRequest("http://test.org/upload", WithMultipartStream(body))
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			Expect(req.Body.Close()).To(Succeed())
+
+			// Assert
+			_, err = io.ReadAll(req.Body)
+			Expect(err).To(MatchError(io.ErrClosedPipe))
+			Expect(reader.reads.Load()).To(BeZero())
+		})
+		It("should not rewind when a part cannot seek", func() {
+			// Arrange
+			body := NewMultipartBody().WithFile("raw", "data.bin", io.MultiReader(strings.NewReader("raw data")))
+
+			// Act
+			req, err := NewPostRequest("http://test.org/upload", WithMultipartStream(body))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(req.GetBody).To(BeNil())
+			Expect(readMultipartRequest(req)).To(Equal([]partRecord{
+				{fieldName: "raw", fileName: "data.bin", contentType: header.MimeTypeBinary, data: "raw data"},
+			}))
+		})
+		It("should report part failures through the body", func() {
+			// Arrange
+			body := NewMultipartBody().WithFile("raw", "data.bin", iotest.ErrReader(io.ErrUnexpectedEOF))
+
+			// Act
+			req, err := NewPostRequest("http://test.org/upload", WithMultipartStream(body))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = io.ReadAll(req.Body)
+
+			// Assert
+			Expect(err).To(MatchError(ErrorWritingMultipart))
+		})
+	})
+})
@@ -0,0 +1,127 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/mortedecai/resweave"
+)
+
+var (
+	ErrInvalidAction = errors.New("invalid custom action")
+)
+
+// Handles a custom action; see AddAction
+type ActionFunc func(context.Context, response.Writer, *http.Request)
+
+// A verb beyond Create, List, Fetch, Delete and Update, e.g. cancelling a job
+type CustomAction struct {
+	Name       string
+	Methods    []string // the accepted methods; POST if there aren't any
+	RequiresID bool     // whether the action is for an entity (e.g. /jobs/7:cancel) or the collection (e.g. /jobs:purge)
+	Handler    ActionFunc
+	Validate   ValidateFunc // optional, like the validators set with SetValidator
+
+	accepted methodAcceptance
+}
+
+type customActionMap map[string]*CustomAction
+
+// Add a custom action to the resource.  Actions are requested by adding their name to the path after a colon, e.g.
+// `POST /jobs/7:cancel` or `POST /jobs:purge`, or, for actions that require an id, as a segment after the id, e.g.
+// `POST /users/7/reset-password` (a child resource with the same name takes precedence).
+//
+// resweave routes entity actions to the resource by its name and id (the id pattern set with SetID is widened to
+// allow the action's suffix, e.g. 7:cancel with resweave.NumericID), and collection actions are registered with
+// resweave as resources of their own (e.g. jobs:purge) by AddEasyResource.  Requests go through the same validations
+// as the other actions: the method, then the action's validator (see SetActionValidator).  Handlers get the id with
+// PathIDsFrom() or PathIDOf().
+func (erh EasyResourceHandler) AddAction(action CustomAction) error {
+	if action.Name == "" || strings.ContainsAny(action.Name, "/:") {
+		return fmt.Errorf("%w: invalid name %q", ErrInvalidAction, action.Name)
+	}
+	if action.Handler == nil {
+		return fmt.Errorf("%w: %s has no handler", ErrInvalidAction, action.Name)
+	}
+	if _, found := erh.actions[action.Name]; found {
+		return fmt.Errorf("%w: %s has already been added", ErrInvalidAction, action.Name)
+	}
+	if len(action.Methods) == 0 {
+		action.Methods = []string{http.MethodPost}
+	}
+	action.accepted = make(methodAcceptance, len(action.Methods))
+	for _, method := range action.Methods {
+		action.accepted[method] = true
+	}
+	erh.actions[action.Name] = &action
+
+	if action.RequiresID {
+		if err := erh.applyID(); err != nil {
+			return err
+		}
+	}
+	return erh.addActionResource(&action)
+}
+
+// Set the validator for a custom action, like SetValidator does for the other actions; nil removes it.
+func (erh EasyResourceHandler) SetActionValidator(name string, validate ValidateFunc) error {
+	action, found := erh.actions[name]
+	if !found {
+		return fmt.Errorf("%w: %s hasn't been added", ErrInvalidAction, name)
+	}
+	action.Validate = validate
+	return nil
+}
+
+// Collection actions (e.g. /jobs:purge) don't have the resource's name as a segment of its own, so resweave can't
+// route them to the resource; they're registered as resources of their own instead, once the resource is.
+func (erh EasyResourceHandler) addActionResource(action *CustomAction) error {
+	server := erh.options.server
+	if action.RequiresID || server == nil {
+		return nil
+	}
+	api := resweave.NewAPI(erh.Name() + ":" + resweave.ResourceName(action.Name))
+	api.SetHandler(func(_ resweave.ActionType, ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		funcName := "handleActionResource"
+		erh.NewInfo(funcName, "Starting").With("action", action.Name).Log()
+		defer erh.NewInfo(funcName, "Completed").With("action", action.Name).Log()
+
+		// an id after the action (e.g. /jobs:purge/7) isn't for anything
+		_, err := api.GetIDValue(ctx)
+		routed := &routedRequest{target: &erh, action: action, hasId: err == nil}
+		routed.serve(ctx, response.NewWriter(w).ResponseWriter(), r)
+	})
+	return server.AddResource(api)
+}
+
+// The id pattern set with SetID, widened to allow the suffixes of the entity actions, e.g. 7:cancel
+func (erh EasyResourceHandler) applyID() error {
+	if erh.options.id == "" {
+		return nil
+	}
+	var names []string
+	for name, action := range erh.actions {
+		if action.RequiresID {
+			names = append(names, name)
+		}
+	}
+	return erh.api.SetID(actionIDPattern(erh.options.id, names))
+}
+
+func actionIDPattern(id resweave.ID, actions []string) resweave.ID {
+	if len(actions) == 0 {
+		return id
+	}
+	quoted := make([]string, len(actions))
+	for index, name := range actions {
+		quoted[index] = regexp.QuoteMeta(name)
+	}
+	slices.Sort(quoted)
+	return resweave.ID(fmt.Sprintf("(?:%s)(?::(?:%s))?", id, strings.Join(quoted, "|")))
+}
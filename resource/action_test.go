@@ -0,0 +1,188 @@
+package resource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/mortedecai/resweave"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Custom actions", func() {
+	type actionCall struct {
+		action string
+		path   PathIDs
+	}
+	var (
+		jobs    *nodeResource
+		handler *EasyResourceHandler
+		calls   []actionCall
+		record  func(name string) ActionFunc
+		serve   func(method string, path string) *http.Response
+	)
+	BeforeEach(func() {
+		calls = nil
+		record = func(name string) ActionFunc {
+			return func(ctx context.Context, writer response.Writer, _ *http.Request) {
+				calls = append(calls, actionCall{action: name, path: PathIDsFrom(ctx)})
+				writer.WriteResponse(http.StatusAccepted)
+			}
+		}
+		jobs = newNodeResource("jobs", "7")
+		handler = NewResource("jobs", jobs)
+		Expect(handler.SetID(resweave.NumericID)).To(Succeed())
+		Expect(handler.AddAction(CustomAction{Name: "cancel", RequiresID: true, Handler: record("cancel")})).To(Succeed())
+		Expect(handler.AddAction(CustomAction{Name: "purge", Methods: []string{http.MethodPost, http.MethodDelete}, Handler: record("purge")})).To(Succeed())
+
+		server := resweave.NewServer(8080)
+		Expect(handler.AddEasyResource(server)).To(Succeed())
+		serve = func(method string, path string) *http.Response {
+			recorder := httptest.NewRecorder()
+			server.Serve(recorder, httptest.NewRequest(method, path, nil))
+			return recorder.Result()
+		}
+	})
+
+	DescribeTable("should call the action's handler",
+		func(method string, path string, expectCall actionCall) {
+			// Act
+			resp := serve(method, path)
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+			Expect(calls).To(Equal([]actionCall{expectCall}))
+			Expect(jobs.calls).To(BeEmpty())
+		},
+		Entry("for an entity", http.MethodPost, "/jobs/7:cancel", actionCall{action: "cancel", path: PathIDs{{"jobs", "7"}}}),
+		Entry("for an entity, as a segment", http.MethodPost, "/jobs/7/cancel", actionCall{action: "cancel", path: PathIDs{{"jobs", "7"}}}),
+		Entry("for the collection", http.MethodPost, "/jobs:purge", actionCall{action: "purge", path: nil}),
+		Entry("with another accepted method", http.MethodDelete, "/jobs:purge", actionCall{action: "purge", path: nil}),
+	)
+
+	It("should treat colons in ids that aren't followed by an action as part of the id", func() {
+		// Act
+		resp := serve(http.MethodGet, "/jobs/7:other")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(jobs.calls).To(Equal([]nodeCall{{action: resweave.Fetch, id: "7:other"}}))
+		Expect(calls).To(BeEmpty())
+	})
+
+	DescribeTable("should reject requests that don't fit the action",
+		func(method string, path string, expectStatus int, expectErr response.ServiceError) {
+			// Act
+			resp := serve(method, path)
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(expectStatus))
+			Expect(response.ParseResponse(resp, http.StatusAccepted)).To(MatchError(expectErr))
+			Expect(calls).To(BeEmpty())
+		},
+		Entry("with a method that isn't accepted", http.MethodGet, "/jobs/7:cancel", http.StatusMethodNotAllowed, response.SvcErrorInvalidMethod),
+		Entry("with an id for a collection action", http.MethodPost, "/jobs/7:purge", http.StatusNotFound, response.SvcErrorResourceNotFound),
+		Entry("with an unknown segment", http.MethodPost, "/jobs/7/restart", http.StatusNotFound, response.SvcErrorResourceNotFound),
+	)
+
+	It("should not route entity actions without an id", func() {
+		// Act
+		resp := serve(http.MethodPost, "/jobs:cancel")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(calls).To(BeEmpty())
+	})
+
+	It("should call the action's validator", func() {
+		// Arrange
+		Expect(handler.AddAction(CustomAction{
+			Name:       "restart",
+			RequiresID: true,
+			Handler:    record("restart"),
+			Validate: func(context.Context, response.Writer, *http.Request) (int, response.ServiceError) {
+				return http.StatusConflict, response.SvcErrorRequestInProgress
+			},
+		})).To(Succeed())
+
+		// Act
+		resp := serve(http.MethodPost, "/jobs/7:restart")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+		Expect(calls).To(BeEmpty())
+	})
+
+	It("should call validators set with SetActionValidator", func() {
+		// Arrange
+		Expect(handler.SetActionValidator("purge", func(context.Context, response.Writer, *http.Request) (int, response.ServiceError) {
+			return http.StatusForbidden, response.SvcErrorInvalidMethod
+		})).To(Succeed())
+
+		// Act
+		resp := serve(http.MethodPost, "/jobs:purge")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+		Expect(calls).To(BeEmpty())
+		Expect(handler.SetActionValidator("pause", nil)).To(MatchError(ErrInvalidAction))
+	})
+
+	It("should register collection actions that are added after the resource", func() {
+		// Arrange
+		Expect(handler.AddAction(CustomAction{Name: "archive", Handler: record("archive")})).To(Succeed())
+
+		// Act
+		resp := serve(http.MethodPost, "/jobs:archive")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(calls).To(Equal([]actionCall{{action: "archive"}}))
+	})
+
+	DescribeTable("should widen the id pattern to allow entity actions",
+		func(id string, expectMatch bool) {
+			pattern := actionIDPattern(resweave.NumericID, []string{"cancel", "re.start"})
+			Expect(regexp.MustCompile("^" + string(pattern) + "$").MatchString(id)).To(Equal(expectMatch))
+		},
+		Entry("an id", "7", true),
+		Entry("an id with an action", "7:cancel", true),
+		Entry("an id with an action that has a special character", "7:re.start", true),
+		Entry("an id with an unknown action", "7:purge", false),
+		Entry("an invalid id with an action", "x:cancel", false),
+	)
+
+	It("should check the parents of nested resources' actions", func() {
+		// Arrange
+		queues := newNodeResource("queues", "1")
+		jobs = newNodeResource("jobs", "7")
+		root := NewResource("queues", queues)
+		child := root.AddChild(NewResource("jobs", jobs))
+		Expect(child.AddAction(CustomAction{Name: "cancel", RequiresID: true, Handler: record("cancel")})).To(Succeed())
+		server := resweave.NewServer(8080)
+		Expect(root.AddEasyResource(server)).To(Succeed())
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.Serve(recorder, httptest.NewRequest(http.MethodPost, "/queues/1/jobs/7:cancel", nil))
+		server.Serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/queues/2/jobs/7:cancel", nil))
+
+		// Assert
+		Expect(recorder.Code).To(Equal(http.StatusAccepted))
+		Expect(calls).To(Equal([]actionCall{{action: "cancel", path: PathIDs{{"queues", "1"}, {"jobs", "7"}}}}))
+		Expect(queues.calls).To(HaveLen(2))
+	})
+
+	DescribeTable("should reject invalid actions",
+		func(action CustomAction) {
+			Expect(handler.AddAction(action)).To(MatchError(ErrInvalidAction))
+		},
+		Entry("without a name", CustomAction{Handler: func(context.Context, response.Writer, *http.Request) {}}),
+		Entry("with a colon in the name", CustomAction{Name: "a:b", Handler: func(context.Context, response.Writer, *http.Request) {}}),
+		Entry("without a handler", CustomAction{Name: "pause"}),
+		Entry("that was already added", CustomAction{Name: "cancel", Handler: func(context.Context, response.Writer, *http.Request) {}}),
+	)
+})
@@ -0,0 +1,352 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+	"github.com/mortedecai/resweave"
+)
+
+// The most operations a batch can have unless EnableBatch says otherwise
+const DefaultBatchSize = 1000
+
+// The operations that a batch can have
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update" // like PUT
+	BatchPatch  = "patch"  // like PATCH
+	BatchDelete = "delete"
+)
+
+// The body of a batch request; see EnableBatch
+type Batch struct {
+	Atomic     bool             `json:"atomic,omitempty"` // all or nothing; see Transactor
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchOperation struct {
+	Op          string          `json:"op"`
+	ID          string          `json:"id,omitempty"`          // required for everything but create
+	IfMatch     string          `json:"ifMatch,omitempty"`     // sent as the operation's If-Match header
+	ContentType string          `json:"contentType,omitempty"` // the body's JSON media type; application/json if empty
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// The outcome of a batch operation: the status and body (or error) of the response that the operation would have had
+// as a request of its own
+type BatchResult struct {
+	Status   int                   `json:"status"`
+	Location string                `json:"location,omitempty"`
+	Body     json.RawMessage       `json:"body,omitempty"`
+	Error    response.ServiceError `json:"error,omitempty"`
+}
+
+func (br *BatchResult) UnmarshalJSON(data []byte) error {
+	type plainResult BatchResult
+	var result struct {
+		plainResult
+		Error *response.SvcError `json:"error,omitempty"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	*br = BatchResult(result.plainResult)
+	if result.Error != nil {
+		br.Error = result.Error
+	}
+	return nil
+}
+
+// The body of a batch response, with a result for each operation
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// Resources can implement this to handle batches themselves (e.g. with a bulk insert) instead of having the operations
+// passed to their methods one by one; return a result for each operation, in order.
+type BatchHandler interface {
+	Batch(ctx context.Context, batch Batch) ([]BatchResult, error)
+}
+
+// Resources that implement this support atomic batches: the operations are run in a single transaction, which is
+// rolled back if any of them fail.  The resource's methods must use the context they are called with to take part in
+// the transaction.
+type Transactor interface {
+	// Call fn in a transaction, which is committed if fn returns nil and rolled back otherwise
+	InTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Implemented by adapters that only sometimes support transactions (e.g. typed resources)
+type transactionImplementer interface {
+	implementsTransactions() bool
+}
+
+func (erh EasyResourceHandler) transactor() (Transactor, bool) {
+	transactor, ok := erh.resource.(Transactor)
+	if impl, isAdapter := erh.resource.(transactionImplementer); ok && isAdapter {
+		ok = impl.implementsTransactions()
+	}
+	return transactor, ok
+}
+
+// Operation bodies are JSON, so they can only have JSON media types (e.g. application/json-patch+json)
+func isJsonMimeType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == header.MimeTypeJson || (strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")))
+}
+
+// an operation failed, so the transaction was rolled back
+var errBatchOperationFailed = errors.New("batch operation failed")
+
+// Add a batch action (see AddAction), so that clients can send many creates, updates and deletes in one request:
+//
+//	POST /foos:batch
+//	{
+//	  "atomic": false,
+//	  "operations": [
+//	    {"op": "create", "body": {"name": "cog"}},
+//	    {"op": "update", "id": "7", "ifMatch": "\"v3\"", "body": {"id": 7, "name": "sprocket"}},
+//	    {"op": "delete", "id": "3"}
+//	  ]
+//	}
+//
+// The operations are passed to the resource's methods in order, as if they were requests of their own (with the same
+// validations), unless the resource is a BatchHandler, which must return a result for each operation.  Bodies are
+// application/json unless the operation has a contentType (e.g. application/json-patch+json for a JSON Patch), which
+// must be a JSON media type.  The response is 207 (Multi-Status) with a BatchResponse.
+//
+// Atomic batches are only supported by resources that are a Transactor (or BatchHandler); if an operation fails the
+// others get 424 (Failed Dependency).  Batches with more than maxOperations (DefaultBatchSize if zero) get 413.
+func (erh EasyResourceHandler) EnableBatch(maxOperations int) error {
+	if maxOperations <= 0 {
+		maxOperations = DefaultBatchSize
+	}
+	return erh.AddAction(CustomAction{
+		Name: "batch",
+		Handler: func(ctx context.Context, writer response.Writer, req *http.Request) {
+			erh.handleBatch(maxOperations, ctx, writer, req)
+		},
+	})
+}
+
+func (erh EasyResourceHandler) handleBatch(maxOperations int, ctx context.Context, writer response.Writer, req *http.Request) {
+	funcName := "handleBatch"
+
+	var batch Batch
+	if err := rw.UnmarshalJson(req.Body, &batch); err != nil {
+		erh.NewError(funcName, err).WithResource(erh.api.Name()).Log()
+		writer.WriteError(err)
+		return
+	}
+	if len(batch.Operations) > maxOperations {
+		writer.WriteError(response.SvcErrorBatchTooLarge.WithDetail(fmt.Sprintf("at most %d operations", maxOperations)))
+		return
+	}
+	if err := erh.validateBatch(batch); err != nil {
+		writer.WriteError(err)
+		return
+	}
+
+	var results []BatchResult
+	var err error
+	if batcher, ok := erh.resource.(BatchHandler); ok {
+		results, err = batcher.Batch(ctx, batch)
+		if err == nil && len(results) != len(batch.Operations) {
+			err = response.SvcErrorInternal.WithError(fmt.Errorf("%d results for %d operations", len(results), len(batch.Operations)))
+		}
+	} else if batch.Atomic {
+		results, err = erh.runAtomicBatch(ctx, req, batch)
+	} else {
+		results = erh.runBatch(ctx, req, batch)
+	}
+	if err != nil {
+		erh.NewError(funcName, err).WithResource(erh.api.Name()).Log()
+		writer.WriteError(err)
+		return
+	}
+	exposed, err := exposeBatchResults(writer, results)
+	if err != nil {
+		erh.NewError(funcName, err).WithResource(erh.api.Name()).Log()
+		writer.WriteError(err)
+		return
+	}
+	writer.WriteJsonResponse(http.StatusMultiStatus, exposed)
+}
+
+// A BatchResult as it is written, with the error exposed the way the writer's error responses would expose it
+type exposedBatchResult struct {
+	Status   int             `json:"status"`
+	Location string          `json:"location,omitempty"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Error    json.RawMessage `json:"error,omitempty"`
+}
+
+type exposedBatchResponse struct {
+	Results []exposedBatchResult `json:"results"`
+}
+
+// Result errors are localized and redacted like the writer's error responses, so wrapped errors aren't leaked
+func exposeBatchResults(writer response.Writer, results []BatchResult) (exposedBatchResponse, error) {
+	exposed := exposedBatchResponse{Results: make([]exposedBatchResult, len(results))}
+	for index, result := range results {
+		exposed.Results[index] = exposedBatchResult{Status: result.Status, Location: result.Location, Body: result.Body}
+		if result.Error == nil {
+			continue
+		}
+		raw, err := writer.MarshalError(result.Error)
+		if err != nil {
+			return exposedBatchResponse{}, err
+		}
+		exposed.Results[index].Error = raw
+	}
+	return exposed, nil
+}
+
+// Operations are checked before any of them are run
+func (erh EasyResourceHandler) validateBatch(batch Batch) response.ServiceError {
+	if len(batch.Operations) == 0 {
+		return response.SvcErrorInvalidBatch.WithDetail("no operations")
+	}
+	if _, batches := erh.resource.(BatchHandler); !batches {
+		if _, transactions := erh.transactor(); batch.Atomic && !transactions {
+			return response.SvcErrorInvalidBatch.WithDetail("atomic batches aren't supported")
+		}
+	}
+	for index, operation := range batch.Operations {
+		switch {
+		case operation.Op != BatchCreate && operation.Op != BatchUpdate && operation.Op != BatchPatch && operation.Op != BatchDelete:
+			return response.SvcErrorInvalidBatch.WithDetail(fmt.Sprintf("operation %d: unknown op %q", index, operation.Op))
+		case operation.Op == BatchCreate && operation.ID != "":
+			return response.SvcErrorInvalidBatch.WithDetail(fmt.Sprintf("operation %d: create can't have an id", index))
+		case operation.Op != BatchCreate && operation.ID == "":
+			return response.SvcErrorInvalidBatch.WithDetail(fmt.Sprintf("operation %d: %s needs an id", index, operation.Op))
+		case operation.ContentType != "" && !isJsonMimeType(operation.ContentType):
+			return response.SvcErrorInvalidBatch.WithDetail(fmt.Sprintf("operation %d: the body can't be %s", index, operation.ContentType))
+		}
+	}
+	return nil
+}
+
+func (erh EasyResourceHandler) runBatch(ctx context.Context, req *http.Request, batch Batch) []BatchResult {
+	results := make([]BatchResult, len(batch.Operations))
+	for index, operation := range batch.Operations {
+		results[index] = erh.runBatchOperation(ctx, req, operation)
+	}
+	return results
+}
+
+// Stops at the first operation that fails, and rolls back the ones before it
+func (erh EasyResourceHandler) runAtomicBatch(ctx context.Context, req *http.Request, batch Batch) ([]BatchResult, error) {
+	transactor, _ := erh.transactor()
+	results := make([]BatchResult, len(batch.Operations))
+	failed := -1
+	err := transactor.InTransaction(ctx, func(ctx context.Context) error {
+		for index, operation := range batch.Operations {
+			results[index] = erh.runBatchOperation(ctx, req, operation)
+			if results[index].Status >= http.StatusBadRequest {
+				failed = index
+				return errBatchOperationFailed
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchOperationFailed) {
+		// e.g. the commit failed
+		return nil, err
+	}
+	if failed >= 0 {
+		for index := range results {
+			switch {
+			case index < failed:
+				results[index] = BatchResult{Status: http.StatusFailedDependency, Error: response.SvcErrorBatchRolledBack.WithDetail("rolled back")}
+			case index > failed:
+				results[index] = BatchResult{Status: http.StatusFailedDependency, Error: response.SvcErrorBatchRolledBack.WithDetail("not attempted")}
+			}
+		}
+	}
+	return results, nil
+}
+
+// Passes the operation to the resource's method as a request of its own
+func (erh EasyResourceHandler) runBatchOperation(ctx context.Context, req *http.Request, operation BatchOperation) BatchResult {
+	var at resweave.ActionType
+	method := http.MethodPost
+	switch operation.Op {
+	case BatchCreate:
+		at = resweave.Create
+	case BatchUpdate:
+		at, method = resweave.Update, http.MethodPut
+	case BatchPatch:
+		at, method = resweave.Update, http.MethodPatch
+	case BatchDelete:
+		at, method = resweave.Delete, http.MethodDelete
+	}
+
+	opCtx := ctx
+	if operation.ID != "" {
+		ids := PathIDsFrom(ctx)
+		opCtx = context.WithValue(opCtx, pathIDsKey{}, append(ids[:len(ids):len(ids)], PathID{Resource: erh.Name(), ID: operation.ID}))
+		opCtx = context.WithValue(opCtx, nestedIDKey{}, operation.ID)
+	}
+
+	opReq := req.Clone(opCtx)
+	opReq.Method = method
+	opReq.URL.Path = strings.TrimSuffix(req.URL.Path, ":batch")
+	opReq.URL.RawPath = ""
+	opReq.Body = io.NopCloser(bytes.NewReader(operation.Body))
+	opReq.ContentLength = int64(len(operation.Body))
+	for _, name := range []string{header.IdempotencyKey, header.IfMatch, header.IfNoneMatch} {
+		opReq.Header.Del(name)
+	}
+	opReq.Header.Set(header.ContentType, header.MimeTypeJson)
+	if operation.ContentType != "" {
+		// e.g. a JSON Patch rather than a merge patch
+		opReq.Header.Set(header.ContentType, operation.ContentType)
+	}
+	opReq.Header.Set(header.Accept, header.MimeTypeJson)
+	if operation.IfMatch != "" {
+		opReq.Header.Set(header.IfMatch, operation.IfMatch)
+	}
+
+	if operation.ID != "" {
+		opReq.URL.Path += "/" + url.PathEscape(operation.ID)
+	}
+
+	recorder := &recordingWriter{ResponseWriter: &discardWriter{header: make(http.Header)}}
+	erh.handleAction(requestAction{at: at}, opCtx, recorder, opReq)
+	return batchResult(recorder)
+}
+
+func batchResult(recorder *recordingWriter) BatchResult {
+	result := BatchResult{Status: recorder.status, Location: recorder.Header().Get(header.Location)}
+	if result.Status == 0 {
+		// nothing was written, which net/http sends as 200
+		result.Status = http.StatusOK
+	}
+	body := recorder.body.Bytes()
+
+	if result.Status >= http.StatusBadRequest {
+		resp := &http.Response{StatusCode: result.Status, Header: recorder.Header(), Body: io.NopCloser(bytes.NewReader(body))}
+		var svcErr response.ServiceError
+		if !errors.As(response.ParseResponse(resp, 0), &svcErr) {
+			svcErr = response.SvcErrorInternal.WithDetail(http.StatusText(result.Status))
+		}
+		result.Error = svcErr
+		return result
+	}
+	if len(body) > 0 && json.Valid(body) {
+		result.Body = body
+	}
+	return result
+}
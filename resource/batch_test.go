@@ -0,0 +1,354 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+	"github.com/mortedecai/resweave"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/text/language"
+)
+
+// keeps names by id
+type ledgerResource struct {
+	resweave.LogHolder
+
+	entries map[string]string
+	next    int
+}
+
+type ledgerEntry struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func (lr *ledgerResource) Create(_ context.Context, writer response.Writer, req *http.Request) {
+	var entry ledgerEntry
+	if err := DecodeAndValidate(req, &entry); err != nil {
+		writer.WriteError(err)
+		return
+	}
+	lr.next++
+	id := strconv.Itoa(lr.next)
+	lr.entries[id] = entry.Name
+	writer.SetLocation("/ledger/"+id).WriteJsonResponse(http.StatusCreated, entry)
+}
+
+func (lr *ledgerResource) Update(id string, _ context.Context, writer response.Writer, req *http.Request) {
+	if _, found := lr.entries[id]; !found {
+		writer.WriteError(ErrNoSuchResource)
+		return
+	}
+	var entry ledgerEntry
+	if err := DecodeAndValidate(req, &entry); err != nil {
+		writer.WriteError(err)
+		return
+	}
+	lr.entries[id] = entry.Name
+	writer.WriteJsonResponse(http.StatusOK, entry)
+}
+
+func (lr *ledgerResource) Delete(id string, _ context.Context, writer response.Writer, _ *http.Request) {
+	if _, found := lr.entries[id]; !found {
+		writer.WriteError(ErrNoSuchResource)
+		return
+	}
+	delete(lr.entries, id)
+	writer.WriteResponse(http.StatusNoContent)
+}
+
+// restores the entries if the transaction is rolled back
+type transactionalLedger struct {
+	ledgerResource
+	rollbacks int
+}
+
+func (tl *transactionalLedger) InTransaction(ctx context.Context, fn func(context.Context) error) error {
+	saved := maps.Clone(tl.entries)
+	if err := fn(ctx); err != nil {
+		tl.entries = saved
+		tl.rollbacks++
+		return err
+	}
+	return nil
+}
+
+// handles batches itself
+type bulkLedger struct {
+	ledgerResource
+	batches []Batch
+	results []BatchResult
+}
+
+func (bl *bulkLedger) Batch(_ context.Context, batch Batch) ([]BatchResult, error) {
+	bl.batches = append(bl.batches, batch)
+	if bl.results != nil {
+		return bl.results, nil
+	}
+	return []BatchResult{{Status: http.StatusCreated}}, nil
+}
+
+var _ = Describe("Batches", func() {
+	var (
+		ledger *ledgerResource
+		post   func(resource EasyResource, body string) *http.Response
+		parse  func(resp *http.Response) []BatchResult
+	)
+	BeforeEach(func() {
+		ledger = &ledgerResource{LogHolder: resweave.NewLogholder("ledger", nil), entries: map[string]string{"1": "rent", "2": "food"}, next: 2}
+		post = func(resource EasyResource, body string) *http.Response {
+			handler := NewResource("ledger", resource)
+			Expect(handler.EnableBatch(4)).To(Succeed())
+			server := resweave.NewServer(8080)
+			Expect(handler.AddEasyResource(server)).To(Succeed())
+			req := httptest.NewRequest(http.MethodPost, "/ledger:batch", strings.NewReader(body))
+			req.Header.Set(header.IdempotencyKey, "not passed on")
+			recorder := httptest.NewRecorder()
+			server.Serve(recorder, req)
+			return recorder.Result()
+		}
+		parse = func(resp *http.Response) []BatchResult {
+			var body BatchResponse
+			Expect(response.ParseResponseJsonData(resp, http.StatusMultiStatus, &body)).To(Succeed())
+			return body.Results
+		}
+	})
+
+	It("should pass each operation to the resource", func() {
+		// Act
+		resp := post(ledger, `{"operations": [
+			{"op": "create", "body": {"name": "fuel"}},
+			{"op": "update", "id": "1", "body": {"name": "mortgage"}},
+			{"op": "delete", "id": "9"},
+			{"op": "delete", "id": "2"}
+		]}`)
+
+		// Assert
+		results := parse(resp)
+		Expect(results).To(HaveLen(4))
+		Expect(results[0].Status).To(Equal(http.StatusCreated))
+		Expect(results[0].Location).To(Equal("/ledger/3"))
+		Expect(results[0].Body).To(MatchJSON(`{"name": "fuel"}`))
+		Expect(results[1].Status).To(Equal(http.StatusOK))
+		Expect(results[2].Status).To(Equal(http.StatusNotFound))
+		Expect(results[2].Error).To(MatchError(response.SvcErrorResourceNotFound))
+		Expect(results[3]).To(Equal(BatchResult{Status: http.StatusNoContent}))
+		Expect(ledger.entries).To(Equal(map[string]string{"1": "mortgage", "3": "fuel"}))
+	})
+
+	It("should validate each operation like a request of its own", func() {
+		// Act
+		resp := post(ledger, `{"operations": [{"op": "create", "body": {}}, {"op": "create", "body": {"name": "fuel"}}]}`)
+
+		// Assert
+		results := parse(resp)
+		Expect(results[0].Status).To(Equal(http.StatusUnprocessableEntity))
+		Expect(results[0].Error).To(MatchError(response.SvcErrorValidationFailed))
+		Expect(results[1].Status).To(Equal(http.StatusCreated))
+	})
+
+	Context("atomic", func() {
+		var transactional *transactionalLedger
+		BeforeEach(func() {
+			transactional = &transactionalLedger{ledgerResource: *ledger}
+		})
+
+		It("should commit when every operation succeeds", func() {
+			// Act
+			resp := post(transactional, `{"atomic": true, "operations": [{"op": "delete", "id": "1"}, {"op": "delete", "id": "2"}]}`)
+
+			// Assert
+			results := parse(resp)
+			Expect(results).To(HaveEach(HaveField("Status", http.StatusNoContent)))
+			Expect(transactional.entries).To(BeEmpty())
+			Expect(transactional.rollbacks).To(BeZero())
+		})
+
+		It("should roll back every operation when one fails", func() {
+			// Act
+			resp := post(transactional, `{"atomic": true, "operations": [
+				{"op": "delete", "id": "1"},
+				{"op": "update", "id": "9", "body": {"name": "fuel"}},
+				{"op": "delete", "id": "2"}
+			]}`)
+
+			// Assert
+			results := parse(resp)
+			Expect(results[0].Status).To(Equal(http.StatusFailedDependency))
+			Expect(results[0].Error).To(MatchError(response.SvcErrorBatchRolledBack))
+			Expect(results[1].Status).To(Equal(http.StatusNotFound))
+			Expect(results[1].Error).To(MatchError(response.SvcErrorResourceNotFound))
+			Expect(results[2].Status).To(Equal(http.StatusFailedDependency))
+			Expect(transactional.entries).To(Equal(map[string]string{"1": "rent", "2": "food"}))
+			Expect(transactional.rollbacks).To(Equal(1))
+		})
+
+		It("should reject atomic batches for resources without transactions", func() {
+			// Act
+			resp := post(ledger, `{"atomic": true, "operations": [{"op": "delete", "id": "1"}]}`)
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(response.ParseResponse(resp, http.StatusMultiStatus)).To(MatchError(response.SvcErrorInvalidBatch))
+			Expect(ledger.entries).To(HaveLen(2))
+		})
+	})
+
+	It("should pass batches to resources that handle them", func() {
+		// Arrange
+		bulk := &bulkLedger{ledgerResource: *ledger}
+
+		// Act
+		resp := post(bulk, `{"atomic": true, "operations": [{"op": "create", "body": {"name": "fuel"}}]}`)
+
+		// Assert
+		Expect(parse(resp)).To(Equal([]BatchResult{{Status: http.StatusCreated}}))
+		Expect(bulk.batches).To(Equal([]Batch{{Atomic: true, Operations: []BatchOperation{{Op: "create", Body: json.RawMessage(`{"name": "fuel"}`)}}}}))
+	})
+
+	It("should reject results from a batch handler that don't match the operations", func() {
+		// Arrange
+		bulk := &bulkLedger{ledgerResource: *ledger, results: []BatchResult{{Status: http.StatusCreated}}}
+
+		// Act
+		resp := post(bulk, `{"operations": [{"op": "create", "body": {"name": "fuel"}}, {"op": "create", "body": {"name": "rent"}}]}`)
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(response.ParseResponse(resp, http.StatusMultiStatus)).To(MatchError(response.SvcErrorInternal))
+	})
+
+	It("should send patches with the operation's content type", func() {
+		// Arrange
+		store := NewMemoryStore(Identity[part, int]{
+			Get: func(p part) int { return p.ID },
+			Set: func(p part, id int) part { p.ID = id; return p },
+		})
+		_, _ = store.Insert(context.TODO(), part{Name: "bolt", Quantity: 10})
+		_, _ = store.Insert(context.TODO(), part{Name: "nut", Quantity: 4})
+		handler := NewStoreResource[part, int]("parts", store)
+		Expect(handler.EnableBatch(0)).To(Succeed())
+		server := resweave.NewServer(8080)
+		Expect(handler.AddEasyResource(server)).To(Succeed())
+		req := httptest.NewRequest(http.MethodPost, "/parts:batch", strings.NewReader(`{"operations": [
+			{"op": "patch", "id": "1", "contentType": "application/json-patch+json", "body": [{"op": "replace", "path": "/quantity", "value": 8}]},
+			{"op": "patch", "id": "2", "body": {"quantity": 3}}
+		]}`))
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.Serve(recorder, req)
+
+		// Assert
+		results := parse(recorder.Result())
+		Expect(results).To(HaveLen(2))
+		Expect(results[0].Status).To(Equal(http.StatusOK))
+		Expect(results[1].Status).To(Equal(http.StatusOK))
+		Expect(store.List(context.TODO())).To(Equal([]part{{ID: 1, Name: "bolt", Quantity: 8}, {ID: 2, Name: "nut", Quantity: 3}}))
+	})
+
+	It("should redact result errors like error responses", func() {
+		// Arrange
+		response.DefaultRedactionPolicy = response.RedactionPolicy{Exposure: response.ExposeCorrelationId, NewCorrelationId: func() string { return "abc123" }}
+		defer func() { response.DefaultRedactionPolicy = response.RedactionPolicy{Exposure: response.ExposeFull} }()
+		secret := errors.New("dial tcp 10.0.0.7:5432: connection refused")
+		bulk := &bulkLedger{ledgerResource: *ledger, results: []BatchResult{
+			{Status: http.StatusInternalServerError, Error: response.SvcErrorInternal.WithError(secret)},
+			{Status: http.StatusCreated},
+		}}
+
+		// Act
+		resp := post(bulk, `{"operations": [{"op": "create", "body": {"name": "fuel"}}, {"op": "create", "body": {"name": "rent"}}]}`)
+
+		// Assert
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).ToNot(ContainSubstring("connection refused"))
+		var results struct {
+			Results []struct {
+				Status int                        `json:"status"`
+				Error  map[string]json.RawMessage `json:"error"`
+			} `json:"results"`
+		}
+		Expect(json.Unmarshal(body, &results)).To(Succeed())
+		Expect(results.Results).To(HaveLen(2))
+		Expect(results.Results[0].Status).To(Equal(http.StatusInternalServerError))
+		Expect(results.Results[0].Error).To(HaveKeyWithValue("correlationId", json.RawMessage(`"abc123"`)))
+		Expect(results.Results[1].Error).To(BeNil())
+	})
+
+	It("should only add the language headers once for all of the result errors", func() {
+		// Arrange
+		catalog := response.NewCatalog(language.English)
+		Expect(catalog.Add(language.French, "10502", "ressource introuvable")).To(Succeed())
+		response.DefaultCatalog = catalog
+		defer func() { response.DefaultCatalog = nil }()
+
+		handler := NewResource("ledger", ledger)
+		Expect(handler.EnableBatch(4)).To(Succeed())
+		server := resweave.NewServer(8080)
+		Expect(handler.AddEasyResource(server)).To(Succeed())
+		req := httptest.NewRequest(http.MethodPost, "/ledger:batch", strings.NewReader(`{"operations": [{"op": "delete", "id": "8"}, {"op": "delete", "id": "9"}]}`))
+		req.Header.Set(header.AcceptLanguage, "fr")
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.Serve(recorder, req)
+
+		// Assert
+		resp := recorder.Result()
+		Expect(resp.Header.Values(header.Vary)).To(Equal([]string{header.AcceptLanguage}))
+		Expect(resp.Header.Values(header.ContentLanguage)).To(Equal([]string{"fr"}))
+		results := parse(resp)
+		Expect(results).To(HaveLen(2))
+		for _, result := range results {
+			Expect(result.Error).To(MatchError(response.SvcErrorResourceNotFound))
+			Expect(result.Error.Error()).To(ContainSubstring("ressource introuvable"))
+		}
+	})
+
+	DescribeTable("should reject invalid batches",
+		func(body string, expectStatus int, expectErr error) {
+			// Act
+			resp := post(ledger, body)
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(expectStatus))
+			Expect(response.ParseResponse(resp, http.StatusMultiStatus)).To(MatchError(expectErr))
+			Expect(ledger.entries).To(HaveLen(2))
+		},
+		Entry("that isn't json", `[`, http.StatusBadRequest, response.SvcErrorJsonUnmarshalFailed),
+		Entry("without operations", `{"operations": []}`, http.StatusBadRequest, response.SvcErrorInvalidBatch),
+		Entry("with an unknown op", `{"operations": [{"op": "upsert", "id": "1"}]}`, http.StatusBadRequest, response.SvcErrorInvalidBatch),
+		Entry("with a create that has an id", `{"operations": [{"op": "create", "id": "1"}]}`, http.StatusBadRequest, response.SvcErrorInvalidBatch),
+		Entry("with a delete without an id", `{"operations": [{"op": "delete"}]}`, http.StatusBadRequest, response.SvcErrorInvalidBatch),
+		Entry("with a body that isn't json", `{"operations": [{"op": "create", "contentType": "text/plain", "body": "fuel"}]}`, http.StatusBadRequest, response.SvcErrorInvalidBatch),
+		Entry("that is too large", `{"operations": [{"op": "delete", "id": "1"}, {"op": "delete", "id": "1"}, {"op": "delete", "id": "1"}, {"op": "delete", "id": "1"}, {"op": "delete", "id": "1"}]}`,
+			http.StatusRequestEntityTooLarge, response.SvcErrorBatchTooLarge),
+	)
+
+	It("should round trip results", func() {
+		// Arrange
+		result := BatchResult{Status: http.StatusNotFound, Error: response.SvcErrorResourceNotFound.WithDetail("9")}
+
+		// Act
+		raw, err := json.Marshal(result)
+		Expect(err).ToNot(HaveOccurred())
+		var parsed BatchResult
+		Expect(rw.UnmarshalJson(strings.NewReader(string(raw)), &parsed)).To(Succeed())
+
+		// Assert
+		Expect(parsed.Status).To(Equal(http.StatusNotFound))
+		Expect(parsed.Error).To(MatchError(response.SvcErrorResourceNotFound))
+	})
+})
@@ -0,0 +1,148 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A store that keeps entities in memory and writes them to a JSON file (an array, in insertion order) after every
+// change, so that they survive restarts.  It's meant for prototypes and small services: the whole file is
+// rewritten each time.
+//
+// The file is replaced atomically, so it is never left half-written.  A change that can't be written is undone and
+// ErrStoreFailed is returned.
+type FileStore[T any, ID ResourceID] struct {
+	memory *MemoryStore[T, ID]
+	path   string
+	mtx    sync.Mutex // serializes changes so that the file matches the memory store
+}
+
+// Open (or start) a file store; the file is created when the first entity is inserted.
+func NewFileStore[T any, ID ResourceID](path string, identity Identity[T, ID]) (*FileStore[T, ID], error) {
+	store := &FileStore[T, ID]{memory: NewMemoryStore(identity), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrStoreFailed, err)
+	}
+	var entities []T
+	if err = json.Unmarshal(data, &entities); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrStoreFailed, path, err)
+	}
+	for _, entity := range entities {
+		store.memory.put(entity)
+	}
+	return store, nil
+}
+
+func (s *FileStore[T, ID]) IDOf(entity T) ID {
+	return s.memory.IDOf(entity)
+}
+
+func (s *FileStore[T, ID]) Insert(ctx context.Context, entity T) (T, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	inserted, err := s.memory.Insert(ctx, entity)
+	if err != nil {
+		return inserted, err
+	}
+	if err = s.save(); err != nil {
+		_ = s.memory.Delete(ctx, s.IDOf(inserted))
+		var zero T
+		return zero, err
+	}
+	return inserted, nil
+}
+
+func (s *FileStore[T, ID]) List(ctx context.Context) ([]T, error) {
+	return s.memory.List(ctx)
+}
+
+func (s *FileStore[T, ID]) Get(ctx context.Context, id ID) (T, error) {
+	return s.memory.Get(ctx, id)
+}
+
+func (s *FileStore[T, ID]) Replace(ctx context.Context, id ID, entity T) (T, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	previous, err := s.memory.Get(ctx, id)
+	if err != nil {
+		return previous, err
+	}
+	replaced, err := s.memory.Replace(ctx, id, entity)
+	if err != nil {
+		return replaced, err
+	}
+	if err = s.save(); err != nil {
+		_, _ = s.memory.Replace(ctx, id, previous)
+		var zero T
+		return zero, err
+	}
+	return replaced, nil
+}
+
+func (s *FileStore[T, ID]) Delete(ctx context.Context, id ID) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.memory.mtx.Lock()
+	defer s.memory.mtx.Unlock()
+
+	index := -1
+	for i, other := range s.memory.order {
+		if other == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		return noSuchResource(id)
+	}
+	previous := s.memory.entities[id]
+	s.memory.remove(id)
+	if err := s.saveLocked(); err != nil {
+		// put it back where it was
+		s.memory.entities[id] = previous
+		s.memory.order = append(s.memory.order[:index], append([]ID{id}, s.memory.order[index:]...)...)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore[T, ID]) save() error {
+	s.memory.mtx.RLock()
+	defer s.memory.mtx.RUnlock()
+	return s.saveLocked()
+}
+
+// writes a temporary file and renames it over the store's file; the memory store must be locked
+func (s *FileStore[T, ID]) saveLocked() error {
+	data, err := json.MarshalIndent(s.memory.list(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrStoreFailed, err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrStoreFailed, err)
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrStoreFailed, err)
+	}
+	return nil
+}
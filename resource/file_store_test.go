@@ -0,0 +1,101 @@
+package resource
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileStore", func() {
+	var (
+		ctx  context.Context
+		path string
+	)
+	BeforeEach(func() {
+		ctx = context.TODO()
+		path = filepath.Join(GinkgoT().TempDir(), "widgets.json")
+	})
+
+	It("should start empty when there is no file", func() {
+		// Act
+		store, err := NewFileStore(path, widgetIdentity)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.List(ctx)).To(BeEmpty())
+		Expect(path).ToNot(BeAnExistingFile())
+	})
+
+	It("should keep entities across restarts", func() {
+		// Arrange
+		store, err := NewFileStore(path, widgetIdentity)
+		Expect(err).ToNot(HaveOccurred())
+		for _, name := range []string{"sprocket", "gear", "cog"} {
+			_, err = store.Insert(ctx, widget{Name: name})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err = store.Replace(ctx, 1, widget{Name: "flange"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(store.Delete(ctx, 2)).To(Succeed())
+
+		// Act
+		reopened, err := NewFileStore(path, widgetIdentity)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reopened.List(ctx)).To(Equal([]widget{{ID: 1, Name: "flange"}, {ID: 3, Name: "cog"}}))
+		created, err := reopened.Insert(ctx, widget{Name: "gear"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(created.ID).To(Equal(4))
+	})
+
+	It("should write the entities as a JSON array", func() {
+		// Arrange
+		store, _ := NewFileStore(path, widgetIdentity)
+
+		// Act
+		_, err := store.Insert(ctx, widget{Name: "cog"})
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.ReadFile(path)).To(MatchJSON(`[{"id":1,"name":"cog"}]`))
+	})
+
+	It("should fail to open a file that isn't a JSON array", func() {
+		// Arrange
+		Expect(os.WriteFile(path, []byte(`{"id":1}`), 0o600)).To(Succeed())
+
+		// Act
+		_, err := NewFileStore(path, widgetIdentity)
+
+		// Assert
+		Expect(err).To(MatchError(ErrStoreFailed))
+	})
+
+	It("should undo changes that can't be written", func() {
+		// Arrange
+		store, _ := NewFileStore(path, widgetIdentity)
+		_, _ = store.Insert(ctx, widget{Name: "sprocket"})
+		_, _ = store.Insert(ctx, widget{Name: "gear"})
+		// the store's directory no longer exists, so nothing can be written
+		store.path = filepath.Join(GinkgoT().TempDir(), "missing", "widgets.json")
+
+		// Act & Assert
+		_, err := store.Insert(ctx, widget{Name: "cog"})
+		Expect(err).To(MatchError(ErrStoreFailed))
+		_, err = store.Replace(ctx, 1, widget{Name: "flange"})
+		Expect(err).To(MatchError(ErrStoreFailed))
+		Expect(store.Delete(ctx, 1)).To(MatchError(ErrStoreFailed))
+		Expect(store.List(ctx)).To(Equal([]widget{{ID: 1, Name: "sprocket"}, {ID: 2, Name: "gear"}}))
+	})
+
+	It("should report unknown ids", func() {
+		store, _ := NewFileStore(path, widgetIdentity)
+		_, err := store.Get(ctx, 1)
+		Expect(err).To(MatchError(ErrNoSuchResource))
+		Expect(store.Delete(ctx, 1)).To(MatchError(ErrNoSuchResource))
+	})
+})
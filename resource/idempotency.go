@@ -0,0 +1,293 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+)
+
+// How long responses are kept for replay unless SetIdempotency says otherwise
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// A response stored for replay
+type StoredResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// What an IdempotencyStore knows about a key
+type IdempotencyRecord struct {
+	Fingerprint string // identifies the request body, so that a key can't be reused for a different request
+	Completed   bool   // false while the first request is still in flight
+	Response    StoredResponse
+}
+
+// Keeps the responses of requests with an Idempotency-Key (see SetIdempotency); implementations must be safe to use
+// concurrently, e.g. by using an atomic insert.
+type IdempotencyStore interface {
+	// Claim a key for a request; if the key is already known (and hasn't expired) its record is returned instead.
+	Begin(ctx context.Context, key string, fingerprint string, ttl time.Duration) (IdempotencyRecord, bool, error)
+	// Store the response for a claimed key, which is kept until the ttl passed to Begin expires.
+	Complete(ctx context.Context, key string, response StoredResponse) error
+	// Forget a claimed key without storing a response, so that the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// Identifies the caller, so that different callers can use the same keys; see SetIdempotencyCaller.
+//
+// Return "" for callers that can't be identified (e.g. anonymous ones); their keys are ignored, since one caller's
+// response would otherwise be replayed to any other caller that used the same key.
+type CallerFunc func(*http.Request) string
+
+// The default caller: a hash of the Authorization header, so that credentials aren't stored; "" without one
+func AuthorizationCaller(req *http.Request) string {
+	authorization := req.Header.Get(header.Authorization)
+	if authorization == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(authorization))
+	return hex.EncodeToString(sum[:])
+}
+
+type idempotencyOptions struct {
+	store  IdempotencyStore
+	ttl    time.Duration
+	caller CallerFunc
+}
+
+// Make Create requests with an Idempotency-Key header safe to retry: the first response for a key is stored for ttl
+// (DefaultIdempotencyTTL if zero) and replayed, with the Idempotent-Replayed header, for requests with the same key
+// and body.  Keys are scoped by resource (including the ids of its ancestors, for children) and caller (see SetIdempotencyCaller); requests from callers that can't be
+// identified are passed to Create as if they had no key.
+//
+// A request whose key is still in flight gets 409 (Conflict), and a key that is reused with a different body gets
+// 422 (Unprocessable Entity).  Server errors (5xx) aren't stored, so those requests can be retried.
+//
+// A nil store turns it off.
+func (erh EasyResourceHandler) SetIdempotency(store IdempotencyStore, ttl time.Duration) {
+	if store == nil {
+		erh.options.idempotency = nil
+		return
+	}
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	caller := CallerFunc(AuthorizationCaller)
+	if erh.options.idempotency != nil {
+		caller = erh.options.idempotency.caller
+	}
+	erh.options.idempotency = &idempotencyOptions{store: store, ttl: ttl, caller: caller}
+}
+
+// Change how callers are identified for idempotency (see SetIdempotency), e.g. by user id; call after SetIdempotency.
+func (erh EasyResourceHandler) SetIdempotencyCaller(caller CallerFunc) {
+	if erh.options.idempotency != nil && caller != nil {
+		erh.options.idempotency.caller = caller
+	}
+}
+
+// Calls Create and stores its response, unless the key has already been seen
+func (erh EasyResourceHandler) createIdempotently(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	funcName := "createIdempotently"
+	options := erh.options.idempotency
+	writer := response.NewWriter(w).WithRequest(r)
+
+	caller := options.caller(r)
+	if caller == "" {
+		// anonymous callers would share keys, and so each other's responses
+		erh.NewInfo(funcName, "ignoring the idempotency key of an unidentified caller").WithResource(erh.api.Name()).Log()
+		erh.resource.(easyCreator).Create(ctx, writer, r)
+		return
+	}
+
+	body, err := rw.ReadAll(r.Body)
+	if err != nil {
+		writer.WriteError(response.SvcErrorReadRequestFailed.WithError(err))
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(body)
+	fingerprint := hex.EncodeToString(sum[:])
+	key := erh.idempotencyScope(ctx) + "\x00" + caller + "\x00" + r.Header.Get(header.IdempotencyKey)
+
+	record, found, err := options.store.Begin(ctx, key, fingerprint, options.ttl)
+	switch {
+	case err != nil:
+		erh.NewError(funcName, err).WithResource(erh.api.Name()).Log()
+		writer.WriteError(err)
+		return
+	case found && record.Fingerprint != fingerprint:
+		writer.WriteError(response.SvcErrorIdempotencyKeyReused)
+		return
+	case found && !record.Completed:
+		writer.WriteError(response.SvcErrorRequestInProgress)
+		return
+	case found:
+		replay(w, record.Response)
+		return
+	}
+
+	recorder := &recordingWriter{ResponseWriter: w}
+	completed := false
+	defer func() {
+		// release the key if the request failed, or panicked, so that it can be retried
+		if !completed {
+			if err := options.store.Release(context.WithoutCancel(ctx), key); err != nil {
+				erh.NewError(funcName, err).WithResource(erh.api.Name()).Log()
+			}
+		}
+	}()
+
+	erh.resource.(easyCreator).Create(ctx, response.NewWriter(recorder).WithRequest(r), r)
+
+	if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+		return
+	}
+	stored := StoredResponse{Status: recorder.status, Header: w.Header().Clone(), Body: recorder.body.Bytes()}
+	if err = options.store.Complete(context.WithoutCancel(ctx), key, stored); err != nil {
+		erh.NewError(funcName, err).WithResource(erh.api.Name()).Log()
+		return
+	}
+	completed = true
+}
+
+// Keys are scoped by the resource and the ids of its ancestors, so that the same create under two parents (e.g.
+// /orgs/1/projects and /orgs/2/projects) isn't a replay
+func (erh EasyResourceHandler) idempotencyScope(ctx context.Context) string {
+	var scope strings.Builder
+	for _, id := range PathIDsFrom(ctx) {
+		scope.WriteString(string(id.Resource) + "/" + url.PathEscape(id.ID) + "/")
+	}
+	scope.WriteString(string(erh.api.Name()))
+	return scope.String()
+}
+
+func replay(w http.ResponseWriter, stored StoredResponse) {
+	w.Header().Set(header.IdempotentReplayed, "true")
+	writeStored(w, stored)
+}
+
+func writeStored(w http.ResponseWriter, stored StoredResponse) {
+	headers := w.Header()
+	for name, values := range stored.Header {
+		headers[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(stored.Status)
+	_, _ = w.Write(stored.Body)
+}
+
+// Keeps a copy of the status and body that are written
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// An IdempotencyStore that keeps records in memory, for single-instance services and tests
+type MemoryIdempotencyStore struct {
+	mtx       sync.Mutex
+	records   map[string]*memoryIdempotencyRecord
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryIdempotencyRecord struct {
+	IdempotencyRecord
+	ttl     time.Duration
+	expires time.Time
+}
+
+// expired records are removed at most this often
+const idempotencySweepInterval = time.Minute
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]*memoryIdempotencyRecord), now: time.Now}
+}
+
+func (s *MemoryIdempotencyStore) Begin(_ context.Context, key string, fingerprint string, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := s.now()
+	s.sweep(now)
+
+	if record, found := s.records[key]; found && now.Before(record.expires) {
+		return record.IdempotencyRecord, true, nil
+	}
+	s.records[key] = &memoryIdempotencyRecord{
+		IdempotencyRecord: IdempotencyRecord{Fingerprint: fingerprint},
+		ttl:               ttl,
+		expires:           now.Add(ttl),
+	}
+	return IdempotencyRecord{}, false, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, response StoredResponse) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	record, found := s.records[key]
+	if !found {
+		return errors.New("idempotency key was not claimed")
+	}
+	record.Completed = true
+	record.Response = response
+	record.expires = s.now().Add(record.ttl)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// must be called with the lock held
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < idempotencySweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, record := range s.records {
+		if !now.Before(record.expires) {
+			delete(s.records, key)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package resource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+	"github.com/mortedecai/resweave"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// creates orders, counting how many it has created
+type orderResource struct {
+	resweave.LogHolder
+
+	created atomic.Int32
+	fail    bool
+	hold    chan struct{} // blocks Create until closed, if set
+}
+
+func (or *orderResource) Create(_ context.Context, writer response.Writer, req *http.Request) {
+	if or.hold != nil {
+		<-or.hold
+	}
+	if or.fail {
+		writer.WriteError(response.SvcErrorInternal)
+		return
+	}
+	var order map[string]interface{}
+	if err := rw.UnmarshalJson(req.Body, &order); err != nil {
+		writer.WriteError(err)
+		return
+	}
+	order["id"] = or.created.Add(1)
+	writer.SetLocation("/orders/1").WriteJsonResponse(http.StatusCreated, order)
+}
+
+var _ = Describe("Idempotency", func() {
+	var (
+		resource *orderResource
+		handler  *EasyResourceHandler
+		store    *MemoryIdempotencyStore
+		post     func(key string, body string, authorization string) *http.Response
+	)
+	BeforeEach(func() {
+		resource = &orderResource{LogHolder: resweave.NewLogholder("orders", nil)}
+		handler = NewResource("orders", resource)
+		store = NewMemoryIdempotencyStore()
+		handler.SetIdempotency(store, time.Hour)
+		post = func(key string, body string, authorization string) *http.Response {
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+			if key != "" {
+				req.Header.Set(header.IdempotencyKey, key)
+			}
+			if authorization != "" {
+				req.Header.Set(header.Authorization, authorization)
+			}
+			recorder := httptest.NewRecorder()
+			handler.handleResourceAction(resweave.Create, context.TODO(), recorder, req)
+			return recorder.Result()
+		}
+	})
+
+	It("should replay the response to a repeated request", func() {
+		// Arrange
+		first := post("abc", `{"item":"cog"}`, "Bearer me")
+
+		// Act
+		second := post("abc", `{"item":"cog"}`, "Bearer me")
+
+		// Assert
+		Expect(resource.created.Load()).To(BeEquivalentTo(1))
+		Expect(second.StatusCode).To(Equal(http.StatusCreated))
+		Expect(second.Header.Get(header.Location)).To(Equal("/orders/1"))
+		Expect(second.Header.Get(header.ContentType)).To(Equal(header.MimeTypeJson))
+		Expect(second.Header.Get(header.IdempotentReplayed)).To(Equal("true"))
+		Expect(first.Header.Get(header.IdempotentReplayed)).To(BeEmpty())
+		firstBody, _ := response.ParseResponseBinaryData(first, http.StatusCreated)
+		secondBody, _ := response.ParseResponseBinaryData(second, http.StatusCreated)
+		Expect(secondBody).To(MatchJSON(firstBody))
+	})
+
+	It("should create again without a key, or with a different key or caller", func() {
+		post("abc", `{"item":"cog"}`, "Bearer me")
+		post("", `{"item":"cog"}`, "Bearer me")
+		post("def", `{"item":"cog"}`, "Bearer me")
+		post("abc", `{"item":"cog"}`, "Bearer someone-else")
+		Expect(resource.created.Load()).To(BeEquivalentTo(4))
+	})
+
+	It("should not replay responses to anonymous callers", func() {
+		// Act
+		post("abc", `{"item":"cog"}`, "")
+		resp := post("abc", `{"item":"cog"}`, "")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		Expect(resp.Header.Get(header.IdempotentReplayed)).To(BeEmpty())
+		Expect(resource.created.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("should scope keys by the ids of the resource's ancestors", func() {
+		// Arrange
+		orgs := NewResource("orgs", newNodeResource("orgs", "1", "2"))
+		orgs.AddChild(handler)
+		server := resweave.NewServer(8080)
+		Expect(orgs.AddEasyResource(server)).To(Succeed())
+		post := func(path string) *http.Response {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"item":"cog"}`))
+			req.Header.Set(header.IdempotencyKey, "abc")
+			req.Header.Set(header.Authorization, "Bearer me")
+			recorder := httptest.NewRecorder()
+			server.Serve(recorder, req)
+			return recorder.Result()
+		}
+
+		// Act
+		first := post("/orgs/1/orders")
+		second := post("/orgs/2/orders")
+		third := post("/orgs/2/orders")
+
+		// Assert
+		Expect(first.StatusCode).To(Equal(http.StatusCreated))
+		Expect(second.StatusCode).To(Equal(http.StatusCreated))
+		Expect(second.Header.Get(header.IdempotentReplayed)).To(BeEmpty())
+		Expect(third.Header.Get(header.IdempotentReplayed)).To(Equal("true"))
+		Expect(resource.created.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("should identify callers with the caller func", func() {
+		// Arrange
+		handler.SetIdempotencyCaller(func(*http.Request) string { return "everyone" })
+
+		// Act
+		post("abc", `{"item":"cog"}`, "Bearer someone")
+		resp := post("abc", `{"item":"cog"}`, "Bearer someone-else")
+
+		// Assert
+		Expect(resp.Header.Get(header.IdempotentReplayed)).To(Equal("true"))
+		Expect(resource.created.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should reject a key that is reused with a different body", func() {
+		// Arrange
+		post("abc", `{"item":"cog"}`, "Bearer me")
+
+		// Act
+		resp := post("abc", `{"item":"gear"}`, "Bearer me")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusUnprocessableEntity))
+		Expect(response.ParseResponse(resp, http.StatusCreated)).To(MatchError(response.SvcErrorIdempotencyKeyReused))
+		Expect(resource.created.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should reject a repeated request while the first is in flight", func() {
+		// Arrange
+		resource.hold = make(chan struct{})
+		done := make(chan *http.Response)
+		go func() {
+			defer GinkgoRecover()
+			done <- post("abc", `{"item":"cog"}`, "Bearer me")
+		}()
+		Eventually(func() int {
+			store.mtx.Lock()
+			defer store.mtx.Unlock()
+			return len(store.records)
+		}).Should(Equal(1))
+
+		// Act
+		resp := post("abc", `{"item":"cog"}`, "Bearer me")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+		Expect(response.ParseResponse(resp, http.StatusCreated)).To(MatchError(response.SvcErrorRequestInProgress))
+		close(resource.hold)
+		Expect((<-done).StatusCode).To(Equal(http.StatusCreated))
+	})
+
+	It("should not store server errors", func() {
+		// Arrange
+		resource.fail = true
+		Expect(post("abc", `{"item":"cog"}`, "Bearer me").StatusCode).To(Equal(http.StatusInternalServerError))
+		resource.fail = false
+
+		// Act
+		resp := post("abc", `{"item":"cog"}`, "Bearer me")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		Expect(resp.Header.Get(header.IdempotentReplayed)).To(BeEmpty())
+	})
+
+	It("should release the key if Create panics", func() {
+		// Arrange
+		handler = NewResource("orders", &panickingCreator{LogHolder: resweave.NewLogholder("orders", nil)})
+		handler.SetIdempotency(store, 0)
+
+		// Act & Assert
+		Expect(func() { post("abc", `{}`, "Bearer me") }).To(Panic())
+		Expect(store.records).To(BeEmpty())
+	})
+
+	It("should be turned off with a nil store", func() {
+		handler.SetIdempotency(nil, 0)
+		post("abc", `{"item":"cog"}`, "Bearer me")
+		post("abc", `{"item":"cog"}`, "Bearer me")
+		Expect(resource.created.Load()).To(BeEquivalentTo(2))
+	})
+
+	Context("MemoryIdempotencyStore", func() {
+		It("should forget keys after their ttl", func() {
+			// Arrange
+			now := time.Now()
+			store.now = func() time.Time { return now }
+			ctx := context.TODO()
+			_, found, _ := store.Begin(ctx, "abc", "print", time.Minute)
+			Expect(found).To(BeFalse())
+			Expect(store.Complete(ctx, "abc", StoredResponse{Status: http.StatusCreated})).To(Succeed())
+
+			// Act & Assert
+			now = now.Add(59 * time.Second)
+			record, found, _ := store.Begin(ctx, "abc", "print", time.Minute)
+			Expect(found).To(BeTrue())
+			Expect(record).To(Equal(IdempotencyRecord{Fingerprint: "print", Completed: true, Response: StoredResponse{Status: http.StatusCreated}}))
+
+			now = now.Add(time.Second)
+			_, found, _ = store.Begin(ctx, "abc", "print", time.Minute)
+			Expect(found).To(BeFalse())
+		})
+
+		It("should remove expired keys", func() {
+			// Arrange
+			now := time.Now()
+			store.now = func() time.Time { return now }
+			ctx := context.TODO()
+			_, _, _ = store.Begin(ctx, "abc", "print", time.Second)
+
+			// Act
+			now = now.Add(2 * idempotencySweepInterval)
+			_, _, _ = store.Begin(ctx, "def", "print", time.Second)
+
+			// Assert
+			Expect(store.records).To(HaveLen(1))
+			Expect(store.records).To(HaveKey("def"))
+		})
+
+		It("should only complete claimed keys", func() {
+			Expect(store.Complete(context.TODO(), "abc", StoredResponse{})).ToNot(Succeed())
+		})
+	})
+})
+
+type panickingCreator struct {
+	resweave.LogHolder
+}
+
+func (pc *panickingCreator) Create(context.Context, response.Writer, *http.Request) {
+	panic("oops")
+}
@@ -0,0 +1,328 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrPatchFailed = errors.New("patch could not be applied")
+)
+
+// One operation of a JSON Patch document; Value is kept raw so that a missing value can be told apart from null
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply a JSON Patch (RFC 6902) to a JSON document, e.g.
+//
+//	[
+//	  {"op": "test", "path": "/version", "value": 3},
+//	  {"op": "replace", "path": "/name", "value": "cog"},
+//	  {"op": "add", "path": "/tags/-", "value": "metal"},
+//	  {"op": "remove", "path": "/notes"}
+//	]
+//
+// The operations are applied in order, and the patch is all or nothing: if any operation fails the document is
+// left as it was.  A patch that isn't valid returns ErrInvalidPatch; operations that can't be applied to the
+// document (e.g. a path that doesn't exist, or a failed test) return ErrPatchFailed.
+func JsonPatch(document []byte, patch []byte) ([]byte, error) {
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+	var target interface{}
+	if err := unmarshalJsonValue(document, &target); err != nil {
+		return nil, fmt.Errorf("%w: document: %w", ErrInvalidPatch, err)
+	}
+
+	for index, operation := range operations {
+		var err error
+		if target, err = operation.apply(target); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", index, operation.Op, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func (o jsonPatchOperation) apply(document interface{}) (interface{}, error) {
+	if o.Path == nil {
+		return nil, fmt.Errorf("%w: missing path", ErrInvalidPatch)
+	}
+	path, err := parsePointer(*o.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Op {
+	case "add", "replace", "test":
+		value, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		switch o.Op {
+		case "add":
+			return addValue(document, path, value)
+		case "replace":
+			return replaceValue(document, path, value)
+		}
+		current, err := getValue(document, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, value) {
+			return nil, fmt.Errorf("%w: test failed at %q", ErrPatchFailed, *o.Path)
+		}
+		return document, nil
+	case "remove":
+		document, _, err = removeValue(document, path)
+		return document, err
+	case "move", "copy":
+		if o.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidPatch)
+		}
+		from, err := parsePointer(*o.From)
+		if err != nil {
+			return nil, err
+		}
+		if o.Op == "copy" {
+			value, err := getValue(document, from)
+			if err != nil {
+				return nil, err
+			}
+			return addValue(document, path, copyValue(value))
+		}
+		if len(from) < len(path) && isPrefix(from, path) {
+			return nil, fmt.Errorf("%w: can't move %q into itself", ErrPatchFailed, *o.From)
+		}
+		document, value, err := removeValue(document, from)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(document, path, value)
+	}
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, o.Op)
+}
+
+func (o jsonPatchOperation) value() (interface{}, error) {
+	if len(o.Value) == 0 {
+		return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+	}
+	var value interface{}
+	if err := unmarshalJsonValue(o.Value, &value); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+	return value, nil
+}
+
+// Splits a JSON Pointer (RFC 6901) into its reference tokens; the empty pointer refers to the whole document
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid path %q", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for index, token := range tokens {
+		tokens[index] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix []string, tokens []string) bool {
+	for index := range prefix {
+		if prefix[index] != tokens[index] {
+			return false
+		}
+	}
+	return true
+}
+
+func getValue(document interface{}, path []string) (interface{}, error) {
+	value := document
+	for _, token := range path {
+		switch container := value.(type) {
+		case map[string]interface{}:
+			child, found := container[token]
+			if !found {
+				return nil, fmt.Errorf("%w: %q not found", ErrPatchFailed, token)
+			}
+			value = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			value = container[index]
+		default:
+			return nil, fmt.Errorf("%w: %q not found", ErrPatchFailed, token)
+		}
+	}
+	return value, nil
+}
+
+// Changes the value at the end of the path; returns the (possibly new) document
+func updateValue(document interface{}, path []string, update func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(document, path[0])
+	}
+	child, err := getValue(document, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = updateValue(child, path[1:], update); err != nil {
+		return nil, err
+	}
+	// arrays may have been reallocated, so put the child back
+	switch container := document.(type) {
+	case map[string]interface{}:
+		container[path[0]] = child
+	case []interface{}:
+		index, _ := arrayIndex(path[0], len(container)-1)
+		container[index] = child
+	}
+	return document, nil
+}
+
+func addValue(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateValue(document, path, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			if token == "-" {
+				return append(container, value), nil
+			}
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:index], append([]interface{}{value}, container[index:]...)...), nil
+		}
+		return nil, fmt.Errorf("%w: can't add %q to a value that isn't an object or array", ErrPatchFailed, token)
+	})
+}
+
+func replaceValue(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	if _, err := getValue(document, path); err != nil {
+		return nil, err
+	}
+	return updateValue(document, path, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[token] = value
+		case []interface{}:
+			index, _ := arrayIndex(token, len(container)-1)
+			container[index] = value
+		}
+		return container, nil
+	})
+}
+
+// Returns the document and the removed value
+func removeValue(document interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: can't remove the whole document", ErrPatchFailed)
+	}
+	removed, err := getValue(document, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	document, err = updateValue(document, path, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			index, _ := arrayIndex(token, len(container)-1)
+			return append(container[:index], container[index+1:]...), nil
+		}
+		return container, nil
+	})
+	return document, removed, err
+}
+
+// Parses an array index, which can't have leading zeros or be more than max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrPatchFailed, token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index > max {
+		return 0, fmt.Errorf("%w: array index %q out of range", ErrPatchFailed, token)
+	}
+	return index, nil
+}
+
+func copyValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for name, child := range value {
+			copied[name] = copyValue(child)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for index, child := range value {
+			copied[index] = copyValue(child)
+		}
+		return copied
+	}
+	return value
+}
+
+// Compares JSON values; numbers are equal if their values are, e.g. 1 and 1.0
+func jsonEqual(a interface{}, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		other, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(other) {
+			return false
+		}
+		for name, child := range a {
+			otherChild, found := other[name]
+			if !found || !jsonEqual(child, otherChild) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		other, ok := b.([]interface{})
+		if !ok || len(a) != len(other) {
+			return false
+		}
+		for index := range a {
+			if !jsonEqual(a[index], other[index]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		other, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if a == other {
+			return true
+		}
+		x, xerr := a.Float64()
+		y, yerr := other.Float64()
+		return xerr == nil && yerr == nil && x == y
+	}
+	return a == b
+}
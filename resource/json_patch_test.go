@@ -0,0 +1,88 @@
+package resource
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JsonPatch", func() {
+	// mostly examples from RFC 6902, appendix A
+	DescribeTable("should apply patches",
+		func(document string, patch string, expected string) {
+			// Act
+			patched, err := JsonPatch([]byte(document), []byte(patch))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(patched).To(MatchJSON(expected))
+		},
+		Entry("adding an object member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`),
+		Entry("adding an array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`),
+		Entry("appending to an array", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`),
+		Entry("adding to the end of an array", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/1","value":"baz"}]`, `{"foo":["bar","baz"]}`),
+		Entry("adding a nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`),
+		Entry("adding null", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":null}]`, `{"foo":"bar","baz":null}`),
+		Entry("replacing the document", `{"foo":"bar"}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`),
+		Entry("removing an object member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`),
+		Entry("removing an array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`),
+		Entry("replacing a value", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`),
+		Entry("moving a value",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`),
+		Entry("moving an array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`),
+		Entry("copying a value", `{"foo":{"bar":[1]}}`, `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"add","path":"/baz/bar/-","value":2}]`, `{"foo":{"bar":[1]},"baz":{"bar":[1,2]}}`),
+		Entry("testing values", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`),
+		Entry("testing numbers by value", `{"n":1}`, `[{"op":"test","path":"/n","value":1.0}]`, `{"n":1}`),
+		Entry("escaping paths", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"replace","path":"/~1","value":1}]`, `{"/":1,"~1":10}`),
+		Entry("ignoring unknown members", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`, `{"foo":"bar","baz":"qux"}`),
+	)
+
+	DescribeTable("should fail patches that can't be applied",
+		func(patch string) {
+			// Act
+			_, err := JsonPatch([]byte(`{"foo":"bar","list":[1,2]}`), []byte(patch))
+
+			// Assert
+			Expect(err).To(MatchError(ErrPatchFailed))
+		},
+		Entry("when a test fails", `[{"op":"test","path":"/foo","value":"baz"}]`),
+		Entry("when adding to a missing parent", `[{"op":"add","path":"/baz/bat","value":"qux"}]`),
+		Entry("when removing a missing member", `[{"op":"remove","path":"/baz"}]`),
+		Entry("when replacing a missing member", `[{"op":"replace","path":"/baz","value":1}]`),
+		Entry("with an index out of range", `[{"op":"add","path":"/list/3","value":3}]`),
+		Entry("with an index that has a leading zero", `[{"op":"remove","path":"/list/01"}]`),
+		Entry("with an index that isn't a number", `[{"op":"replace","path":"/list/one","value":1}]`),
+		Entry("when moving a value into itself", `[{"op":"move","from":"/list","path":"/list/0"}]`),
+		Entry("when removing the document", `[{"op":"remove","path":""}]`),
+	)
+
+	DescribeTable("should reject invalid patches",
+		func(patch string) {
+			// Act
+			_, err := JsonPatch([]byte(`{"foo":"bar"}`), []byte(patch))
+
+			// Assert
+			Expect(err).To(MatchError(ErrInvalidPatch))
+		},
+		Entry("that aren't arrays", `{"op":"add","path":"/baz","value":1}`),
+		Entry("with an unknown operation", `[{"op":"frob","path":"/foo"}]`),
+		Entry("without a path", `[{"op":"remove"}]`),
+		Entry("with a path that isn't a pointer", `[{"op":"remove","path":"foo"}]`),
+		Entry("without a value", `[{"op":"add","path":"/baz"}]`),
+		Entry("without a from", `[{"op":"copy","path":"/baz"}]`),
+	)
+
+	It("should leave the document alone if an operation fails", func() {
+		// Arrange
+		document := []byte(`{"foo":"bar"}`)
+
+		// Act
+		_, err := JsonPatch(document, []byte(`[{"op":"replace","path":"/foo","value":"baz"},{"op":"test","path":"/foo","value":"bar"}]`))
+
+		// Assert
+		Expect(err).To(MatchError(ErrPatchFailed))
+		Expect(err.Error()).To(ContainSubstring("operation 1 (test)"))
+		Expect(document).To(MatchJSON(`{"foo":"bar"}`))
+	})
+})
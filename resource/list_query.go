@@ -0,0 +1,321 @@
+package resource
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/response"
+)
+
+// Limits for list queries unless SetListOptions says otherwise
+const (
+	DefaultListLimit    = 50
+	DefaultMaxListLimit = 1000
+)
+
+// The query of a List request, e.g.
+//
+//	GET /foos?status=active&created>2024-01-01&kind[in]=a,b&sort=-created,name&fields=id,name&limit=20&cursor=...
+//
+// Use ParseListQuery() to get it; typed resources are given it.
+type ListQuery struct {
+	Params  url.Values // the request's query parameters
+	Limit   int        // the most items to return; always set
+	Offset  int        // the number of items to skip; not used with Cursor
+	Cursor  string     // where the previous page ended (see response.Page), if any; see DecodeCursor
+	Sort    []SortField
+	Filters []Filter
+	Fields  []string // the fields to return, or empty for all of them
+}
+
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+type FilterOp string
+
+const (
+	FilterEq  FilterOp = "eq"  // status=active or status[eq]=active
+	FilterNe  FilterOp = "ne"  // status!=active or status[ne]=active
+	FilterGt  FilterOp = "gt"  // created>2024-01-01 or created[gt]=2024-01-01
+	FilterGte FilterOp = "gte" // created>=2024-01-01 or created[gte]=2024-01-01
+	FilterLt  FilterOp = "lt"  // created<2024-01-01 or created[lt]=2024-01-01
+	FilterLte FilterOp = "lte" // created<=2024-01-01 or created[lte]=2024-01-01
+	FilterIn  FilterOp = "in"  // status[in]=active,pending
+)
+
+var filterOps = []FilterOp{FilterEq, FilterNe, FilterGt, FilterGte, FilterLt, FilterLte, FilterIn}
+
+// A filter on a field; every filter has one value, except for FilterIn
+type Filter struct {
+	Field  string
+	Op     FilterOp
+	Values []string
+}
+
+// The filter's (first) value
+func (f Filter) Value() string {
+	if len(f.Values) == 0 {
+		return ""
+	}
+	return f.Values[0]
+}
+
+// The filters on a field
+func (q ListQuery) FiltersOf(field string) []Filter {
+	var filters []Filter
+	for _, filter := range q.Filters {
+		if filter.Field == field {
+			filters = append(filters, filter)
+		}
+	}
+	return filters
+}
+
+// What list queries may ask for; see SetListOptions
+type ListOptions struct {
+	DefaultLimit int      // DefaultListLimit if zero
+	MaxLimit     int      // DefaultMaxListLimit if zero
+	Sorts        []string // the fields that can be sorted by; any field if nil
+	Filters      []string // the fields that can be filtered on; any field if nil
+	Fields       []string // the fields that can be selected; any field if nil
+}
+
+type listOptionsKey struct{}
+
+// Set what list queries may ask for (see ParseListQuery); queries that ask for anything else are rejected.
+func (erh EasyResourceHandler) SetListOptions(options ListOptions) {
+	erh.options.list = &options
+}
+
+// the parameters that aren't filters
+const (
+	limitParam  = "limit"
+	offsetParam = "offset"
+	sortParam   = "sort"
+	fieldsParam = "fields"
+)
+
+// Parse the query of a List request, using the options set with SetListOptions.  Invalid queries return
+// response.SvcErrorInvalidQuery, listing every problem as a field violation.
+//
+// Parameters other than limit, offset, cursor, sort and fields are filters.
+func ParseListQuery(ctx context.Context, req *http.Request) (ListQuery, error) {
+	options, _ := ctx.Value(listOptionsKey{}).(ListOptions)
+	if options.DefaultLimit <= 0 {
+		options.DefaultLimit = DefaultListLimit
+	}
+	if options.MaxLimit <= 0 {
+		options.MaxLimit = DefaultMaxListLimit
+	}
+	options.DefaultLimit = min(options.DefaultLimit, options.MaxLimit)
+
+	query := ListQuery{Params: req.URL.Query(), Limit: options.DefaultLimit}
+	var violations []response.FieldViolation
+	violate := func(field string, reason string, value interface{}) {
+		violations = append(violations, response.FieldViolation{Field: field, Reason: reason, Value: value})
+	}
+
+	for _, part := range strings.Split(req.URL.RawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		field, op, value, err := parseQueryPart(part)
+		if err != nil {
+			violate(part, err.Error(), nil)
+			continue
+		}
+		if op != FilterEq && isReservedParam(field) {
+			violate(field, "must be given as "+field+"=value", value)
+			continue
+		}
+
+		switch field {
+		case limitParam:
+			limit, err := strconv.Atoi(value)
+			switch {
+			case err != nil || limit < 1:
+				violate(field, "must be a positive integer", value)
+			case limit > options.MaxLimit:
+				violate(field, fmt.Sprintf("must be at most %d", options.MaxLimit), value)
+			default:
+				query.Limit = limit
+			}
+		case offsetParam:
+			offset, err := strconv.Atoi(value)
+			if err != nil || offset < 0 {
+				violate(field, "must be a non-negative integer", value)
+			} else {
+				query.Offset = offset
+			}
+		case response.CursorParam:
+			query.Cursor = value
+		case sortParam:
+			for _, name := range splitList(value) {
+				sort := SortField{Field: strings.TrimLeft(name, "+-"), Descending: strings.HasPrefix(name, "-")}
+				if !allowed(options.Sorts, sort.Field) {
+					violate(field, "can't sort by "+sort.Field, name)
+					continue
+				}
+				query.Sort = append(query.Sort, sort)
+			}
+		case fieldsParam:
+			for _, name := range splitList(value) {
+				if !allowed(options.Fields, name) {
+					violate(field, "unknown field "+name, name)
+					continue
+				}
+				query.Fields = append(query.Fields, name)
+			}
+		default:
+			if !allowed(options.Filters, field) {
+				violate(field, "can't filter on "+field, value)
+				continue
+			}
+			filter := Filter{Field: field, Op: op, Values: []string{value}}
+			if op == FilterIn {
+				filter.Values = splitList(value)
+			}
+			query.Filters = append(query.Filters, filter)
+		}
+	}
+	if query.Cursor != "" && query.Offset > 0 {
+		violate(offsetParam, "can't be used with a cursor", query.Offset)
+	}
+
+	if len(violations) > 0 {
+		return query, response.SvcErrorInvalidQuery.WithFieldViolations(violations...)
+	}
+	return query, nil
+}
+
+// Splits a query parameter into its field, operator and value, e.g. "created>=2024" or "kind[in]=a,b"
+func parseQueryPart(part string) (string, FilterOp, string, error) {
+	// a parameter without a value is an empty filter
+	rawKey, rawValue, op := part, "", FilterEq
+	if index := strings.IndexAny(part, "=!<>"); index >= 0 {
+		rawKey, rawValue = part[:index], part[index+1:]
+		switch part[index] {
+		case '!':
+			if !strings.HasPrefix(rawValue, "=") {
+				return "", "", "", errors.New("unknown operator")
+			}
+			op, rawValue = FilterNe, rawValue[1:]
+		case '>', '<':
+			op = map[byte]FilterOp{'>': FilterGt, '<': FilterLt}[part[index]]
+			if strings.HasPrefix(rawValue, "=") {
+				op, rawValue = map[byte]FilterOp{'>': FilterGte, '<': FilterLte}[part[index]], rawValue[1:]
+			}
+		}
+	}
+
+	key, err := url.QueryUnescape(rawKey)
+	if err != nil {
+		return "", "", "", errors.New("invalid name")
+	}
+	value, err := url.QueryUnescape(rawValue)
+	if err != nil {
+		return "", "", "", errors.New("invalid value")
+	}
+	// created[gt]=2024-01-01
+	if open := strings.Index(key, "["); open >= 0 && strings.HasSuffix(key, "]") {
+		if op != FilterEq {
+			return "", "", "", errors.New("has two operators")
+		}
+		op = FilterOp(key[open+1 : len(key)-1])
+		key = key[:open]
+		if !slices.Contains(filterOps, op) {
+			return "", "", "", fmt.Errorf("unknown operator %q", op)
+		}
+	}
+	if key == "" {
+		return "", "", "", errors.New("needs a name")
+	}
+	return key, op, value, nil
+}
+
+func isReservedParam(name string) bool {
+	return name == limitParam || name == offsetParam || name == response.CursorParam || name == sortParam || name == fieldsParam
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// nil allows anything
+func allowed(names []string, name string) bool {
+	return name != "" && (names == nil || slices.Contains(names, name))
+}
+
+// Encode where a page ended (e.g. the sort key of its last item) as an opaque cursor, for response.Page.Next
+func EncodeCursor(position interface{}) (string, error) {
+	raw, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Decode a cursor made by EncodeCursor; cursors that can't be decoded return response.SvcErrorInvalidQuery
+func DecodeCursor(cursor string, position interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(raw, position)
+	}
+	if err != nil {
+		return response.SvcErrorInvalidQuery.WithFieldViolation(response.CursorParam, "invalid cursor", cursor)
+	}
+	return nil
+}
+
+// Keeps only the selected fields of an object (or of each item of a slice), by their JSON names; an empty list of
+// fields keeps them all.
+func SelectFields(object interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return object, nil
+	}
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return nil, response.SvcErrorJsonMarshalFailed.WithError(err)
+	}
+	var value interface{}
+	if err = unmarshalJsonValue(raw, &value); err != nil {
+		return nil, response.SvcErrorJsonMarshalFailed.WithError(err)
+	}
+
+	selectOf := func(item interface{}) interface{} {
+		members, ok := item.(map[string]interface{})
+		if !ok {
+			return item
+		}
+		selected := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if member, found := members[field]; found {
+				selected[field] = member
+			}
+		}
+		return selected
+	}
+	if items, ok := value.([]interface{}); ok {
+		for index, item := range items {
+			items[index] = selectOf(item)
+		}
+		return items, nil
+	}
+	return selectOf(value), nil
+}
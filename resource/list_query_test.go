@@ -0,0 +1,133 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/keithpaterson/resweave-utils/response"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("List queries", func() {
+	parse := func(query string, options *ListOptions) (ListQuery, error) {
+		ctx := context.TODO()
+		if options != nil {
+			ctx = context.WithValue(ctx, listOptionsKey{}, *options)
+		}
+		return ParseListQuery(ctx, httptest.NewRequest(http.MethodGet, "/foos?"+query, nil))
+	}
+
+	It("should use the default limit", func() {
+		query, err := parse("", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(query.Limit).To(Equal(DefaultListLimit))
+		Expect(query.Filters).To(BeEmpty())
+	})
+
+	It("should parse pagination, sorting and fields", func() {
+		// Act
+		query, err := parse("limit=20&offset=40&sort=-created,name&sort=%2Bsize&fields=id,name", nil)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(query.Limit).To(Equal(20))
+		Expect(query.Offset).To(Equal(40))
+		Expect(query.Sort).To(Equal([]SortField{{Field: "created", Descending: true}, {Field: "name"}, {Field: "size"}}))
+		Expect(query.Fields).To(Equal([]string{"id", "name"}))
+		Expect(query.Params.Get("limit")).To(Equal("20"))
+	})
+
+	DescribeTable("should parse filters",
+		func(raw string, expectFilter Filter) {
+			// Act
+			query, err := parse(raw, nil)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(query.Filters).To(Equal([]Filter{expectFilter}))
+		},
+		Entry("equal", "status=active", Filter{Field: "status", Op: FilterEq, Values: []string{"active"}}),
+		Entry("not equal", "status!=active", Filter{Field: "status", Op: FilterNe, Values: []string{"active"}}),
+		Entry("greater than", "created>2024-01-01", Filter{Field: "created", Op: FilterGt, Values: []string{"2024-01-01"}}),
+		Entry("at least", "created>=2024-01-01", Filter{Field: "created", Op: FilterGte, Values: []string{"2024-01-01"}}),
+		Entry("less than", "size<10", Filter{Field: "size", Op: FilterLt, Values: []string{"10"}}),
+		Entry("at most", "size<=10", Filter{Field: "size", Op: FilterLte, Values: []string{"10"}}),
+		Entry("in", "kind[in]=a,b", Filter{Field: "kind", Op: FilterIn, Values: []string{"a", "b"}}),
+		Entry("named operator", "created[gte]=2024", Filter{Field: "created", Op: FilterGte, Values: []string{"2024"}}),
+		Entry("escaped", "na%20me=a%26b%3Dc", Filter{Field: "na me", Op: FilterEq, Values: []string{"a&b=c"}}),
+		Entry("without a value", "archived", Filter{Field: "archived", Op: FilterEq, Values: []string{""}}),
+	)
+
+	It("should find the filters of a field", func() {
+		query, err := parse("size>1&status=active&size<10", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(query.FiltersOf("size")).To(HaveLen(2))
+		Expect(query.FiltersOf("size")[1].Value()).To(Equal("10"))
+	})
+
+	DescribeTable("should reject invalid queries",
+		func(raw string, options *ListOptions, expectField string) {
+			// Act
+			_, err := parse(raw, options)
+
+			// Assert
+			Expect(err).To(MatchError(response.SvcErrorInvalidQuery))
+			var svcErr *response.SvcError
+			Expect(errors.As(err, &svcErr)).To(BeTrue())
+			Expect(svcErr.FieldViolations()).To(ContainElement(HaveField("Field", expectField)))
+		},
+		Entry("with a limit that isn't a number", "limit=ten", nil, "limit"),
+		Entry("with a limit that is too large", "limit=30", &ListOptions{MaxLimit: 25}, "limit"),
+		Entry("with a negative offset", "offset=-1", nil, "offset"),
+		Entry("with an offset and a cursor", "offset=10&cursor=abc", nil, "offset"),
+		Entry("with an operator on a reserved parameter", "limit>10", nil, "limit"),
+		Entry("with an unknown operator", "size[near]=10", nil, "size[near]=10"),
+		Entry("with a sort that isn't allowed", "sort=secret", &ListOptions{Sorts: []string{"name"}}, "sort"),
+		Entry("with a filter that isn't allowed", "secret=1", &ListOptions{Filters: []string{"name"}}, "secret"),
+		Entry("with a field that isn't allowed", "fields=id,secret", &ListOptions{Fields: []string{"id"}}, "fields"),
+	)
+
+	It("should report every problem", func() {
+		_, err := parse("limit=0&offset=x", nil)
+		var svcErr *response.SvcError
+		Expect(errors.As(err, &svcErr)).To(BeTrue())
+		Expect(svcErr.FieldViolations()).To(HaveLen(2))
+	})
+
+	It("should round trip cursors", func() {
+		// Arrange
+		type position struct {
+			Created string `json:"created"`
+			ID      int    `json:"id"`
+		}
+
+		// Act
+		cursor, err := EncodeCursor(position{Created: "2024-01-01", ID: 7})
+		Expect(err).ToNot(HaveOccurred())
+		var decoded position
+		Expect(DecodeCursor(cursor, &decoded)).To(Succeed())
+
+		// Assert
+		Expect(decoded).To(Equal(position{Created: "2024-01-01", ID: 7}))
+		Expect(DecodeCursor("not a cursor!", &decoded)).To(MatchError(response.SvcErrorInvalidQuery))
+	})
+
+	DescribeTable("should select fields",
+		func(object interface{}, fields []string, expectJson string) {
+			// Act
+			selected, err := SelectFields(object, fields)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(json.Marshal(selected)).To(MatchJSON(expectJson))
+		},
+		Entry("of an object", widget{ID: 1, Name: "cog"}, []string{"name"}, `{"name": "cog"}`),
+		Entry("of a list", []widget{{ID: 1, Name: "cog"}, {ID: 2, Name: "gear"}}, []string{"id"}, `[{"id": 1}, {"id": 2}]`),
+		Entry("that don't exist", widget{ID: 1, Name: "cog"}, []string{"id", "size"}, `{"id": 1}`),
+		Entry("of everything", widget{ID: 1, Name: "cog"}, nil, `{"id": 1, "name": "cog"}`),
+	)
+})
@@ -0,0 +1,63 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+)
+
+// Apply a JSON merge patch (RFC 7386) to a JSON document; an empty document is treated as null.
+//
+// Members of the patch replace the document's members, objects are merged recursively, and null members remove
+// the document's members, e.g. applying {"name":"cog","tags":null} to {"id":1,"name":"gear","tags":["a"]} gives
+// {"id":1,"name":"cog"}.
+func MergePatch(document []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+	if len(bytes.TrimSpace(document)) > 0 {
+		if err := unmarshalJsonValue(document, &target); err != nil {
+			return nil, fmt.Errorf("%w: document: %w", ErrInvalidPatch, err)
+		}
+	}
+	var changes interface{}
+	if err := unmarshalJsonValue(patch, &changes); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+	return json.Marshal(mergePatch(target, changes))
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// Keeps numbers as they were written, so that large integers aren't rounded
+func unmarshalJsonValue(data []byte, value *interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(value); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
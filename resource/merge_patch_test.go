@@ -0,0 +1,53 @@
+package resource
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MergePatch", func() {
+	// examples from RFC 7386, appendix A
+	DescribeTable("should apply patches",
+		func(document string, patch string, expected string) {
+			// Act
+			merged, err := MergePatch([]byte(document), []byte(patch))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(merged).To(MatchJSON(expected))
+		},
+		Entry("replacing a member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`),
+		Entry("adding a member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`),
+		Entry("removing a member", `{"a":"b"}`, `{"a":null}`, `{}`),
+		Entry("removing one of several members", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`),
+		Entry("replacing an array", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`),
+		Entry("replacing with an array", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`),
+		Entry("merging nested objects", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`),
+		Entry("replacing arrays of objects", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`),
+		Entry("replacing an array document", `["a","b"]`, `["c","d"]`, `["c","d"]`),
+		Entry("replacing an object document", `{"a":"b"}`, `["c"]`, `["c"]`),
+		Entry("replacing with null", `{"a":"foo"}`, `null`, `null`),
+		Entry("replacing with a string", `{"a":"foo"}`, `"bar"`, `"bar"`),
+		Entry("keeping null members of the patch out", `{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`),
+		Entry("replacing an array with an object", `[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`),
+		Entry("creating nested objects", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`),
+		Entry("patching an empty document", ``, `{"a":1}`, `{"a":1}`),
+	)
+
+	It("should keep large numbers intact", func() {
+		merged, err := MergePatch([]byte(`{"id":9007199254740993}`), []byte(`{"name":"cog"}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(merged)).To(Equal(`{"id":9007199254740993,"name":"cog"}`))
+	})
+
+	DescribeTable("should reject invalid JSON",
+		func(document string, patch string) {
+			_, err := MergePatch([]byte(document), []byte(patch))
+			Expect(err).To(MatchError(ErrInvalidPatch))
+		},
+		Entry("in the patch", `{"a":1}`, `{"a":`),
+		Entry("after the patch", `{"a":1}`, `{"a":2} {"b":3}`),
+		Entry("with an empty patch", `{"a":1}`, ``),
+		Entry("in the document", `{"a":`, `{"a":1}`),
+	)
+})
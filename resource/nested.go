@@ -0,0 +1,261 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/mortedecai/resweave"
+)
+
+var (
+	ErrNotRootResource = errors.New("child resources are registered through their root resource")
+)
+
+// The ids in a nested resource's path, from the root down, e.g. for /orgs/7/projects/42 [{orgs 7} {projects 42}].
+//
+// Child resources get them with PathIDsFrom(); the last one is the child's own id if the request has one.
+type PathIDs []PathID
+
+type PathID struct {
+	Resource resweave.ResourceName
+	ID       string
+}
+
+// The id of a resource in the path
+func (ids PathIDs) Get(name resweave.ResourceName) (string, bool) {
+	for _, id := range ids {
+		if id.Resource == name {
+			return id.ID, true
+		}
+	}
+	return "", false
+}
+
+type pathIDsKey struct{}
+
+// The ids in the path of a request for a nested resource (see AddChild), or nil for other requests
+func PathIDsFrom(ctx context.Context) PathIDs {
+	ids, _ := ctx.Value(pathIDsKey{}).(PathIDs)
+	return ids
+}
+
+// Parse the id of an ancestor (or the resource itself) from the path; see PathIDsFrom and ParseID
+func PathIDOf[ID ResourceID](ctx context.Context, name resweave.ResourceName) (ID, error) {
+	raw, found := PathIDsFrom(ctx).Get(name)
+	if !found {
+		var zero ID
+		return zero, response.SvcErrorInvalidResourceId.WithDetail(fmt.Sprintf("no %s id in the path", name))
+	}
+	return ParseID[ID](raw)
+}
+
+// The parent and children of a resource handler
+type resourceTree struct {
+	parent   *EasyResourceHandler
+	children map[resweave.ResourceName]*EasyResourceHandler
+}
+
+// Declare a child resource, e.g. projects under orgs serves /orgs/{orgId}/projects/{projectId}; returns the child so
+// that it can have children of its own.
+//
+// Only the root of the tree is registered with resweave (see EasyResourceHandler.AddEasyResource).  resweave routes
+// requests for nested paths to the root by its name and id, and the root's handler passes them down the tree.  Before the child is called, each ancestor's Fetch is called to
+// make sure that the entity exists; if it doesn't, the ancestor's error response is sent instead.  The child gets the
+// ids in the path from PathIDsFrom().
+func (erh *EasyResourceHandler) AddChild(child *EasyResourceHandler) *EasyResourceHandler {
+	erh.tree.children[child.Name()] = child
+	child.tree.parent = erh
+	return child
+}
+
+// A request for a nested resource, or for a custom action (see AddAction)
+type routedRequest struct {
+	target    *EasyResourceHandler
+	ancestors []*EasyResourceHandler
+	ids       PathIDs
+	hasId     bool // whether the path has the target's own id
+	action    *CustomAction
+}
+
+// Finds the child or custom action that a request is for, if its path goes past this (root) resource, e.g.
+// /orgs/7/projects or /jobs/7:cancel.
+//
+// resweave finds the root by its name and puts its id in the context; the rest of the path, after those two
+// segments, is followed down the tree.  Returns an error response if the path names a resource that isn't a child.
+func (erh EasyResourceHandler) route(ctx context.Context, r *http.Request) (*routedRequest, response.ServiceError) {
+	if erh.tree.parent != nil || (len(erh.tree.children) == 0 && len(erh.actions) == 0) {
+		return nil, nil
+	}
+	// requests without an id are for the root's collection; its actions are routed by resweave (see AddAction)
+	id, err := erh.api.GetIDValue(ctx)
+	if err != nil {
+		return nil, nil
+	}
+	rest, found := pathAfter(r.URL.Path, erh.Name(), id)
+	if !found {
+		return nil, nil
+	}
+	segments := append([]string{string(erh.Name()), id}, rest...)
+
+	// a custom action can follow the last segment after a colon, e.g. /jobs/7:cancel or /orgs/7/projects:purge; if
+	// the resource has no such action the colon is part of the id
+	last := len(segments) - 1
+	if colon := strings.LastIndex(segments[last], ":"); colon >= 0 {
+		stripped := append(segments[:last:last], segments[last][:colon])
+		if routed, err := erh.walk(stripped, r); err == nil {
+			if action, found := routed.target.actions[segments[last][colon+1:]]; found && routed.action == nil {
+				routed.action = action
+				return routed, nil
+			}
+		}
+	}
+
+	routed, svcErr := erh.walk(segments, r)
+	if svcErr != nil {
+		return nil, svcErr
+	}
+	if len(routed.ancestors) == 0 && routed.action == nil {
+		// /orgs and /orgs/7 are for the root itself
+		return nil, nil
+	}
+	return routed, nil
+}
+
+// The segments of the path after the resource's name and id; the first place where the two appear together is used,
+// so that a prefix (e.g. /api) or an id can be the same as a resource's name.
+func pathAfter(path string, name resweave.ResourceName, id string) ([]string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for index := 0; index+1 < len(segments); index++ {
+		if segments[index] == string(name) && segments[index+1] == id {
+			return segments[index+2:], true
+		}
+	}
+	return nil, false
+}
+
+// Follows the path segments (starting with the root's name) down the tree
+func (erh EasyResourceHandler) walk(segments []string, r *http.Request) (*routedRequest, response.ServiceError) {
+	routed := &routedRequest{target: &erh}
+	for index := 0; index < len(segments); index += 2 {
+		if index > 0 {
+			child, found := routed.target.tree.children[resweave.ResourceName(segments[index])]
+			if !found {
+				// custom actions can also follow an id as a segment, e.g. /users/7/reset-password
+				if action, isAction := routed.target.actions[segments[index]]; isAction && index == len(segments)-1 {
+					routed.action = action
+					return routed, nil
+				}
+				return nil, response.SvcErrorResourceNotFound.WithDetail(r.URL.Path)
+			}
+			routed.ancestors = append(routed.ancestors, routed.target)
+			routed.target = child
+		}
+		if index+1 < len(segments) {
+			routed.ids = append(routed.ids, PathID{Resource: routed.target.Name(), ID: segments[index+1]})
+			routed.hasId = true
+		} else {
+			routed.hasId = false
+		}
+	}
+	return routed, nil
+}
+
+// The action for a request's method, given whether the path has an id
+func actionOf(method string, hasId bool) (resweave.ActionType, bool) {
+	switch {
+	case method == http.MethodPost && !hasId:
+		return resweave.Create, true
+	case method == http.MethodGet && !hasId:
+		return resweave.List, true
+	case method == http.MethodGet:
+		return resweave.Fetch, true
+	case method == http.MethodDelete && hasId:
+		return resweave.Delete, true
+	case (method == http.MethodPut || method == http.MethodPatch) && hasId:
+		return resweave.Update, true
+	}
+	return 0, false
+}
+
+// Checks that the ancestors exist, then passes the request to the child or custom action
+func (routed *routedRequest) serve(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	writer := response.NewWriter(w).WithRequest(r)
+	var at resweave.ActionType
+	if routed.action != nil {
+		if routed.action.RequiresID && !routed.hasId {
+			writer.WriteErrorResponse(http.StatusBadRequest, response.SvcErrorInvalidResourceId.WithDetail(routed.action.Name))
+			return
+		}
+		if !routed.action.RequiresID && routed.hasId {
+			writer.WriteError(response.SvcErrorResourceNotFound.WithDetail(r.URL.Path))
+			return
+		}
+	} else {
+		var ok bool
+		if at, ok = actionOf(r.Method, routed.hasId); !ok {
+			writer.WriteError(response.SvcErrorInvalidMethod.WithDetail(r.Method))
+			return
+		}
+	}
+	ctx = context.WithValue(ctx, pathIDsKey{}, routed.ids)
+
+	for index, ancestor := range routed.ancestors {
+		if !ancestor.exists(routed.ids[index].ID, ctx, w, r) {
+			return
+		}
+	}
+	if routed.hasId {
+		ctx = context.WithValue(ctx, nestedIDKey{}, routed.ids[len(routed.ids)-1].ID)
+	}
+	routed.target.handleAction(requestAction{at: at, custom: routed.action}, ctx, w, r)
+}
+
+// the target's own id, which resweave doesn't know about (see GetIDValue)
+type nestedIDKey struct{}
+
+// Calls Fetch for an ancestor's id; if that fails its response is sent and false is returned.
+func (erh EasyResourceHandler) exists(id string, ctx context.Context, w http.ResponseWriter, r *http.Request) bool {
+	fetcher, ok := erh.resource.(easyFetcher)
+	if !ok || !erh.validateActionImplemented(resweave.Fetch) {
+		return true
+	}
+
+	// the child's body, conditions and media types are about the child, not its ancestors
+	fetchReq := r.Clone(ctx)
+	fetchReq.Method = http.MethodGet
+	fetchReq.Body = http.NoBody
+	fetchReq.ContentLength = 0
+	for _, name := range []string{header.ContentType, header.IdempotencyKey, header.IfMatch, header.IfNoneMatch, header.IfModifiedSince, header.IfUnmodifiedSince, header.IfRange} {
+		fetchReq.Header.Del(name)
+	}
+	fetchReq.Header.Set(header.Accept, header.MimeTypeJson)
+	recorder := &recordingWriter{ResponseWriter: &discardWriter{header: make(http.Header)}}
+	fetcher.Fetch(id, ctx, response.NewWriter(recorder).WithRequest(fetchReq), fetchReq)
+
+	if recorder.status < http.StatusBadRequest {
+		return true
+	}
+	erh.NewInfo("exists", "parent check failed").WithResource(erh.Name()).With("id", id).With("status", recorder.status).Log()
+	writeStored(w, StoredResponse{Status: recorder.status, Header: recorder.Header(), Body: recorder.body.Bytes()})
+	return false
+}
+
+// Collects a response that isn't sent
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
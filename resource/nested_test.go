@@ -0,0 +1,257 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/mortedecai/resweave"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// knows some ids; records the calls it gets, with the ids in the path
+type nodeResource struct {
+	resweave.LogHolder
+
+	ids   map[string]bool
+	calls []nodeCall
+}
+
+type nodeCall struct {
+	action resweave.ActionType
+	id     string
+	path   PathIDs
+}
+
+func newNodeResource(name string, ids ...string) *nodeResource {
+	nr := &nodeResource{LogHolder: resweave.NewLogholder(name, nil), ids: make(map[string]bool)}
+	for _, id := range ids {
+		nr.ids[id] = true
+	}
+	return nr
+}
+
+func (nr *nodeResource) record(at resweave.ActionType, id string, ctx context.Context, writer response.Writer) {
+	nr.calls = append(nr.calls, nodeCall{action: at, id: id, path: PathIDsFrom(ctx)})
+	if id != "" && !nr.ids[id] {
+		writer.WriteError(fmt.Errorf("%w: %s", ErrNoSuchResource, id))
+		return
+	}
+	writer.WriteResponse(http.StatusOK)
+}
+
+func (nr *nodeResource) Create(ctx context.Context, writer response.Writer, _ *http.Request) {
+	nr.record(resweave.Create, "", ctx, writer)
+}
+
+func (nr *nodeResource) List(ctx context.Context, writer response.Writer, _ *http.Request) {
+	nr.record(resweave.List, "", ctx, writer)
+}
+
+func (nr *nodeResource) Fetch(id string, ctx context.Context, writer response.Writer, _ *http.Request) {
+	nr.record(resweave.Fetch, id, ctx, writer)
+}
+
+func (nr *nodeResource) Update(id string, ctx context.Context, writer response.Writer, _ *http.Request) {
+	nr.record(resweave.Update, id, ctx, writer)
+}
+
+func (nr *nodeResource) Delete(id string, ctx context.Context, writer response.Writer, _ *http.Request) {
+	nr.record(resweave.Delete, id, ctx, writer)
+}
+
+// only writes JSON, and fails requests with conditions
+type pickyResource struct {
+	resweave.LogHolder
+
+	requests []*http.Request
+}
+
+func (pr *pickyResource) Fetch(id string, _ context.Context, writer response.Writer, req *http.Request) {
+	pr.requests = append(pr.requests, req)
+	if req.Header.Get(header.IfMatch) != "" {
+		writer.WriteError(response.SvcErrorPreconditionFailed)
+		return
+	}
+	writer.WithOffers(header.MimeTypeJson).Negotiate(req, http.StatusOK, map[string]string{"id": id})
+}
+
+var _ = Describe("Nested resources", func() {
+	var (
+		orgs     *nodeResource
+		projects *nodeResource
+		tasks    *nodeResource
+		root     *EasyResourceHandler
+		serve    func(method string, path string) *http.Response
+	)
+	BeforeEach(func() {
+		orgs = newNodeResource("orgs", "7", "projects")
+		projects = newNodeResource("projects", "42")
+		tasks = newNodeResource("tasks", "3")
+		root = NewResource("orgs", orgs)
+		root.AddChild(NewResource("projects", projects)).AddChild(NewResource("tasks", tasks))
+
+		// resweave only knows about the root, and finds it by its name and id
+		server := resweave.NewServer(8080)
+		Expect(root.AddEasyResource(server)).To(Succeed())
+		serve = func(method string, path string) *http.Response {
+			recorder := httptest.NewRecorder()
+			server.Serve(recorder, httptest.NewRequest(method, path, nil))
+			return recorder.Result()
+		}
+	})
+
+	It("should check ancestors without the child's body, conditions or media types", func() {
+		// Arrange
+		parent := &pickyResource{LogHolder: resweave.NewLogholder("shelves", nil)}
+		books := newNodeResource("books", "9")
+		shelves := NewResource("shelves", parent)
+		shelves.AddChild(NewResource("books", books))
+		server := resweave.NewServer(8080)
+		Expect(shelves.AddEasyResource(server)).To(Succeed())
+		req := httptest.NewRequest(http.MethodPut, "/shelves/1/books/9", strings.NewReader(`<book/>`))
+		req.Header.Set(header.Accept, header.MimeTypeXml)
+		req.Header.Set(header.ContentType, header.MimeTypeXml)
+		req.Header.Set(header.IfMatch, `"v1"`)
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.Serve(recorder, req)
+
+		// Assert
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(books.calls).To(HaveLen(1))
+		Expect(parent.requests).To(HaveLen(1))
+		fetched := parent.requests[0]
+		Expect(fetched.Method).To(Equal(http.MethodGet))
+		Expect(fetched.Header.Get(header.Accept)).To(Equal(header.MimeTypeJson))
+		Expect(fetched.Header.Get(header.ContentType)).To(BeEmpty())
+		Expect(fetched.Header.Get(header.IfMatch)).To(BeEmpty())
+		Expect(fetched.ContentLength).To(BeZero())
+	})
+
+	DescribeTable("should pass requests to the child with the ids in the path",
+		func(method string, path string, expectCall nodeCall) {
+			// Act
+			resp := serve(method, path)
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(tasks.calls).To(Equal([]nodeCall{expectCall}))
+			Expect(orgs.calls).To(Equal([]nodeCall{{action: resweave.Fetch, id: "7", path: expectCall.path}}))
+			Expect(projects.calls).To(Equal([]nodeCall{{action: resweave.Fetch, id: "42", path: expectCall.path}}))
+		},
+		Entry("list", http.MethodGet, "/orgs/7/projects/42/tasks",
+			nodeCall{action: resweave.List, path: PathIDs{{"orgs", "7"}, {"projects", "42"}}}),
+		Entry("create", http.MethodPost, "/orgs/7/projects/42/tasks",
+			nodeCall{action: resweave.Create, path: PathIDs{{"orgs", "7"}, {"projects", "42"}}}),
+		Entry("fetch", http.MethodGet, "/orgs/7/projects/42/tasks/3",
+			nodeCall{action: resweave.Fetch, id: "3", path: PathIDs{{"orgs", "7"}, {"projects", "42"}, {"tasks", "3"}}}),
+		Entry("update", http.MethodPut, "/orgs/7/projects/42/tasks/3",
+			nodeCall{action: resweave.Update, id: "3", path: PathIDs{{"orgs", "7"}, {"projects", "42"}, {"tasks", "3"}}}),
+		Entry("delete", http.MethodDelete, "/orgs/7/projects/42/tasks/3/",
+			nodeCall{action: resweave.Delete, id: "3", path: PathIDs{{"orgs", "7"}, {"projects", "42"}, {"tasks", "3"}}}),
+	)
+
+	It("should follow the path after the root's id when the id is a resource's name", func() {
+		// Act
+		resp := serve(http.MethodGet, "/orgs/projects/projects/42/tasks")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(tasks.calls).To(Equal([]nodeCall{{action: resweave.List, path: PathIDs{{"orgs", "projects"}, {"projects", "42"}}}}))
+	})
+
+	DescribeTable("should find the path after the resource's name and id",
+		func(path string, id string, expectRest []string, expectFound bool) {
+			rest, found := pathAfter(path, "orgs", id)
+			Expect(found).To(Equal(expectFound))
+			Expect(rest).To(Equal(expectRest))
+		},
+		Entry("for a child", "/orgs/7/projects", "7", []string{"projects"}, true),
+		Entry("for the resource itself", "/orgs/7/", "7", []string{}, true),
+		Entry("after a prefix with the same name", "/orgs/orgs/7/projects/42", "7", []string{"projects", "42"}, true),
+		Entry("with an id that is the resource's name", "/orgs/orgs/projects", "orgs", []string{"projects"}, true),
+		Entry("without the id", "/orgs/8/projects", "7", []string(nil), false),
+	)
+
+	It("should handle requests for the root itself", func() {
+		// Act
+		resp := serve(http.MethodGet, "/orgs/7")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(orgs.calls).To(Equal([]nodeCall{{action: resweave.Fetch, id: "7"}}))
+		Expect(projects.calls).To(BeEmpty())
+	})
+
+	It("should send the parent's response when the parent doesn't exist", func() {
+		// Act
+		resp := serve(http.MethodGet, "/orgs/7/projects/99/tasks/3")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(response.SvcErrorResourceNotFound))
+		Expect(tasks.calls).To(BeEmpty())
+	})
+
+	It("should stop at the first missing ancestor", func() {
+		// Act
+		resp := serve(http.MethodGet, "/orgs/8/projects/42/tasks")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(orgs.calls).To(HaveLen(1))
+		Expect(projects.calls).To(BeEmpty())
+		Expect(tasks.calls).To(BeEmpty())
+	})
+
+	It("should respond with 404 for paths that aren't children", func() {
+		// Act
+		resp := serve(http.MethodGet, "/orgs/7/teams")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(response.SvcErrorResourceNotFound))
+		Expect(orgs.calls).To(BeEmpty())
+	})
+
+	DescribeTable("should respond with 405 for methods that don't fit the path",
+		func(method string, path string) {
+			// Act
+			resp := serve(method, path)
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+			Expect(tasks.calls).To(BeEmpty())
+		},
+		Entry("post with an id", http.MethodPost, "/orgs/7/projects/42/tasks/3"),
+		Entry("delete without an id", http.MethodDelete, "/orgs/7/projects/42/tasks"),
+		Entry("patch without an id", http.MethodPatch, "/orgs/7/projects/42/tasks"),
+	)
+
+	It("should parse ids in the path", func() {
+		// Arrange
+		ctx := context.WithValue(context.TODO(), pathIDsKey{}, PathIDs{{"orgs", "7"}, {"projects", "42"}})
+
+		// Act & Assert
+		Expect(PathIDOf[int](ctx, "projects")).To(Equal(42))
+		_, err := PathIDOf[int](ctx, "tasks")
+		Expect(err).To(MatchError(response.SvcErrorInvalidResourceId))
+	})
+
+	It("should only register the root with the server", func() {
+		// Arrange
+		server := resweave.NewServer(8080)
+		child := root.tree.children["projects"]
+
+		// Act & Assert
+		Expect(child.AddEasyResource(server)).To(MatchError(ErrNotRootResource))
+		Expect(root.AddEasyResource(server)).To(Succeed())
+	})
+})
@@ -0,0 +1,94 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+)
+
+// The patch formats that ApplyPatch supports, e.g. for the Accept-Patch header
+var PatchMimeTypes = []string{header.MimeTypeMergePatch, header.MimeTypeJsonPatch}
+
+// Apply a patch to a value (which must be a pointer), choosing the patch format by its Content-Type:
+//
+//	application/merge-patch+json  a JSON merge patch (see MergePatch); also used for application/json, or if
+//	                              there isn't a Content-Type
+//	application/json-patch+json   a JSON Patch (see JsonPatch)
+//
+// Other types return rw.ErrorUnsupportedMimeType, which is written as 415 (Unsupported Media Type).
+//
+// The value is marshaled to JSON, patched, and unmarshaled into a zeroed value, so fields that aren't marshaled
+// (e.g. `json:"-"`) are cleared.
+func ApplyPatch(target interface{}, contentType string, patch []byte) error {
+	patchType := header.MimeTypeMergePatch
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return fmt.Errorf("%w: %s", rw.ErrorUnsupportedMimeType, contentType)
+		}
+		patchType = mediaType
+	}
+
+	switch patchType {
+	case header.MimeTypeMergePatch, header.MimeTypeJson:
+		return ApplyMergePatch(target, patch)
+	case header.MimeTypeJsonPatch:
+		return ApplyJsonPatch(target, patch)
+	}
+	return fmt.Errorf("%w: %s (supported patch types: %s)", rw.ErrorUnsupportedMimeType, contentType, strings.Join(PatchMimeTypes, ", "))
+}
+
+// Apply a JSON merge patch to a value (which must be a pointer); see MergePatch
+func ApplyMergePatch(target interface{}, patch []byte) error {
+	return patchValue(target, patch, MergePatch)
+}
+
+// Apply a JSON Patch to a value (which must be a pointer); see JsonPatch
+func ApplyJsonPatch(target interface{}, patch []byte) error {
+	return patchValue(target, patch, JsonPatch)
+}
+
+// Reads a patch from the request body and applies it to the value (see ApplyPatch)
+func DecodePatch(req *http.Request, target interface{}) error {
+	if req.Body == nil {
+		return rw.ErrorNoData
+	}
+	patch, err := rw.ReadAll(req.Body)
+	if err != nil {
+		return response.SvcErrorReadRequestFailed.WithError(err)
+	}
+	if len(patch) == 0 {
+		return rw.ErrorNoData
+	}
+	return ApplyPatch(target, req.Header.Get(header.ContentType), patch)
+}
+
+func patchValue(target interface{}, patch []byte, apply func([]byte, []byte) ([]byte, error)) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return errors.New("patch target must be a non-nil pointer")
+	}
+
+	document, err := json.Marshal(target)
+	if err != nil {
+		return response.SvcErrorJsonMarshalFailed.WithError(err)
+	}
+	patched, err := apply(document, patch)
+	if err != nil {
+		return err
+	}
+
+	value.Elem().SetZero()
+	if err = json.Unmarshal(patched, target); err != nil {
+		return fmt.Errorf("%w: %w", rw.ErrorJsonUnmarshalFailed, err)
+	}
+	return nil
+}
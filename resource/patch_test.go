@@ -0,0 +1,83 @@
+package resource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type gizmo struct {
+	Name   string   `json:"name"`
+	Tags   []string `json:"tags,omitempty"`
+	Secret string   `json:"-"`
+}
+
+var _ = Describe("ApplyPatch", func() {
+	DescribeTable("should choose the patch format by content type",
+		func(contentType string, patch string, expected gizmo) {
+			// Arrange
+			target := gizmo{Name: "gear", Tags: []string{"metal"}}
+
+			// Act
+			err := ApplyPatch(&target, contentType, []byte(patch))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target).To(Equal(expected))
+		},
+		Entry("with a merge patch", header.MimeTypeMergePatch, `{"tags":null}`, gizmo{Name: "gear"}),
+		Entry("with a merge patch and parameters", header.MimeTypeMergePatch+"; charset=utf-8", `{"name":"cog"}`, gizmo{Name: "cog", Tags: []string{"metal"}}),
+		Entry("with JSON", header.MimeTypeJson, `{"name":"cog"}`, gizmo{Name: "cog", Tags: []string{"metal"}}),
+		Entry("without a content type", "", `{"name":"cog"}`, gizmo{Name: "cog", Tags: []string{"metal"}}),
+		Entry("with a JSON Patch", header.MimeTypeJsonPatch, `[{"op":"add","path":"/tags/0","value":"shiny"}]`, gizmo{Name: "gear", Tags: []string{"shiny", "metal"}}),
+	)
+
+	DescribeTable("should reject unsupported patch types",
+		func(contentType string) {
+			target := gizmo{Name: "gear"}
+			Expect(ApplyPatch(&target, contentType, []byte(`{}`))).To(MatchError(rw.ErrorUnsupportedMimeType))
+			Expect(target).To(Equal(gizmo{Name: "gear"}))
+		},
+		Entry("with XML", header.MimeTypeXml),
+		Entry("with an invalid content type", "application/"),
+	)
+
+	It("should clear fields that aren't marshaled", func() {
+		target := gizmo{Name: "gear", Secret: "shh"}
+		Expect(ApplyMergePatch(&target, []byte(`{"name":"cog"}`))).To(Succeed())
+		Expect(target).To(Equal(gizmo{Name: "cog"}))
+	})
+
+	It("should fail if the patched document doesn't fit the value", func() {
+		target := gizmo{Name: "gear"}
+		Expect(ApplyJsonPatch(&target, []byte(`[{"op":"replace","path":"/name","value":42}]`))).To(MatchError(rw.ErrorJsonUnmarshalFailed))
+	})
+
+	It("should require a pointer", func() {
+		Expect(ApplyMergePatch(gizmo{}, []byte(`{}`))).ToNot(Succeed())
+	})
+
+	It("should decode patches from requests", func() {
+		// Arrange
+		req := httptest.NewRequest(http.MethodPatch, "/gizmos/1", strings.NewReader(`[{"op":"remove","path":"/tags"}]`))
+		req.Header.Set(header.ContentType, header.MimeTypeJsonPatch)
+		target := gizmo{Name: "gear", Tags: []string{"metal"}}
+
+		// Act
+		err := DecodePatch(req, &target)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(target).To(Equal(gizmo{Name: "gear"}))
+	})
+
+	It("should require a patch in the request", func() {
+		req := httptest.NewRequest(http.MethodPatch, "/gizmos/1", nil)
+		Expect(DecodePatch(req, &gizmo{})).To(MatchError(rw.ErrorNoData))
+	})
+})
@@ -0,0 +1,137 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/mortedecai/resweave"
+)
+
+var (
+	// Resources can return this when an entity changed after its preconditions were checked (see Precondition)
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// The conditions a request was checked against, for resources that support optimistic concurrency (see
+// EasyResource); resource methods get it with PreconditionFrom().
+//
+// The handler checks the request before calling the resource method, but the entity can still change before the
+// method saves it.  To close that gap the method should only save the entity if it is still at Version (e.g.
+// `UPDATE ... WHERE version = ?`), and return ErrPreconditionFailed if it isn't.
+type Precondition struct {
+	Version     string // the entity's version when the request was checked
+	IfMatch     string // the request's If-Match header, if any
+	IfNoneMatch string // the request's If-None-Match header, if any
+}
+
+type preconditionKey struct{}
+
+// The precondition the request was checked against, if the resource supports optimistic concurrency
+func PreconditionFrom(ctx context.Context) (Precondition, bool) {
+	precondition, found := ctx.Value(preconditionKey{}).(Precondition)
+	return precondition, found
+}
+
+// Implemented by adapters that only sometimes support versions (e.g. typed resources)
+type versionImplementer interface {
+	implementsVersion() bool
+}
+
+func (erh EasyResourceHandler) versioner() (easyVersioner, bool) {
+	versioner, ok := erh.resource.(easyVersioner)
+	if impl, isAdapter := erh.resource.(versionImplementer); ok && isAdapter {
+		ok = impl.implementsVersion()
+	}
+	return versioner, ok
+}
+
+// Makes If-Match required for updates and deletes of resources that have versions, so that clients can't
+// overwrite changes that they haven't seen; requests without it are rejected with 428 (Precondition Required).
+func (erh EasyResourceHandler) SetRequireIfMatch(required bool) {
+	erh.options.requireIfMatch = required
+}
+
+// Checks the request's conditional headers against the entity's version, for resources that have versions.
+//
+// Fetch responses get an ETag (or 304 Not Modified if If-None-Match matches), and updates and deletes are
+// rejected with 412 (Precondition Failed) if If-Match doesn't match.  Returns false if a response has been written;
+// otherwise the returned context carries the Precondition.
+func (erh EasyResourceHandler) checkPreconditions(at resweave.ActionType, id string, ctx context.Context, writer response.Writer, r *http.Request) (context.Context, bool) {
+	versioner, ok := erh.versioner()
+	if !ok || (at != resweave.Fetch && at != resweave.Update && at != resweave.Delete) {
+		return ctx, true
+	}
+	funcName := "checkPreconditions"
+	ifMatch := r.Header.Get(header.IfMatch)
+	ifNoneMatch := r.Header.Get(header.IfNoneMatch)
+
+	if at != resweave.Fetch && ifMatch == "" && erh.options.requireIfMatch {
+		erh.NewError(funcName, errors.New("missing If-Match")).WithResource(erh.api.Name()).Log()
+		writer.WriteError(response.SvcErrorPreconditionRequired.WithDetail(header.IfMatch))
+		return ctx, false
+	}
+
+	version, err := versioner.Version(id, ctx)
+	if err != nil && !errors.Is(err, ErrNoSuchResource) {
+		erh.NewError(funcName, err).WithResource(erh.api.Name()).Log()
+		writer.WriteError(err)
+		return ctx, false
+	}
+	exists := err == nil
+	etag := response.FormatETag(version)
+
+	// If-Match requires an entity, which is how clients avoid recreating deleted entities
+	if ifMatch != "" && (!exists || !etagMatches(ifMatch, etag, false)) {
+		return ctx, erh.preconditionFailed(writer, header.IfMatch, etag, exists)
+	}
+	if ifNoneMatch != "" && exists && etagMatches(ifNoneMatch, etag, true) {
+		if at == resweave.Fetch {
+			writer.SetETag(etag).WriteResponse(http.StatusNotModified)
+			return ctx, false
+		}
+		return ctx, erh.preconditionFailed(writer, header.IfNoneMatch, etag, exists)
+	}
+
+	if !exists {
+		// let the resource method report it
+		return ctx, true
+	}
+	if at == resweave.Fetch {
+		writer.SetETag(etag)
+	}
+	return context.WithValue(ctx, preconditionKey{}, Precondition{Version: version, IfMatch: ifMatch, IfNoneMatch: ifNoneMatch}), true
+}
+
+// Writes 412 with the current ETag, so that the client can fetch the entity again; always returns false
+func (erh EasyResourceHandler) preconditionFailed(writer response.Writer, headerName string, etag string, exists bool) bool {
+	erh.NewError("checkPreconditions", ErrPreconditionFailed).WithResource(erh.api.Name()).With("header", headerName).Log()
+	if exists {
+		writer.SetETag(etag)
+	}
+	writer.WriteError(response.SvcErrorPreconditionFailed.WithDetail(headerName))
+	return false
+}
+
+
+// Checks an If-Match or If-None-Match list ("*" matches anything).  Weak comparison ignores the W/ prefix;
+// strong comparison never matches weak tags.
+func etagMatches(list string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
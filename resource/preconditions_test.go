@@ -0,0 +1,194 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/mortedecai/resweave"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// documents have versions; the methods record the precondition they were called with
+type versionedResource struct {
+	resweave.LogHolder
+
+	versions      map[string]string
+	versionErr    error
+	preconditions []Precondition
+}
+
+func (vr *versionedResource) Version(id string, _ context.Context) (string, error) {
+	if vr.versionErr != nil {
+		return "", vr.versionErr
+	}
+	version, found := vr.versions[id]
+	if !found {
+		return "", fmt.Errorf("%w: %s", ErrNoSuchResource, id)
+	}
+	return version, nil
+}
+
+func (vr *versionedResource) record(ctx context.Context, writer response.Writer) {
+	precondition, _ := PreconditionFrom(ctx)
+	vr.preconditions = append(vr.preconditions, precondition)
+	writer.WriteResponse(http.StatusOK)
+}
+
+func (vr *versionedResource) Fetch(_ string, ctx context.Context, writer response.Writer, _ *http.Request) {
+	vr.record(ctx, writer)
+}
+
+func (vr *versionedResource) Update(_ string, ctx context.Context, writer response.Writer, _ *http.Request) {
+	vr.record(ctx, writer)
+}
+
+func (vr *versionedResource) Delete(_ string, ctx context.Context, writer response.Writer, _ *http.Request) {
+	vr.record(ctx, writer)
+}
+
+var _ = Describe("Preconditions", func() {
+	var (
+		resource *versionedResource
+		handler  *EasyResourceHandler
+		serve    func(at resweave.ActionType, method string, id string, headers map[string]string) *http.Response
+	)
+	BeforeEach(func() {
+		resource = &versionedResource{LogHolder: resweave.NewLogholder("docs", nil), versions: map[string]string{"1": "v1", "2": `W/"v2"`}}
+		handler = NewResource("docs", resource)
+		serve = func(at resweave.ActionType, method string, id string, headers map[string]string) *http.Response {
+			req := httptest.NewRequest(method, "/docs/"+id, nil)
+			for name, value := range headers {
+				req.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			handler.handleResourceAction(at, context.WithValue(context.TODO(), resweave.Key("id_docs"), id), recorder, req)
+			return recorder.Result()
+		}
+	})
+
+	It("should send the version as the ETag of fetched entities", func() {
+		// Act
+		resp := serve(resweave.Fetch, http.MethodGet, "1", nil)
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get(header.ETag)).To(Equal(`"v1"`))
+		Expect(resource.preconditions).To(Equal([]Precondition{{Version: "v1"}}))
+	})
+
+	It("should match tags echoed back for versions that entity tags can't hold", func() {
+		// Arrange
+		resource.versions["3"] = `révision "3"`
+		etag := serve(resweave.Fetch, http.MethodGet, "3", nil).Header.Get(header.ETag)
+
+		// Act
+		resp := serve(resweave.Update, http.MethodPut, "3", map[string]string{header.IfMatch: etag})
+
+		// Assert
+		Expect(etag).To(MatchRegexp(`^"[A-Za-z0-9_-]+"$`))
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resource.preconditions[1]).To(Equal(Precondition{Version: `révision "3"`, IfMatch: etag}))
+	})
+
+	DescribeTable("should respond with 304 when If-None-Match matches",
+		func(id string, ifNoneMatch string) {
+			// Act
+			resp := serve(resweave.Fetch, http.MethodGet, id, map[string]string{header.IfNoneMatch: ifNoneMatch})
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(http.StatusNotModified))
+			Expect(resp.Header.Get(header.ETag)).ToNot(BeEmpty())
+			Expect(resource.preconditions).To(BeEmpty())
+		},
+		Entry("with the same tag", "1", `"v1"`),
+		Entry("with one of several tags", "1", `"v0", "v1"`),
+		Entry("with a weak tag", "1", `W/"v1"`),
+		Entry("for a weak version", "2", `"v2"`),
+		Entry("with any tag", "1", `*`),
+	)
+
+	It("should fetch entities when If-None-Match doesn't match", func() {
+		resp := serve(resweave.Fetch, http.MethodGet, "1", map[string]string{header.IfNoneMatch: `"v0"`})
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resource.preconditions).To(HaveLen(1))
+	})
+
+	DescribeTable("should check If-Match for changes",
+		func(at resweave.ActionType, method string, id string, ifMatch string, expectStatus int) {
+			// Act
+			resp := serve(at, method, id, map[string]string{header.IfMatch: ifMatch})
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(expectStatus))
+			if expectStatus == http.StatusOK {
+				Expect(resource.preconditions).To(Equal([]Precondition{{Version: resource.versions[id], IfMatch: ifMatch}}))
+			} else {
+				Expect(resource.preconditions).To(BeEmpty())
+				Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(response.SvcErrorPreconditionFailed))
+			}
+		},
+		Entry("with a matching tag", resweave.Update, http.MethodPut, "1", `"v1"`, http.StatusOK),
+		Entry("with one of several tags", resweave.Delete, http.MethodDelete, "1", `"v0", "v1"`, http.StatusOK),
+		Entry("with any tag", resweave.Update, http.MethodPatch, "1", `*`, http.StatusOK),
+		Entry("with an old tag", resweave.Update, http.MethodPut, "1", `"v0"`, http.StatusPreconditionFailed),
+		Entry("with a weak tag", resweave.Update, http.MethodPut, "1", `W/"v1"`, http.StatusPreconditionFailed),
+		Entry("for a weak version", resweave.Delete, http.MethodDelete, "2", `W/"v2"`, http.StatusPreconditionFailed),
+		Entry("for an entity that doesn't exist", resweave.Update, http.MethodPut, "3", `*`, http.StatusPreconditionFailed),
+	)
+
+	It("should send the current ETag when a precondition fails", func() {
+		resp := serve(resweave.Update, http.MethodPut, "1", map[string]string{header.IfMatch: `"v0"`})
+		Expect(resp.Header.Get(header.ETag)).To(Equal(`"v1"`))
+	})
+
+	It("should reject changes when If-None-Match matches", func() {
+		resp := serve(resweave.Update, http.MethodPut, "1", map[string]string{header.IfNoneMatch: `*`})
+		Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+		Expect(resource.preconditions).To(BeEmpty())
+	})
+
+	It("should only require If-Match when asked to", func() {
+		// Act & Assert
+		Expect(serve(resweave.Update, http.MethodPut, "1", nil).StatusCode).To(Equal(http.StatusOK))
+
+		// Arrange
+		handler.SetRequireIfMatch(true)
+
+		// Act
+		resp := serve(resweave.Delete, http.MethodDelete, "1", nil)
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusPreconditionRequired))
+		Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(response.SvcErrorPreconditionRequired))
+		Expect(serve(resweave.Fetch, http.MethodGet, "1", nil).StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("should let the resource method report entities that don't exist", func() {
+		resp := serve(resweave.Fetch, http.MethodGet, "3", nil)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get(header.ETag)).To(BeEmpty())
+		Expect(resource.preconditions).To(Equal([]Precondition{{}}))
+	})
+
+	It("should write errors getting the version", func() {
+		// Arrange
+		resource.versionErr = errors.New("database is on fire")
+
+		// Act
+		resp := serve(resweave.Fetch, http.MethodGet, "1", nil)
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(resource.preconditions).To(BeEmpty())
+	})
+
+	It("should write ErrPreconditionFailed as 412", func() {
+		Expect(response.StatusOf(response.MapError(ErrPreconditionFailed))).To(Equal(http.StatusPreconditionFailed))
+	})
+})
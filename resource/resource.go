@@ -5,9 +5,9 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/keithpaterson/resweave-utils/header"
 	"github.com/keithpaterson/resweave-utils/logging"
 	"github.com/keithpaterson/resweave-utils/response"
-	"github.com/keithpaterson/resweave-utils/utility/rw"
 	"github.com/mortedecai/resweave"
 	"go.uber.org/zap"
 )
@@ -18,16 +18,23 @@ var (
 	ErrNoSuchResource = errors.New("no such resource")
 )
 
+func init() {
+	response.RegisterErrorMapper(func(err error) response.ServiceError {
+		if errors.Is(err, ErrNoSuchResource) {
+			return response.SvcErrorResourceNotFound
+		}
+		return nil
+	})
+	response.RegisterErrorMapping(ErrInvalidPatch, response.SvcErrorInvalidPatch)
+	response.RegisterErrorMapping(ErrPatchFailed, response.SvcErrorPatchFailed)
+	response.RegisterErrorMapping(ErrPreconditionFailed, response.SvcErrorPreconditionFailed)
+}
+
+// Converts an error to a service error using the mappers registered with the response package;
+// unknown errors are treated as request failures.
 func ToServiceError(err error) response.ServiceError {
-	// Brute-force but a lookup table and Unwrap wasn't working so ...
-	if errors.Is(err, rw.ErrorNoData) {
-		return response.SvcErrorReadRequestFailed.WithError(err)
-	}
-	if errors.Is(err, rw.ErrorJsonUnmarshalFailed) {
-		return response.SvcErrorJsonUnmarshalFailed.WithError(err)
-	}
-	if errors.Is(err, ErrNoSuchResource) {
-		return response.SvcErrorInvalidResourceId
+	if svcErr, found := response.LookupError(err); found {
+		return svcErr
 	}
 	// for lack of a better default ...
 	return response.SvcErrorReadRequestFailed.WithError(err)
@@ -40,12 +47,25 @@ func ToServiceError(err error) response.ServiceError {
 //	Fetch(string, context.Context, response.Writer, *http.Request)
 //	Delete(string, context.Context, response.Writer, *http.Request)
 //	Update(string, context.Context, response.Writer, *http.Request)
+//	Replace(string, context.Context, response.Writer, *http.Request)
+//	Patch(string, context.Context, response.Writer, *http.Request)
 //
 // If any method is not implemented the resource's action handler will automatically
 // return an error response indicating that the action is invalid.
 //
 // Create and List do not require an id
 // Fetch, Delete, and Update require an id (as a string) and are expected to validate the id
+//
+// Update handles both PUT and PATCH; to tell a full replacement from a partial update implement Replace (PUT)
+// and/or Patch (PATCH) instead, which take precedence over Update.  See ApplyPatch for help with patches.
+//
+// Resources can also support optimistic concurrency by implementing
+//
+//	Version(string, context.Context) (string, error)
+//
+// which returns the current version of an entity (or ErrNoSuchResource).  The version is sent as the ETag of Fetch
+// responses, GET requests with a matching If-None-Match get 304 (Not Modified), and updates and deletes with an
+// If-Match that doesn't match are rejected with 412 (Precondition Failed); see SetRequireIfMatch and Precondition.
 type EasyResource interface {
 	resweave.LogHolder
 }
@@ -58,6 +78,17 @@ type EasyResourceHandler struct {
 	resource        EasyResource // the object implementing Create, List, etc.
 	acceptedMethods acceptedMethodsMap
 	validations     validationFuncMap
+	options         *handlerOptions // shared with the handler registered with resweave
+	tree            *resourceTree
+	actions         customActionMap
+}
+
+type handlerOptions struct {
+	requireIfMatch bool
+	idempotency    *idempotencyOptions
+	list           *ListOptions
+	id             resweave.ID     // the pattern set with SetID
+	server         resweave.Server // set once the resource has been added to it
 }
 
 func NewResource(name resweave.ResourceName, resource EasyResource) *EasyResourceHandler {
@@ -73,6 +104,9 @@ func NewResource(name resweave.ResourceName, resource EasyResource) *EasyResourc
 		resource:        resource,
 		acceptedMethods: make(acceptedMethodsMap),
 		validations:     make(validationFuncMap),
+		options:         &handlerOptions{},
+		tree:            &resourceTree{children: make(map[resweave.ResourceName]*EasyResourceHandler)},
+		actions:         make(customActionMap),
 	}
 	for id := range acceptedMethods {
 		erh.setAcceptedMethods(id, nil)
@@ -91,11 +125,17 @@ func (erh EasyResourceHandler) Name() resweave.ResourceName {
 	return erh.api.Name()
 }
 
+// Custom actions that require an id widen the pattern to allow their suffix (see AddAction)
 func (erh EasyResourceHandler) SetID(id resweave.ID) error {
-	return erh.api.SetID(id)
+	erh.options.id = id
+	return erh.applyID()
 }
 
+// For nested resources (see AddChild) this is the resource's id in the path
 func (erh EasyResourceHandler) GetIDValue(ctx context.Context) (string, error) {
+	if id, found := ctx.Value(nestedIDKey{}).(string); found {
+		return id, nil
+	}
 	return erh.api.GetIDValue(ctx)
 }
 
@@ -121,11 +161,35 @@ type easyUpdater interface {
 	Update(id string, ctx context.Context, writer response.Writer, req *http.Request)
 }
 
+type easyVersioner interface {
+	Version(id string, ctx context.Context) (string, error)
+}
+
+type easyReplacer interface {
+	Replace(id string, ctx context.Context, writer response.Writer, req *http.Request)
+}
+
+type easyPatcher interface {
+	Patch(id string, ctx context.Context, writer response.Writer, req *http.Request)
+}
+
 func (erh EasyResourceHandler) AddEasyResource(s resweave.Server) error {
 	if s == nil {
 		return ErrNilServer
 	}
-	return s.AddResource(erh.api)
+	if erh.tree.parent != nil {
+		return ErrNotRootResource
+	}
+	if err := s.AddResource(erh.api); err != nil {
+		return err
+	}
+	erh.options.server = s
+	for _, action := range erh.actions {
+		if err := erh.addActionResource(action); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // By default an Update can be either Put or Patch; both are supported.
@@ -160,15 +224,28 @@ var (
 	}
 )
 
-type validationFuncMap map[resweave.ActionType]easyValidateFunc
+type validationFuncMap map[resweave.ActionType]ValidateFunc
 
-// used internally as a means to perform validations/processing specific to a particular
-// resource action.
+// Performs validations/processing specific to a particular resource action, before the resource's method is called
+// (see SetValidator).
 //
 // returns an http status code and an optional service error if something went wrong
 //
 // status code won't be used except when an error is being reported.
-type easyValidateFunc func(context.Context, response.Writer, *http.Request) (int, response.ServiceError)
+type ValidateFunc func(context.Context, response.Writer, *http.Request) (int, response.ServiceError)
+
+// Set the validator for an action; nil removes it.
+//
+// e.g. to reject invalid bodies before Create is called (see ValidateBody and Validate):
+//
+//	erh.SetValidator(resweave.Create, resource.ValidateBody[Foo]())
+func (erh EasyResourceHandler) SetValidator(at resweave.ActionType, validate ValidateFunc) {
+	if validate == nil {
+		delete(erh.validations, at)
+		return
+	}
+	erh.validations[at] = validate
+}
 
 func (erh EasyResourceHandler) setAcceptedMethods(at resweave.ActionType, accept methodAcceptance) {
 	if accept == nil {
@@ -184,15 +261,52 @@ func (erh EasyResourceHandler) handleResourceAction(at resweave.ActionType, ctx
 	erh.NewInfo(funcName, "Starting").Log()
 	defer erh.NewInfo(funcName, "Completed").Log()
 
+	// so that every writer made for this response shares its state
+	w = response.NewWriter(w).ResponseWriter()
+
+	// requests for child resources and custom actions are passed on
+	routed, svcErr := erh.route(ctx, r)
+	if svcErr != nil {
+		response.NewWriter(w).WithRequest(r).WriteError(svcErr)
+		return
+	}
+	if routed != nil {
+		routed.serve(ctx, w, r)
+		return
+	}
+	erh.handleAction(requestAction{at: at}, ctx, w, r)
+}
+
+// What a request is for: one of resweave's actions, or a custom action (see AddAction)
+type requestAction struct {
+	at     resweave.ActionType
+	custom *CustomAction
+}
+
+func (ra requestAction) String() string {
+	if ra.custom != nil {
+		return ra.custom.Name
+	}
+	return ra.at.String()
+}
+
+func (ra requestAction) validator(validations validationFuncMap) ValidateFunc {
+	if ra.custom != nil {
+		return ra.custom.Validate
+	}
+	return validations[ra.at]
+}
+
+func (erh EasyResourceHandler) handleAction(ra requestAction, ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	// make a writer
-	writer := response.NewWriter(w)
+	writer := response.NewWriter(w).WithRequest(r)
 
 	// validations
-	if status, err := erh.standardValidations(at, r); err != nil {
+	if status, err := erh.standardValidations(ra, r); err != nil {
 		writer.WriteErrorResponse(status, err)
 		return
 	}
-	if validateFn := erh.validations[at]; validateFn != nil {
+	if validateFn := ra.validator(erh.validations); validateFn != nil {
 		if status, err := validateFn(ctx, writer, r); err != nil {
 			writer.WriteErrorResponse(status, err)
 			return
@@ -200,25 +314,42 @@ func (erh EasyResourceHandler) handleResourceAction(at resweave.ActionType, ctx
 	}
 
 	// Since we prevalidated whether the function is implemented we know we can call it based on the value of at
-	erh.NewInfo(at.String(), "Starting").Log()
-	defer erh.NewInfo(at.String(), "Completed").Log()
+	erh.NewInfo(ra.String(), "Starting").Log()
+	defer erh.NewInfo(ra.String(), "Completed").Log()
+
+	if ra.custom != nil {
+		ra.custom.Handler(ctx, writer, r)
+		return
+	}
 
 	// try to call non-id methods first:
+	at := ra.at
 	switch at {
 	case resweave.Create:
+		if erh.options.idempotency != nil && r.Header.Get(header.IdempotencyKey) != "" {
+			erh.createIdempotently(ctx, w, r)
+			return
+		}
 		erh.resource.(easyCreator).Create(ctx, writer, r)
 		return
 	case resweave.List:
+		if erh.options.list != nil {
+			ctx = context.WithValue(ctx, listOptionsKey{}, *erh.options.list)
+		}
 		erh.resource.(easyLister).List(ctx, writer, r)
 		return
 	}
 
 	// try to call id methods with an error if id is missing
-	id, err := erh.api.GetIDValue(ctx)
+	id, err := erh.GetIDValue(ctx)
 	if err != nil {
 		writer.WriteErrorResponse(http.StatusBadRequest, response.SvcErrorInvalidResourceId)
 		return
 	}
+	ctx, ok := erh.checkPreconditions(at, id, ctx, writer, r)
+	if !ok {
+		return
+	}
 	switch at {
 	case resweave.Fetch:
 		erh.resource.(easyFetcher).Fetch(id, ctx, writer, r)
@@ -227,38 +358,80 @@ func (erh EasyResourceHandler) handleResourceAction(at resweave.ActionType, ctx
 		erh.resource.(easyDeleter).Delete(id, ctx, writer, r)
 		return
 	case resweave.Update:
-		erh.resource.(easyUpdater).Update(id, ctx, writer, r)
+		erh.update(id, ctx, writer, r)
 		return
 	}
 }
 
-func (erh EasyResourceHandler) standardValidations(at resweave.ActionType, r *http.Request) (int, response.ServiceError) {
+// PUT goes to Replace and PATCH to Patch if the resource implements them; otherwise both go to Update
+func (erh EasyResourceHandler) update(id string, ctx context.Context, writer response.Writer, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		if replacer, ok := erh.resource.(easyReplacer); ok {
+			replacer.Replace(id, ctx, writer, r)
+			return
+		}
+	case http.MethodPatch:
+		if patcher, ok := erh.resource.(easyPatcher); ok {
+			patcher.Patch(id, ctx, writer, r)
+			return
+		}
+	}
+	erh.resource.(easyUpdater).Update(id, ctx, writer, r)
+}
+
+func (erh EasyResourceHandler) standardValidations(ra requestAction, r *http.Request) (int, response.ServiceError) {
 	// for now we don't need context or writer, but as we add more common validations we can add them in
 	funcName := "standardValidations"
 
+	// custom actions are always implemented, by their handler
+	if ra.custom != nil {
+		if !ra.custom.accepted[r.Method] {
+			return erh.invalidMethod(funcName, r.Method, ra.custom.Methods)
+		}
+		return 0, nil
+	}
+	at := ra.at
+
 	if !erh.validateActionImplemented(at) {
 		erh.NewError(funcName, errors.New("not implemented")).With("action", erh.api.Name()).Log()
 		return http.StatusMethodNotAllowed, response.SvcErrorNoRegisteredMethod
 	}
 
 	if !erh.validateAcceptedMethods(at, r.Method) {
-		erh.NewErrorMessage(funcName, errors.New("bad method"), r.Method).WithResource(erh.api.Name()).With("Accepted Methods", acceptedMethods[at]).Log()
-		return http.StatusMethodNotAllowed, response.SvcErrorInvalidMethod.WithDetail(r.Method)
+		return erh.invalidMethod(funcName, r.Method, erh.acceptedMethods[at])
+	}
+
+	if !erh.validateMethodImplemented(at, r.Method) {
+		erh.NewErrorMessage(funcName, errors.New("not implemented"), r.Method).WithResource(erh.api.Name()).Log()
+		return http.StatusMethodNotAllowed, response.SvcErrorNoRegisteredMethod.WithDetail(r.Method)
 	}
 
 	// if everything is considered ok then just return no error; status code isn't important in the success case
 	return 0, nil
 }
 
+func (erh EasyResourceHandler) invalidMethod(funcName string, method string, accepted interface{}) (int, response.ServiceError) {
+	erh.NewErrorMessage(funcName, errors.New("bad method"), method).WithResource(erh.api.Name()).With("Accepted Methods", accepted).Log()
+	return http.StatusMethodNotAllowed, response.SvcErrorInvalidMethod.WithDetail(method)
+}
+
 func (erh EasyResourceHandler) validateAcceptedMethods(at resweave.ActionType, method string) bool {
-	_, found := erh.acceptedMethods[at][method]
-	return found
+	return erh.acceptedMethods[at][method]
+}
+
+// Implemented by adapters (e.g. for typed resources) that have every EasyResource method but don't support every action
+type actionImplementer interface {
+	implements(at resweave.ActionType) bool
 }
 
 func (erh EasyResourceHandler) validateActionImplemented(at resweave.ActionType) bool {
 	if erh.resource == nil {
 		return false
 	}
+	if impl, ok := erh.resource.(actionImplementer); ok {
+		return impl.implements(at)
+	}
 
 	found := false
 	switch at {
@@ -272,7 +445,39 @@ func (erh EasyResourceHandler) validateActionImplemented(at resweave.ActionType)
 		_, found = erh.resource.(easyDeleter)
 	case resweave.Update:
 		_, found = erh.resource.(easyUpdater)
+		if !found {
+			_, replaces := erh.resource.(easyReplacer)
+			_, patches := erh.resource.(easyPatcher)
+			found = replaces || patches
+		}
+	}
+
+	return found
+}
+
+// Implemented by adapters that support some of an action's methods (e.g. PUT but not PATCH)
+type methodImplementer interface {
+	implementsMethod(at resweave.ActionType, method string) bool
+}
+
+// An Update is implemented for a method if Update, or the method's own hook (Replace or Patch), is implemented
+func (erh EasyResourceHandler) validateMethodImplemented(at resweave.ActionType, method string) bool {
+	if impl, ok := erh.resource.(methodImplementer); ok {
+		return impl.implementsMethod(at, method)
+	}
+	if at != resweave.Update {
+		return true
+	}
+	if _, ok := erh.resource.(easyUpdater); ok {
+		return true
 	}
 
+	found := false
+	switch method {
+	case http.MethodPut:
+		_, found = erh.resource.(easyReplacer)
+	case http.MethodPatch:
+		_, found = erh.resource.(easyPatcher)
+	}
 	return found
 }
@@ -59,6 +59,37 @@ func (ter *testEasyResource) Update(id string, _ context.Context, writer respons
 	writer.WriteResponse(http.StatusOK)
 }
 
+// implements Update and Patch, or only Replace
+type testUpdateHooksResource struct {
+	resweave.LogHolder
+
+	hooks []string
+}
+
+func (r *testUpdateHooksResource) record(hook string, writer response.Writer) {
+	r.hooks = append(r.hooks, hook)
+	writer.WriteResponse(http.StatusOK)
+}
+
+type testPatchingResource struct {
+	testUpdateHooksResource
+}
+
+func (r *testPatchingResource) Update(_ string, _ context.Context, writer response.Writer, _ *http.Request) {
+	r.record("Update", writer)
+}
+func (r *testPatchingResource) Patch(_ string, _ context.Context, writer response.Writer, _ *http.Request) {
+	r.record("Patch", writer)
+}
+
+type testReplacingResource struct {
+	testUpdateHooksResource
+}
+
+func (r *testReplacingResource) Replace(_ string, _ context.Context, writer response.Writer, _ *http.Request) {
+	r.record("Replace", writer)
+}
+
 var _ = Describe("Test EasyResource", func() {
 	Context("Accepted Methods", func() {
 		DescribeTable("Defaults",
@@ -103,6 +134,17 @@ var _ = Describe("Test EasyResource", func() {
 			Entry(nil, false, true),
 			Entry(nil, false, false),
 		)
+		It("should reject methods that aren't accepted", func() {
+			// Arrange
+			erh := NewResource("test", nil)
+
+			// Act
+			erh.SetUpdateAcceptedMethods(true, false)
+
+			// Assert
+			Expect(erh.validateAcceptedMethods(resweave.Update, http.MethodPut)).To(BeTrue())
+			Expect(erh.validateAcceptedMethods(resweave.Update, http.MethodPatch)).To(BeFalse())
+		})
 		It("should reset acceptance to defaults if set to nil", func() {
 			// Arrange
 			erh := NewResource("test", nil)
@@ -244,6 +286,34 @@ var _ = Describe("Test EasyResource", func() {
 			Entry(resweave.Delete.String(), resweave.Delete, http.MethodDelete, "1"),
 			Entry(resweave.Update.String(), resweave.Update, http.MethodPut, "1"),
 		)
+		DescribeTable("should call the update hook for the method",
+			func(patching bool, method string, expectStatus int, expectHooks []string) {
+				// Arrange
+				hooks := testUpdateHooksResource{LogHolder: resweave.NewLogholder("test", nil)}
+				var resource EasyResource
+				var recorded *[]string
+				if patching {
+					patcher := &testPatchingResource{hooks}
+					resource, recorded = patcher, &patcher.hooks
+				} else {
+					replacer := &testReplacingResource{hooks}
+					resource, recorded = replacer, &replacer.hooks
+				}
+				req, err := http.NewRequest(method, "/test/1", nil)
+				Expect(err).ToNot(HaveOccurred())
+
+				// Act
+				NewResource("test", resource).handleResourceAction(resweave.Update, context.WithValue(ctx, resweave.Key("id_test"), "1"), recorder, req)
+
+				// Assert
+				Expect(recorder.Result().StatusCode).To(Equal(expectStatus))
+				Expect(*recorded).To(Equal(expectHooks))
+			},
+			Entry("with Patch", true, http.MethodPatch, http.StatusOK, []string{"Patch"}),
+			Entry("falling back to Update", true, http.MethodPut, http.StatusOK, []string{"Update"}),
+			Entry("with Replace", false, http.MethodPut, http.StatusOK, []string{"Replace"}),
+			Entry("without a hook for the method", false, http.MethodPatch, http.StatusMethodNotAllowed, []string(nil)),
+		)
 		It("should respond with an error if ID is invalid", func() {
 			// Arrange
 			req, err := http.NewRequest(http.MethodDelete, "/test/1", nil)
@@ -283,6 +353,24 @@ var _ = Describe("Test EasyResource", func() {
 			Expect(res.resource.(*testEasyResource).calls).To(BeEmpty())
 			Expect(err).To(MatchError(response.SvcErrorInvalidMethod))
 		})
+		It("should reject PATCH when updates only accept PUT", func() {
+			// Arrange
+			res.SetUpdateAcceptedMethods(true, false)
+			ctx := context.WithValue(ctx, resweave.Key("id_test"), "1")
+			req, err := http.NewRequest(http.MethodPatch, "/test/1", nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			res.handleResourceAction(resweave.Update, ctx, recorder, req)
+
+			// Assert
+			resp := recorder.Result()
+			defer resp.Body.Close()
+
+			Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+			Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(response.SvcErrorInvalidMethod))
+			Expect(res.resource.(*testEasyResource).calls).To(BeEmpty())
+		})
 
 		type validatorResponse struct {
 			status int
@@ -377,7 +465,9 @@ var _ = Describe("Test EasyResource", func() {
 			Expect(actual).To(Equal(expect))
 		},
 		Entry(nil, rw.ErrorNoData, response.SvcErrorReadRequestFailed.WithError(rw.ErrorNoData)),
-		Entry(nil, rw.ErrorJsonUnmarshalFailed, response.SvcErrorJsonUnmarshalFailed.WithError(rw.ErrorNoData)),
+		Entry(nil, rw.ErrorJsonUnmarshalFailed, response.SvcErrorJsonUnmarshalFailed.WithError(rw.ErrorJsonUnmarshalFailed)),
+		Entry(nil, rw.ErrorUnmarshalFailed, response.SvcErrorUnmarshalFailed.WithError(rw.ErrorUnmarshalFailed)),
+		Entry(nil, fmt.Errorf("%w: 123", ErrNoSuchResource), response.SvcErrorResourceNotFound),
 		Entry(nil, errors.New("default"), response.SvcErrorReadRequestFailed.WithError(errors.New("default"))),
 	)
 })
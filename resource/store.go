@@ -0,0 +1,166 @@
+package resource
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+var (
+	ErrStoreFailed = errors.New("store failed")
+)
+
+// Keeps the entities of a store resource (see NewStoreResource).
+//
+// Stores assign the ids of new entities, and return ErrNoSuchResource for ids they don't have.
+type Store[T any, ID ResourceID] interface {
+	IDOf(entity T) ID
+	// Add a new entity, assigning its id
+	Insert(ctx context.Context, entity T) (T, error)
+	List(ctx context.Context) ([]T, error)
+	Get(ctx context.Context, id ID) (T, error)
+	// Replace an existing entity; the entity's id is set to id
+	Replace(ctx context.Context, id ID, entity T) (T, error)
+	Delete(ctx context.Context, id ID) error
+}
+
+// How a store reads and assigns the ids of its entities
+type Identity[T any, ID ResourceID] struct {
+	Get func(T) ID
+	Set func(T, ID) T // returns the entity with its id set
+}
+
+// A concurrent-safe store that keeps entities in memory, in the order they were inserted.
+//
+// Integer ids are assigned in sequence, starting at 1; string ids are random.
+type MemoryStore[T any, ID ResourceID] struct {
+	identity Identity[T, ID]
+
+	mtx      sync.RWMutex
+	entities map[ID]T
+	order    []ID
+	sequence int64
+}
+
+func NewMemoryStore[T any, ID ResourceID](identity Identity[T, ID]) *MemoryStore[T, ID] {
+	return &MemoryStore[T, ID]{identity: identity, entities: make(map[ID]T)}
+}
+
+func (s *MemoryStore[T, ID]) IDOf(entity T) ID {
+	return s.identity.Get(entity)
+}
+
+func (s *MemoryStore[T, ID]) Insert(_ context.Context, entity T) (T, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	entity = s.identity.Set(entity, s.nextID())
+	s.put(entity)
+	return entity, nil
+}
+
+func (s *MemoryStore[T, ID]) List(_ context.Context) ([]T, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.list(), nil
+}
+
+func (s *MemoryStore[T, ID]) Get(_ context.Context, id ID) (T, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	entity, found := s.entities[id]
+	if !found {
+		return entity, noSuchResource(id)
+	}
+	return entity, nil
+}
+
+func (s *MemoryStore[T, ID]) Replace(_ context.Context, id ID, entity T) (T, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, found := s.entities[id]; !found {
+		var zero T
+		return zero, noSuchResource(id)
+	}
+	entity = s.identity.Set(entity, id)
+	s.entities[id] = entity
+	return entity, nil
+}
+
+func (s *MemoryStore[T, ID]) Delete(_ context.Context, id ID) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, found := s.entities[id]; !found {
+		return noSuchResource(id)
+	}
+	s.remove(id)
+	return nil
+}
+
+// the following must be called with the lock held
+
+func (s *MemoryStore[T, ID]) list() []T {
+	entities := make([]T, 0, len(s.order))
+	for _, id := range s.order {
+		entities = append(entities, s.entities[id])
+	}
+	return entities
+}
+
+// adds or replaces an entity, keeping the sequence ahead of its id
+func (s *MemoryStore[T, ID]) put(entity T) {
+	id := s.identity.Get(entity)
+	if _, found := s.entities[id]; !found {
+		s.order = append(s.order, id)
+	}
+	s.entities[id] = entity
+
+	value := reflect.ValueOf(id)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		s.sequence = max(s.sequence, value.Int())
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		s.sequence = max(s.sequence, int64(value.Uint()))
+	}
+}
+
+func (s *MemoryStore[T, ID]) remove(id ID) {
+	delete(s.entities, id)
+	s.order = slices.DeleteFunc(s.order, func(other ID) bool { return other == id })
+}
+
+func (s *MemoryStore[T, ID]) nextID() ID {
+	var id ID
+	value := reflect.ValueOf(&id).Elem()
+	switch value.Kind() {
+	case reflect.String:
+		for {
+			value.SetString(randomID())
+			if _, found := s.entities[id]; !found {
+				return id
+			}
+		}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		s.sequence++
+		value.SetInt(s.sequence)
+	default:
+		s.sequence++
+		value.SetUint(uint64(s.sequence))
+	}
+	return id
+}
+
+func randomID() string {
+	id := make([]byte, 16)
+	// crypto/rand.Read never returns an error on supported platforms
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func noSuchResource[ID ResourceID](id ID) error {
+	return fmt.Errorf("%w: %s", ErrNoSuchResource, FormatID(id))
+}
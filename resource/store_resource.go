@@ -0,0 +1,182 @@
+package resource
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/mortedecai/resweave"
+)
+
+// Make a resource handler that keeps its entities in a store, e.g.
+//
+//	store := resource.NewMemoryStore(resource.Identity[Widget, int]{
+//	  Get: func(w Widget) int { return w.ID },
+//	  Set: func(w Widget, id int) Widget { w.ID = id; return w },
+//	})
+//	handler := resource.NewStoreResource[Widget, int]("widgets", store)
+//
+// It supports every action: the store assigns the ids of created entities, unknown ids are reported as
+// ErrNoSuchResource, and PATCH requests are patches (see ApplyPatch).  Bodies are validated (see Validate).  Lists
+// are filtered, sorted and paged by the entities' JSON members (see queryEntities).
+func NewStoreResource[T any, ID ResourceID](name resweave.ResourceName, store Store[T, ID]) *EasyResourceHandler {
+	return NewTypedResource[T, ID](name, &storeResource[T, ID]{
+		LogHolder: resweave.NewLogholder(string(name), nil),
+		store:     store,
+	})
+}
+
+// A typed resource that implements every action with a store
+type storeResource[T any, ID ResourceID] struct {
+	resweave.LogHolder
+
+	store Store[T, ID]
+}
+
+func (r *storeResource[T, ID]) IDOf(entity T) ID {
+	return r.store.IDOf(entity)
+}
+
+func (r *storeResource[T, ID]) Create(ctx context.Context, entity T) (T, error) {
+	return r.store.Insert(ctx, entity)
+}
+
+func (r *storeResource[T, ID]) List(ctx context.Context, query ListQuery) ([]T, error) {
+	entities, err := r.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return queryEntities(entities, query)
+}
+
+func (r *storeResource[T, ID]) Fetch(ctx context.Context, id ID) (T, error) {
+	return r.store.Get(ctx, id)
+}
+
+func (r *storeResource[T, ID]) Update(ctx context.Context, id ID, entity T) (T, error) {
+	return r.store.Replace(ctx, id, entity)
+}
+
+func (r *storeResource[T, ID]) Delete(ctx context.Context, id ID) error {
+	return r.store.Delete(ctx, id)
+}
+
+// An entity and its JSON members, which list queries refer to
+type queriedEntity[T any] struct {
+	entity  T
+	members map[string]interface{}
+}
+
+// Applies a list query to every entity: equality filters (eq, ne and in), then the sort, offset and limit.  The other
+// filters and cursors need to know more about the entities than their JSON, so they are rejected with
+// response.SvcErrorInvalidQuery.
+func queryEntities[T any](entities []T, query ListQuery) ([]T, error) {
+	var violations []response.FieldViolation
+	for _, filter := range query.Filters {
+		if filter.Op != FilterEq && filter.Op != FilterNe && filter.Op != FilterIn {
+			violations = append(violations, response.FieldViolation{Field: filter.Field, Reason: fmt.Sprintf("can't filter with %s", filter.Op), Value: filter.Value()})
+		}
+	}
+	if query.Cursor != "" {
+		violations = append(violations, response.FieldViolation{Field: response.CursorParam, Reason: "isn't supported; use offset", Value: query.Cursor})
+	}
+	if len(violations) > 0 {
+		return nil, response.SvcErrorInvalidQuery.WithFieldViolations(violations...)
+	}
+
+	queried := make([]queriedEntity[T], 0, len(entities))
+	for _, entity := range entities {
+		raw, err := json.Marshal(entity)
+		if err != nil {
+			return nil, response.SvcErrorJsonMarshalFailed.WithError(err)
+		}
+		var value interface{}
+		if err = unmarshalJsonValue(raw, &value); err != nil {
+			return nil, response.SvcErrorJsonMarshalFailed.WithError(err)
+		}
+		members, _ := value.(map[string]interface{})
+		if matchesFilters(members, query.Filters) {
+			queried = append(queried, queriedEntity[T]{entity: entity, members: members})
+		}
+	}
+
+	slices.SortStableFunc(queried, func(a, b queriedEntity[T]) int {
+		for _, sort := range query.Sort {
+			order := compareMembers(a.members[sort.Field], b.members[sort.Field])
+			if sort.Descending {
+				order = -order
+			}
+			if order != 0 {
+				return order
+			}
+		}
+		return 0
+	})
+
+	start := min(query.Offset, len(queried))
+	end := len(queried)
+	if query.Limit > 0 {
+		end = min(start+query.Limit, end)
+	}
+	results := make([]T, 0, end-start)
+	for _, item := range queried[start:end] {
+		results = append(results, item.entity)
+	}
+	return results, nil
+}
+
+func matchesFilters(members map[string]interface{}, filters []Filter) bool {
+	for _, filter := range filters {
+		text := memberText(members[filter.Field])
+		switch filter.Op {
+		case FilterEq:
+			if text != filter.Value() {
+				return false
+			}
+		case FilterNe:
+			if text == filter.Value() {
+				return false
+			}
+		case FilterIn:
+			if !slices.Contains(filter.Values, text) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// The member as it would be written in a query, e.g. 7, true or bolt
+func memberText(member interface{}) string {
+	switch value := member.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	raw, _ := json.Marshal(member)
+	return string(raw)
+}
+
+// Numbers are compared as numbers, and everything else by its text; missing members come first
+func compareMembers(a interface{}, b interface{}) int {
+	if aNumber, ok := a.(json.Number); ok {
+		if bNumber, ok := b.(json.Number); ok {
+			aFloat, aErr := aNumber.Float64()
+			bFloat, bErr := bNumber.Float64()
+			if aErr == nil && bErr == nil {
+				return cmp.Compare(aFloat, bFloat)
+			}
+		}
+	}
+	return strings.Compare(memberText(a), memberText(b))
+}
@@ -0,0 +1,153 @@
+package resource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/mortedecai/resweave"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type part struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name" validate:"required"`
+	Quantity int    `json:"quantity" validate:"min=0"`
+}
+
+var _ = Describe("Store Resources", func() {
+	var (
+		store *MemoryStore[part, int]
+		serve func(at resweave.ActionType, method string, id string, body string) *http.Response
+		list  func(query string) *http.Response
+	)
+	BeforeEach(func() {
+		store = NewMemoryStore(Identity[part, int]{
+			Get: func(p part) int { return p.ID },
+			Set: func(p part, id int) part { p.ID = id; return p },
+		})
+		handler := NewStoreResource[part, int]("parts", store)
+		serve = func(at resweave.ActionType, method string, id string, body string) *http.Response {
+			target := "/parts"
+			if id != "" {
+				target += "/" + id
+			}
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			if body != "" {
+				req.Header.Set(header.ContentType, header.MimeTypeJson)
+			}
+			ctx := context.WithValue(context.TODO(), resweave.Key("id_parts"), id)
+			recorder := httptest.NewRecorder()
+			handler.handleResourceAction(at, ctx, recorder, req)
+			return recorder.Result()
+		}
+		list = func(query string) *http.Response {
+			recorder := httptest.NewRecorder()
+			handler.handleResourceAction(resweave.List, context.TODO(), recorder, httptest.NewRequest(http.MethodGet, "/parts?"+query, nil))
+			return recorder.Result()
+		}
+	})
+
+	It("should support every action", func() {
+		// Create
+		resp := serve(resweave.Create, http.MethodPost, "", `{"name":"bolt","quantity":10}`)
+		var created part
+		Expect(response.ParseResponseJsonData(resp, http.StatusCreated, &created)).To(Succeed())
+		Expect(created).To(Equal(part{ID: 1, Name: "bolt", Quantity: 10}))
+		Expect(resp.Header.Get(header.Location)).To(Equal("/parts/1"))
+
+		// Patch
+		resp = serve(resweave.Update, http.MethodPatch, "1", `{"quantity":8}`)
+		var patched part
+		Expect(response.ParseResponseJsonData(resp, http.StatusOK, &patched)).To(Succeed())
+		Expect(patched).To(Equal(part{ID: 1, Name: "bolt", Quantity: 8}))
+
+		// Update
+		resp = serve(resweave.Update, http.MethodPut, "1", `{"name":"nut"}`)
+		var updated part
+		Expect(response.ParseResponseJsonData(resp, http.StatusOK, &updated)).To(Succeed())
+		Expect(updated).To(Equal(part{ID: 1, Name: "nut"}))
+
+		// Fetch
+		resp = serve(resweave.Fetch, http.MethodGet, "1", "")
+		var fetched part
+		Expect(response.ParseResponseJsonData(resp, http.StatusOK, &fetched)).To(Succeed())
+		Expect(fetched).To(Equal(updated))
+
+		// List
+		resp = serve(resweave.List, http.MethodGet, "", "")
+		var parts []part
+		Expect(response.ParseResponseJsonData(resp, http.StatusOK, &parts)).To(Succeed())
+		Expect(parts).To(Equal([]part{updated}))
+
+		// Delete
+		resp = serve(resweave.Delete, http.MethodDelete, "1", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(store.List(context.TODO())).To(BeEmpty())
+	})
+
+	DescribeTable("should filter, sort and page lists",
+		func(query string, expectIDs []int) {
+			// Arrange
+			for _, p := range []part{{Name: "bolt", Quantity: 10}, {Name: "nut", Quantity: 2}, {Name: "washer", Quantity: 10}, {Name: "screw", Quantity: 5}} {
+				_, _ = store.Insert(context.TODO(), p)
+			}
+
+			// Act
+			resp := list(query)
+
+			// Assert
+			var parts []part
+			Expect(response.ParseResponseJsonData(resp, http.StatusOK, &parts)).To(Succeed())
+			ids := make([]int, len(parts))
+			for index, p := range parts {
+				ids[index] = p.ID
+			}
+			Expect(ids).To(Equal(expectIDs))
+		},
+		Entry("with no query", "", []int{1, 2, 3, 4}),
+		Entry("with a filter", "quantity=10", []int{1, 3}),
+		Entry("with a not-equal filter", "name!=nut", []int{1, 3, 4}),
+		Entry("with an in filter", "name[in]=nut,screw", []int{2, 4}),
+		Entry("sorted by number", "sort=quantity,-name", []int{2, 4, 3, 1}),
+		Entry("sorted by text, descending", "sort=-name", []int{3, 4, 2, 1}),
+		Entry("with a limit and offset", "sort=name&limit=2&offset=1", []int{2, 4}),
+		Entry("with an offset past the end", "offset=10", []int{}),
+		Entry("with everything", "quantity!=2&sort=-quantity,name&limit=2", []int{1, 3}),
+	)
+
+	DescribeTable("should reject list queries that stores can't answer",
+		func(query string) {
+			// Act
+			resp := list(query)
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(response.SvcErrorInvalidQuery))
+		},
+		Entry("with a range filter", "quantity>5"),
+		Entry("with a cursor", "cursor=abc"),
+	)
+
+	DescribeTable("should write errors",
+		func(at resweave.ActionType, method string, id string, body string, expectStatus int, expectErr error) {
+			// Arrange
+			_, _ = store.Insert(context.TODO(), part{Name: "bolt"})
+
+			// Act
+			resp := serve(at, method, id, body)
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(expectStatus))
+			Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(expectErr))
+		},
+		Entry("with an unknown id", resweave.Fetch, http.MethodGet, "2", "", http.StatusNotFound, response.SvcErrorResourceNotFound),
+		Entry("when replacing an unknown id", resweave.Update, http.MethodPut, "2", `{"name":"nut"}`, http.StatusNotFound, response.SvcErrorResourceNotFound),
+		Entry("with an invalid entity", resweave.Create, http.MethodPost, "", `{"quantity":1}`, http.StatusUnprocessableEntity, response.SvcErrorValidationFailed),
+		Entry("with a patch that makes the entity invalid", resweave.Update, http.MethodPatch, "1", `{"name":null}`, http.StatusUnprocessableEntity, response.SvcErrorValidationFailed),
+	)
+})
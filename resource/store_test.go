@@ -0,0 +1,123 @@
+package resource
+
+import (
+	"context"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var widgetIdentity = Identity[widget, int]{
+	Get: func(w widget) int { return w.ID },
+	Set: func(w widget, id int) widget { w.ID = id; return w },
+}
+
+type note struct {
+	Key  string `json:"key"`
+	Text string `json:"text"`
+}
+
+var noteIdentity = Identity[note, string]{
+	Get: func(n note) string { return n.Key },
+	Set: func(n note, key string) note { n.Key = key; return n },
+}
+
+var _ = Describe("MemoryStore", func() {
+	var (
+		ctx   context.Context
+		store *MemoryStore[widget, int]
+	)
+	BeforeEach(func() {
+		ctx = context.TODO()
+		store = NewMemoryStore(widgetIdentity)
+	})
+
+	It("should assign sequential integer ids", func() {
+		// Act
+		first, err := store.Insert(ctx, widget{ID: 42, Name: "sprocket"})
+		Expect(err).ToNot(HaveOccurred())
+		second, err := store.Insert(ctx, widget{Name: "gear"})
+		Expect(err).ToNot(HaveOccurred())
+
+		// Assert
+		Expect(first).To(Equal(widget{ID: 1, Name: "sprocket"}))
+		Expect(second).To(Equal(widget{ID: 2, Name: "gear"}))
+		Expect(store.Get(ctx, 2)).To(Equal(second))
+	})
+
+	It("should assign random string ids", func() {
+		// Arrange
+		notes := NewMemoryStore(noteIdentity)
+
+		// Act
+		first, _ := notes.Insert(ctx, note{Text: "one"})
+		second, _ := notes.Insert(ctx, note{Text: "two"})
+
+		// Assert
+		Expect(first.Key).To(HaveLen(32))
+		Expect(second.Key).ToNot(Equal(first.Key))
+		Expect(notes.Get(ctx, first.Key)).To(Equal(first))
+	})
+
+	It("should list entities in the order they were inserted", func() {
+		// Arrange
+		for _, name := range []string{"sprocket", "gear", "cog"} {
+			_, _ = store.Insert(ctx, widget{Name: name})
+		}
+		Expect(store.Delete(ctx, 2)).To(Succeed())
+		_, _ = store.Insert(ctx, widget{Name: "flange"})
+
+		// Act
+		widgets, err := store.List(ctx)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(widgets).To(Equal([]widget{{ID: 1, Name: "sprocket"}, {ID: 3, Name: "cog"}, {ID: 4, Name: "flange"}}))
+	})
+
+	It("should list an empty store as an empty slice", func() {
+		Expect(store.List(ctx)).To(BeEmpty())
+	})
+
+	It("should replace entities", func() {
+		// Arrange
+		_, _ = store.Insert(ctx, widget{Name: "sprocket"})
+
+		// Act
+		replaced, err := store.Replace(ctx, 1, widget{ID: 7, Name: "cog"})
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replaced).To(Equal(widget{ID: 1, Name: "cog"}))
+		Expect(store.Get(ctx, 1)).To(Equal(replaced))
+	})
+
+	It("should report unknown ids", func() {
+		_, err := store.Get(ctx, 1)
+		Expect(err).To(MatchError(ErrNoSuchResource))
+		_, err = store.Replace(ctx, 1, widget{})
+		Expect(err).To(MatchError(ErrNoSuchResource))
+		Expect(store.Delete(ctx, 1)).To(MatchError(ErrNoSuchResource))
+	})
+
+	It("should be safe to use concurrently", func() {
+		// Act
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				created, _ := store.Insert(ctx, widget{Name: "cog"})
+				_, _ = store.List(ctx)
+				_, _ = store.Replace(ctx, created.ID, widget{Name: "gear"})
+			}()
+		}
+		wg.Wait()
+
+		// Assert
+		widgets, _ := store.List(ctx)
+		Expect(widgets).To(HaveLen(20))
+		Expect(widgets).To(HaveEach(HaveField("Name", "gear")))
+	})
+})
@@ -0,0 +1,432 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/logging"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+	"github.com/mortedecai/resweave"
+)
+
+// The types that can be used as typed resource ids; they are parsed from (and formatted into) the URI
+type ResourceID interface {
+	~string | ~int | ~int32 | ~int64 | ~uint | ~uint32 | ~uint64
+}
+
+// Typed Resources work with entities instead of requests; they must implement IDOf and a subset of:
+//
+//	Create(context.Context, T) (T, error)
+//	List(context.Context, ListQuery) ([]T, error)
+//	ListPage(context.Context, ListQuery) (ListPage[T], error)
+//	Fetch(context.Context, ID) (T, error)
+//	Update(context.Context, ID, T) (T, error)
+//	Replace(context.Context, ID, T) (T, error)
+//	Delete(context.Context, ID) error
+//
+// PUT requests call Replace, or Update if Replace isn't implemented.  PATCH requests fetch the entity, apply the
+// patch (a JSON merge patch or a JSON Patch, see ApplyPatch) and call Update, or Replace if Update isn't implemented;
+// so PATCH is only supported if Fetch is implemented too.
+//
+// Resources that implement Fetch and
+//
+//	VersionOf(T) string
+//
+// support optimistic concurrency (see EasyResource): responses with an entity carry its version as the ETag, and
+// conditional requests are checked against the version of the fetched entity.  The check is made before Update,
+// Replace and Delete are called (and PATCH checks the entity it patches again), so two requests with the same If-Match
+// can both pass it; to stop the second one overwriting the first, those methods must only save the entity if it's
+// still at the version from PreconditionFrom(ctx) (a compare-and-swap), and return ErrPreconditionFailed otherwise.
+//
+// NewTypedResource() adapts a typed resource to an EasyResourceHandler, which decodes and validates request bodies
+// (see DecodeAndValidate), parses ids, and writes the results (according to the request's Accept header).
+//
+// Errors are written with response.Writer.WriteError(), so return service errors, or errors that are registered
+// with the response package (e.g. ErrNoSuchResource), to control the response.
+type TypedResource[T any, ID ResourceID] interface {
+	resweave.LogHolder
+
+	// The id of an entity; used for the Location of created entities
+	IDOf(T) ID
+}
+
+type typedCreator[T any] interface {
+	Create(ctx context.Context, entity T) (T, error)
+}
+
+type typedLister[T any] interface {
+	List(ctx context.Context, query ListQuery) ([]T, error)
+}
+
+// A page of entities, and the cursor of the next page (see EncodeCursor); empty on the last page
+type ListPage[T any] struct {
+	Items []T
+	Next  string
+}
+
+type typedPager[T any] interface {
+	ListPage(ctx context.Context, query ListQuery) (ListPage[T], error)
+}
+
+type typedFetcher[T any, ID ResourceID] interface {
+	Fetch(ctx context.Context, id ID) (T, error)
+}
+
+type typedUpdater[T any, ID ResourceID] interface {
+	Update(ctx context.Context, id ID, entity T) (T, error)
+}
+
+type typedVersioner[T any] interface {
+	VersionOf(entity T) string
+}
+
+type typedReplacer[T any, ID ResourceID] interface {
+	Replace(ctx context.Context, id ID, entity T) (T, error)
+}
+
+type typedDeleter[ID ResourceID] interface {
+	Delete(ctx context.Context, id ID) error
+}
+
+// Make a resource handler for a typed resource; see TypedResource.
+func NewTypedResource[T any, ID ResourceID](name resweave.ResourceName, resource TypedResource[T, ID]) *EasyResourceHandler {
+	return NewResource(name, &typedAdapter[T, ID]{
+		LogHolder:  resource,
+		LogFactory: logging.LogFactory{LogHolder: resource},
+		resource:   resource,
+	})
+}
+
+// Implements every EasyResource method, but only supports the actions that the typed resource implements
+type typedAdapter[T any, ID ResourceID] struct {
+	resweave.LogHolder
+	logging.LogFactory
+
+	resource TypedResource[T, ID]
+}
+
+func (a *typedAdapter[T, ID]) implements(at resweave.ActionType) bool {
+	found := false
+	switch at {
+	case resweave.Create:
+		_, found = a.resource.(typedCreator[T])
+	case resweave.List:
+		_, lists := a.resource.(typedLister[T])
+		_, pages := a.resource.(typedPager[T])
+		found = lists || pages
+	case resweave.Fetch:
+		_, found = a.resource.(typedFetcher[T, ID])
+	case resweave.Delete:
+		_, found = a.resource.(typedDeleter[ID])
+	case resweave.Update:
+		_, updates := a.resource.(typedUpdater[T, ID])
+		_, replaces := a.resource.(typedReplacer[T, ID])
+		found = updates || replaces
+	}
+	return found
+}
+
+// Versions need Fetch as well
+func (a *typedAdapter[T, ID]) implementsVersion() bool {
+	_, versions := a.resource.(typedVersioner[T])
+	_, fetches := a.resource.(typedFetcher[T, ID])
+	return versions && fetches
+}
+
+func (a *typedAdapter[T, ID]) Version(rawId string, ctx context.Context) (string, error) {
+	id, err := ParseID[ID](rawId)
+	if err != nil {
+		return "", err
+	}
+	entity, err := a.resource.(typedFetcher[T, ID]).Fetch(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return a.resource.(typedVersioner[T]).VersionOf(entity), nil
+}
+
+func (a *typedAdapter[T, ID]) implementsTransactions() bool {
+	_, ok := a.resource.(Transactor)
+	return ok
+}
+
+func (a *typedAdapter[T, ID]) InTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return a.resource.(Transactor).InTransaction(ctx, fn)
+}
+
+// Patching needs Fetch as well
+func (a *typedAdapter[T, ID]) implementsMethod(at resweave.ActionType, method string) bool {
+	if at == resweave.Update && method == http.MethodPatch {
+		_, fetches := a.resource.(typedFetcher[T, ID])
+		return fetches && a.implements(at)
+	}
+	return true
+}
+
+// Responds with 201 (Created) and the Location of the new entity
+func (a *typedAdapter[T, ID]) Create(ctx context.Context, writer response.Writer, req *http.Request) {
+	var entity T
+	if err := DecodeAndValidate(req, &entity); err != nil {
+		a.writeError(writer, "Create", err)
+		return
+	}
+
+	created, err := a.resource.(typedCreator[T]).Create(ctx, entity)
+	if err != nil {
+		a.writeError(writer, "Create", err)
+		return
+	}
+
+	location := path.Join(req.URL.Path, url.PathEscape(FormatID(a.resource.IDOf(created))))
+	a.writeVersioned(writer.SetLocation(location), req, http.StatusCreated, created)
+}
+
+// Responds with a page (see ListPage) if the resource implements ListPage, and a plain list otherwise
+func (a *typedAdapter[T, ID]) List(ctx context.Context, writer response.Writer, req *http.Request) {
+	query, err := ParseListQuery(ctx, req)
+	if err != nil {
+		a.writeError(writer, "List", err)
+		return
+	}
+
+	var page ListPage[T]
+	pager, pages := a.resource.(typedPager[T])
+	if pages {
+		page, err = pager.ListPage(ctx, query)
+	} else {
+		page.Items, err = a.resource.(typedLister[T]).List(ctx, query)
+	}
+	if err != nil {
+		a.writeError(writer, "List", err)
+		return
+	}
+	if page.Items == nil {
+		// write an empty list rather than null
+		page.Items = []T{}
+	}
+	items, err := SelectFields(page.Items, query.Fields)
+	if err != nil {
+		a.writeError(writer, "List", err)
+		return
+	}
+	if len(query.Fields) > 0 {
+		// the selected fields are maps, which only JSON can encode; other Accept headers get 406 (Not Acceptable)
+		writer = writer.WithOffers(header.MimeTypeJson)
+	}
+
+	if !pages {
+		a.writeEntity(writer, req, http.StatusOK, items)
+		return
+	}
+	if err = writer.WithRequest(req).WritePage(http.StatusOK, response.Page{Items: items, Next: page.Next}); err != nil {
+		a.NewError("List", err).Log()
+	}
+}
+
+func (a *typedAdapter[T, ID]) Fetch(rawId string, ctx context.Context, writer response.Writer, req *http.Request) {
+	id, err := ParseID[ID](rawId)
+	if err != nil {
+		a.writeError(writer, "Fetch", err)
+		return
+	}
+
+	entity, err := a.resource.(typedFetcher[T, ID]).Fetch(ctx, id)
+	if err != nil {
+		a.writeError(writer, "Fetch", err)
+		return
+	}
+	a.writeVersioned(writer, req, http.StatusOK, entity)
+}
+
+// PUT; the entity's id must be empty or match the id in the URI
+func (a *typedAdapter[T, ID]) Replace(rawId string, ctx context.Context, writer response.Writer, req *http.Request) {
+	id, err := ParseID[ID](rawId)
+	if err != nil {
+		a.writeError(writer, "Replace", err)
+		return
+	}
+	var entity T
+	if err = DecodeAndValidate(req, &entity); err != nil {
+		a.writeError(writer, "Replace", err)
+		return
+	}
+	if err = a.checkID(id, entity); err != nil {
+		a.writeError(writer, "Replace", err)
+		return
+	}
+
+	var replaced T
+	if replacer, ok := a.resource.(typedReplacer[T, ID]); ok {
+		replaced, err = replacer.Replace(ctx, id, entity)
+	} else {
+		replaced, err = a.resource.(typedUpdater[T, ID]).Update(ctx, id, entity)
+	}
+	if err != nil {
+		a.writeError(writer, "Replace", err)
+		return
+	}
+	a.writeVersioned(writer, req, http.StatusOK, replaced)
+}
+
+// PATCH; the patch (see ApplyPatch) is applied to the fetched entity, which is then validated and updated.
+//
+// Patches can't change the entity's id.
+func (a *typedAdapter[T, ID]) Patch(rawId string, ctx context.Context, writer response.Writer, req *http.Request) {
+	id, err := ParseID[ID](rawId)
+	if err != nil {
+		a.writeError(writer, "Patch", err)
+		return
+	}
+	entity, err := a.resource.(typedFetcher[T, ID]).Fetch(ctx, id)
+	if err == nil {
+		err = a.checkVersion(ctx, entity)
+	}
+	if err != nil {
+		a.writeError(writer, "Patch", err)
+		return
+	}
+	if err = DecodePatch(req, &entity); err != nil {
+		if errors.Is(err, rw.ErrorUnsupportedMimeType) {
+			writer.Header().Set(header.AcceptPatch, strings.Join(PatchMimeTypes, ", "))
+		}
+		a.writeError(writer, "Patch", err)
+		return
+	}
+	if err = Validate(&entity); err == nil {
+		err = a.checkID(id, entity)
+	}
+	if err != nil {
+		a.writeError(writer, "Patch", err)
+		return
+	}
+
+	var patched T
+	if updater, ok := a.resource.(typedUpdater[T, ID]); ok {
+		patched, err = updater.Update(ctx, id, entity)
+	} else {
+		patched, err = a.resource.(typedReplacer[T, ID]).Replace(ctx, id, entity)
+	}
+	if err != nil {
+		a.writeError(writer, "Patch", err)
+		return
+	}
+	a.writeVersioned(writer, req, http.StatusOK, patched)
+}
+
+// The entity may have changed since the preconditions were checked
+func (a *typedAdapter[T, ID]) checkVersion(ctx context.Context, entity T) error {
+	precondition, found := PreconditionFrom(ctx)
+	versioner, ok := a.resource.(typedVersioner[T])
+	if found && ok && versioner.VersionOf(entity) != precondition.Version {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+func (a *typedAdapter[T, ID]) checkID(id ID, entity T) error {
+	var zero ID
+	if entityId := a.resource.IDOf(entity); entityId != zero && entityId != id {
+		return response.SvcErrorResourceIdMismatch.WithDetail(fmt.Sprintf("%v != %v", entityId, id))
+	}
+	return nil
+}
+
+// Responds with 204 (No Content)
+func (a *typedAdapter[T, ID]) Delete(rawId string, ctx context.Context, writer response.Writer, req *http.Request) {
+	id, err := ParseID[ID](rawId)
+	if err != nil {
+		a.writeError(writer, "Delete", err)
+		return
+	}
+
+	if err = a.resource.(typedDeleter[ID]).Delete(ctx, id); err != nil {
+		a.writeError(writer, "Delete", err)
+		return
+	}
+	writer.WriteResponse(http.StatusNoContent)
+}
+
+// Writes an entity with its version as the ETag, if the resource has versions
+func (a *typedAdapter[T, ID]) writeVersioned(writer response.Writer, req *http.Request, statusCode int, entity T) {
+	if versioner, ok := a.resource.(typedVersioner[T]); ok {
+		writer.SetETag(versioner.VersionOf(entity))
+	}
+	a.writeEntity(writer, req, statusCode, entity)
+}
+
+func (a *typedAdapter[T, ID]) writeEntity(writer response.Writer, req *http.Request, statusCode int, object interface{}) {
+	if err := writer.Negotiate(req, statusCode, object); err != nil {
+		a.NewError("writeEntity", err).Log()
+	}
+}
+
+func (a *typedAdapter[T, ID]) writeError(writer response.Writer, funcName string, err error) {
+	a.NewError(funcName, err).Log()
+	if werr := writer.WriteError(err); werr != nil {
+		a.NewError(funcName, werr).Log()
+	}
+}
+
+// Decodes the request body according to its Content-Type (JSON if there isn't one)
+func decodeBody(req *http.Request, object interface{}) error {
+	if req.Body == nil {
+		return rw.ErrorNoData
+	}
+	return rw.Unmarshal(req.Body, req.Header.Get(header.ContentType), object)
+}
+
+// Parse an id from the URI; errors are reported as response.SvcErrorInvalidResourceId
+func ParseID[ID ResourceID](raw string) (ID, error) {
+	var id ID
+	value := reflect.ValueOf(&id).Elem()
+	switch value.Kind() {
+	case reflect.String:
+		if raw == "" {
+			return id, invalidID(raw, nil)
+		}
+		value.SetString(raw)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return id, invalidID(raw, err)
+		}
+		value.SetInt(parsed)
+	default:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return id, invalidID(raw, err)
+		}
+		value.SetUint(parsed)
+	}
+	return id, nil
+}
+
+func invalidID(raw string, err error) error {
+	svcErr := response.SvcErrorInvalidResourceId.WithDetail(strconv.Quote(raw))
+	if err != nil {
+		svcErr = svcErr.WithError(err)
+	}
+	return svcErr
+}
+
+// Format an id for use in a URI
+func FormatID[ID ResourceID](id ID) string {
+	value := reflect.ValueOf(id)
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	default:
+		return strconv.FormatUint(value.Uint(), 10)
+	}
+}
@@ -0,0 +1,565 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+	"github.com/mortedecai/resweave"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type widget struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type widgetResource struct {
+	resweave.LogHolder
+
+	widgets   map[int]widget
+	nextId    int
+	lastQuery ListQuery
+}
+
+func newWidgetResource(widgets ...widget) *widgetResource {
+	wr := &widgetResource{LogHolder: resweave.NewLogholder("widgets", nil), widgets: make(map[int]widget), nextId: 1}
+	for _, w := range widgets {
+		wr.widgets[w.ID] = w
+		wr.nextId = max(wr.nextId, w.ID+1)
+	}
+	return wr
+}
+
+func (wr *widgetResource) IDOf(w widget) int {
+	return w.ID
+}
+
+func (wr *widgetResource) Create(_ context.Context, w widget) (widget, error) {
+	w.ID = wr.nextId
+	wr.nextId++
+	wr.widgets[w.ID] = w
+	return w, nil
+}
+
+func (wr *widgetResource) List(_ context.Context, query ListQuery) ([]widget, error) {
+	wr.lastQuery = query
+	var widgets []widget
+	for _, w := range wr.widgets {
+		widgets = append(widgets, w)
+	}
+	sort.Slice(widgets, func(i, j int) bool { return widgets[i].ID < widgets[j].ID })
+	return widgets, nil
+}
+
+func (wr *widgetResource) Fetch(_ context.Context, id int) (widget, error) {
+	w, found := wr.widgets[id]
+	if !found {
+		return widget{}, fmt.Errorf("%w: %d", ErrNoSuchResource, id)
+	}
+	return w, nil
+}
+
+func (wr *widgetResource) Update(_ context.Context, id int, w widget) (widget, error) {
+	if _, found := wr.widgets[id]; !found {
+		return widget{}, fmt.Errorf("%w: %d", ErrNoSuchResource, id)
+	}
+	w.ID = id
+	wr.widgets[id] = w
+	return w, nil
+}
+
+func (wr *widgetResource) Delete(_ context.Context, id int) error {
+	if _, found := wr.widgets[id]; !found {
+		return fmt.Errorf("%w: %d", ErrNoSuchResource, id)
+	}
+	delete(wr.widgets, id)
+	return nil
+}
+
+// only supports Fetch, and fails
+type brokenResource struct {
+	resweave.LogHolder
+}
+
+func (br *brokenResource) IDOf(w widget) string {
+	return w.Name
+}
+
+func (br *brokenResource) Fetch(_ context.Context, id string) (widget, error) {
+	return widget{}, errors.New("database is on fire")
+}
+
+// widgets whose versions are their names
+type versionedWidgetResource struct {
+	*widgetResource
+}
+
+func (vr versionedWidgetResource) VersionOf(w widget) string {
+	return w.Name
+}
+
+// only supports Replace
+type replaceOnlyResource struct {
+	resweave.LogHolder
+}
+
+func (ro *replaceOnlyResource) IDOf(w widget) int {
+	return w.ID
+}
+
+func (ro *replaceOnlyResource) Replace(_ context.Context, id int, w widget) (widget, error) {
+	w.ID = id
+	return w, nil
+}
+
+// lists widgets a page at a time, in id order
+type pagedWidgetResource struct {
+	*widgetResource
+}
+
+func (pr pagedWidgetResource) ListPage(ctx context.Context, query ListQuery) (ListPage[widget], error) {
+	after := 0
+	if query.Cursor != "" {
+		if err := DecodeCursor(query.Cursor, &after); err != nil {
+			return ListPage[widget]{}, err
+		}
+	}
+	widgets, _ := pr.List(ctx, query)
+	var page ListPage[widget]
+	for _, w := range widgets {
+		if w.ID > after && len(page.Items) < query.Limit {
+			page.Items = append(page.Items, w)
+		}
+	}
+	if last := len(page.Items) - 1; last >= 0 && page.Items[last].ID < widgets[len(widgets)-1].ID {
+		page.Next, _ = EncodeCursor(page.Items[last].ID)
+	}
+	return page, nil
+}
+
+type widgetName string
+
+var _ = Describe("Typed Resources", func() {
+	var (
+		recorder  *httptest.ResponseRecorder
+		resource  *widgetResource
+		handler   *EasyResourceHandler
+		withId    func(string) context.Context
+		serveJson func(at resweave.ActionType, method string, id string, body string) *http.Response
+	)
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+		resource = newWidgetResource(widget{ID: 1, Name: "sprocket"}, widget{ID: 2, Name: "gear"})
+		handler = NewTypedResource[widget, int]("widgets", resource)
+		withId = func(id string) context.Context {
+			return context.WithValue(context.TODO(), resweave.Key("id_widgets"), id)
+		}
+		serveJson = func(at resweave.ActionType, method string, id string, body string) *http.Response {
+			target := "/widgets"
+			if id != "" {
+				target += "/" + id
+			}
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			if body != "" {
+				req.Header.Set(header.ContentType, header.MimeTypeJson)
+			}
+			handler.handleResourceAction(at, withId(id), recorder, req)
+			return recorder.Result()
+		}
+	})
+
+	It("should create entities", func() {
+		// Act
+		resp := serveJson(resweave.Create, http.MethodPost, "", `{"name":"cog"}`)
+
+		// Assert
+		var created widget
+		Expect(response.ParseResponseJsonData(resp, http.StatusCreated, &created)).To(Succeed())
+		Expect(created).To(Equal(widget{ID: 3, Name: "cog"}))
+		Expect(resp.Header.Get(header.Location)).To(Equal("/widgets/3"))
+		Expect(resource.widgets).To(HaveKeyWithValue(3, created))
+	})
+
+	It("should list entities", func() {
+		// Act
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/widgets?name=gear", nil)
+		handler.handleResourceAction(resweave.List, context.TODO(), recorder, req)
+
+		// Assert
+		var widgets []widget
+		Expect(response.ParseResponseJsonData(recorder.Result(), http.StatusOK, &widgets)).To(Succeed())
+		Expect(widgets).To(Equal([]widget{{ID: 1, Name: "sprocket"}, {ID: 2, Name: "gear"}}))
+		Expect(resource.lastQuery.Params.Get("name")).To(Equal("gear"))
+	})
+
+	It("should list no entities as an empty array", func() {
+		// Arrange
+		resource.widgets = map[int]widget{}
+
+		// Act
+		resp := serveJson(resweave.List, http.MethodGet, "", "")
+
+		// Assert
+		body, err := response.ParseResponseBinaryData(resp, http.StatusOK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("[]"))
+	})
+
+	It("should fetch entities", func() {
+		// Act
+		resp := serveJson(resweave.Fetch, http.MethodGet, "2", "")
+
+		// Assert
+		var fetched widget
+		Expect(response.ParseResponseJsonData(resp, http.StatusOK, &fetched)).To(Succeed())
+		Expect(fetched).To(Equal(widget{ID: 2, Name: "gear"}))
+	})
+
+	It("should write entities in the requested format", func() {
+		// Arrange
+		req := httptest.NewRequest(http.MethodGet, "/widgets/2", nil)
+		req.Header.Set(header.Accept, header.MimeTypeXml)
+
+		// Act
+		handler.handleResourceAction(resweave.Fetch, withId("2"), recorder, req)
+
+		// Assert
+		resp := recorder.Result()
+		Expect(resp.Header.Get(header.ContentType)).To(Equal(header.MimeTypeXml))
+		var fetched widget
+		Expect(response.ParseResponseData(resp, http.StatusOK, &fetched)).To(Succeed())
+		Expect(fetched).To(Equal(widget{ID: 2, Name: "gear"}))
+	})
+
+	It("should update entities", func() {
+		// Act
+		resp := serveJson(resweave.Update, http.MethodPut, "1", `{"name":"flange"}`)
+
+		// Assert
+		var updated widget
+		Expect(response.ParseResponseJsonData(resp, http.StatusOK, &updated)).To(Succeed())
+		Expect(updated).To(Equal(widget{ID: 1, Name: "flange"}))
+		Expect(resource.widgets[1]).To(Equal(updated))
+	})
+
+	It("should apply merge patches to entities", func() {
+		// Act
+		resp := serveJson(resweave.Update, http.MethodPatch, "2", `{"name":"cog"}`)
+
+		// Assert
+		var patched widget
+		Expect(response.ParseResponseJsonData(resp, http.StatusOK, &patched)).To(Succeed())
+		Expect(patched).To(Equal(widget{ID: 2, Name: "cog"}))
+		Expect(resource.widgets[2]).To(Equal(patched))
+	})
+
+	It("should apply JSON Patches to entities", func() {
+		// Arrange
+		req := httptest.NewRequest(http.MethodPatch, "/widgets/2", strings.NewReader(`[{"op":"test","path":"/name","value":"gear"},{"op":"replace","path":"/name","value":"cog"}]`))
+		req.Header.Set(header.ContentType, header.MimeTypeJsonPatch)
+
+		// Act
+		handler.handleResourceAction(resweave.Update, withId("2"), recorder, req)
+
+		// Assert
+		var patched widget
+		Expect(response.ParseResponseJsonData(recorder.Result(), http.StatusOK, &patched)).To(Succeed())
+		Expect(patched).To(Equal(widget{ID: 2, Name: "cog"}))
+	})
+
+	It("should reject unsupported patch types", func() {
+		// Arrange
+		req := httptest.NewRequest(http.MethodPatch, "/widgets/2", strings.NewReader("<widget><Name>cog</Name></widget>"))
+		req.Header.Set(header.ContentType, header.MimeTypeXml)
+
+		// Act
+		handler.handleResourceAction(resweave.Update, withId("2"), recorder, req)
+
+		// Assert
+		resp := recorder.Result()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnsupportedMediaType))
+		Expect(resp.Header.Get(header.AcceptPatch)).To(Equal("application/merge-patch+json, application/json-patch+json"))
+		Expect(resource.widgets[2]).To(Equal(widget{ID: 2, Name: "gear"}))
+	})
+
+	It("should only support patches if the resource can fetch entities", func() {
+		// Arrange
+		replacer := NewTypedResource[widget, int]("replacer", &replaceOnlyResource{LogHolder: resweave.NewLogholder("replacer", nil)})
+		ctx := context.WithValue(context.TODO(), resweave.Key("id_replacer"), "1")
+
+		// Act
+		req := httptest.NewRequest(http.MethodPatch, "/replacer/1", strings.NewReader(`{"name":"cog"}`))
+		replacer.handleResourceAction(resweave.Update, ctx, recorder, req)
+
+		// Assert
+		Expect(recorder.Result().StatusCode).To(Equal(http.StatusMethodNotAllowed))
+
+		// Act
+		recorder = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPut, "/replacer/1", strings.NewReader(`{"name":"cog"}`))
+		replacer.handleResourceAction(resweave.Update, ctx, recorder, req)
+
+		// Assert
+		var replaced widget
+		Expect(response.ParseResponseJsonData(recorder.Result(), http.StatusOK, &replaced)).To(Succeed())
+		Expect(replaced).To(Equal(widget{ID: 1, Name: "cog"}))
+	})
+
+	It("should delete entities", func() {
+		// Act
+		resp := serveJson(resweave.Delete, http.MethodDelete, "1", "")
+
+		// Assert
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(resource.widgets).ToNot(HaveKey(1))
+	})
+
+	DescribeTable("should write errors",
+		func(at resweave.ActionType, method string, id string, body string, expectStatus int, expectErr error) {
+			// Act
+			resp := serveJson(at, method, id, body)
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(expectStatus))
+			Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(expectErr))
+		},
+		Entry("with an invalid id", resweave.Fetch, http.MethodGet, "one", "", http.StatusBadRequest, response.SvcErrorInvalidResourceId),
+		Entry("with an unknown id", resweave.Fetch, http.MethodGet, "99", "", http.StatusNotFound, response.SvcErrorResourceNotFound),
+		Entry("with an unknown id to delete", resweave.Delete, http.MethodDelete, "99", "", http.StatusNotFound, response.SvcErrorResourceNotFound),
+		Entry("with an invalid body", resweave.Create, http.MethodPost, "", `{"name":`, http.StatusBadRequest, response.SvcErrorUnmarshalFailed),
+		Entry("with no body", resweave.Create, http.MethodPost, "", "", http.StatusBadRequest, response.SvcErrorReadRequestFailed),
+		Entry("with a mismatched id", resweave.Update, http.MethodPut, "1", `{"id":2,"name":"flange"}`, http.StatusBadRequest, response.SvcErrorResourceIdMismatch),
+		Entry("with a patch that changes the id", resweave.Update, http.MethodPatch, "1", `{"id":2}`, http.StatusBadRequest, response.SvcErrorResourceIdMismatch),
+		Entry("with an invalid patch", resweave.Update, http.MethodPatch, "1", `{"name":`, http.StatusBadRequest, response.SvcErrorInvalidPatch),
+		Entry("with a patch of the wrong type", resweave.Update, http.MethodPatch, "1", `{"name":42}`, http.StatusBadRequest, response.SvcErrorJsonUnmarshalFailed),
+		Entry("with a patch for an unknown id", resweave.Update, http.MethodPatch, "99", `{"name":"cog"}`, http.StatusNotFound, response.SvcErrorResourceNotFound),
+		Entry("with a merge patch that isn't JSON", resweave.Update, http.MethodPatch, "1", `name=cog`, http.StatusBadRequest, response.SvcErrorInvalidPatch),
+	)
+
+	It("should reject bodies it can't decode", func() {
+		// Arrange
+		req := httptest.NewRequest(http.MethodPost, "/widgets", bytes.NewReader([]byte("id,name")))
+		req.Header.Set(header.ContentType, "text/csv")
+
+		// Act
+		handler.handleResourceAction(resweave.Create, context.TODO(), recorder, req)
+
+		// Assert
+		resp := recorder.Result()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnsupportedMediaType))
+		Expect(response.ParseResponse(resp, http.StatusCreated)).To(MatchError(response.SvcErrorUnsupportedMediaType))
+	})
+
+	It("should only support the actions that the resource implements", func() {
+		// Arrange
+		broken := NewTypedResource[widget, string]("broken", &brokenResource{LogHolder: resweave.NewLogholder("broken", nil)})
+
+		// Act & Assert
+		for _, at := range []resweave.ActionType{resweave.Create, resweave.List, resweave.Delete, resweave.Update} {
+			Expect(broken.validateActionImplemented(at)).To(BeFalse(), at.String())
+		}
+		Expect(broken.validateActionImplemented(resweave.Fetch)).To(BeTrue())
+	})
+
+	It("should write unknown errors as internal errors", func() {
+		// Arrange
+		broken := NewTypedResource[widget, string]("broken", &brokenResource{LogHolder: resweave.NewLogholder("broken", nil)})
+		req := httptest.NewRequest(http.MethodGet, "/broken/x", nil)
+		ctx := context.WithValue(context.TODO(), resweave.Key("id_broken"), "x")
+
+		// Act
+		broken.handleResourceAction(resweave.Fetch, ctx, recorder, req)
+
+		// Assert
+		resp := recorder.Result()
+		Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+		Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(response.SvcErrorInternal))
+	})
+
+	Context("versions", func() {
+		BeforeEach(func() {
+			handler = NewTypedResource[widget, int]("widgets", versionedWidgetResource{resource})
+		})
+
+		It("should send versions as ETags", func() {
+			// Act
+			resp := serveJson(resweave.Fetch, http.MethodGet, "2", "")
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get(header.ETag)).To(Equal(`"gear"`))
+		})
+
+		It("should check If-Match against the entity's version", func() {
+			// Arrange
+			req := httptest.NewRequest(http.MethodPatch, "/widgets/2", strings.NewReader(`{"name":"cog"}`))
+			req.Header.Set(header.IfMatch, `"gear"`)
+
+			// Act
+			handler.handleResourceAction(resweave.Update, withId("2"), recorder, req)
+
+			// Assert
+			resp := recorder.Result()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get(header.ETag)).To(Equal(`"cog"`))
+
+			// Act: the same request again, which is now out of date
+			recorder = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodPut, "/widgets/2", strings.NewReader(`{"name":"flange"}`))
+			req.Header.Set(header.IfMatch, `"gear"`)
+			handler.handleResourceAction(resweave.Update, withId("2"), recorder, req)
+
+			// Assert
+			Expect(recorder.Result().StatusCode).To(Equal(http.StatusPreconditionFailed))
+			Expect(resource.widgets[2]).To(Equal(widget{ID: 2, Name: "cog"}))
+		})
+
+		It("should reject patches if the entity changed after the precondition was checked", func() {
+			// Arrange
+			adapter := handler.resource.(*typedAdapter[widget, int])
+			ctx := context.WithValue(withId("2"), preconditionKey{}, Precondition{Version: "sprocket", IfMatch: `"sprocket"`})
+			req := httptest.NewRequest(http.MethodPatch, "/widgets/2", strings.NewReader(`{"name":"cog"}`))
+
+			// Act
+			adapter.Patch("2", ctx, response.NewWriter(recorder), req)
+
+			// Assert
+			Expect(recorder.Result().StatusCode).To(Equal(http.StatusPreconditionFailed))
+			Expect(resource.widgets[2]).To(Equal(widget{ID: 2, Name: "gear"}))
+		})
+
+		It("should only support versions if the resource can fetch entities", func() {
+			replacer := NewTypedResource[widget, int]("replacer", &replaceOnlyResource{LogHolder: resweave.NewLogholder("replacer", nil)})
+			_, versioned := replacer.versioner()
+			Expect(versioned).To(BeFalse())
+			_, versioned = handler.versioner()
+			Expect(versioned).To(BeTrue())
+		})
+	})
+
+	Context("lists", func() {
+		list := func(handler *EasyResourceHandler, target string) *http.Response {
+			recorder := httptest.NewRecorder()
+			handler.handleResourceAction(resweave.List, context.TODO(), recorder, httptest.NewRequest(http.MethodGet, target, nil))
+			return recorder.Result()
+		}
+
+		It("should pass the parsed query to the resource", func() {
+			// Act
+			resp := list(handler, "/widgets?name!=gear&sort=-id&limit=5")
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resource.lastQuery.Filters).To(Equal([]Filter{{Field: "name", Op: FilterNe, Values: []string{"gear"}}}))
+			Expect(resource.lastQuery.Sort).To(Equal([]SortField{{Field: "id", Descending: true}}))
+			Expect(resource.lastQuery.Limit).To(Equal(5))
+		})
+
+		It("should only return the selected fields", func() {
+			// Act
+			body, err := response.ParseResponseBinaryData(list(handler, "/widgets?fields=name"), http.StatusOK)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(MatchJSON(`[{"name": "sprocket"}, {"name": "gear"}]`))
+		})
+
+		It("should only select fields for JSON", func() {
+			// Arrange
+			req := httptest.NewRequest(http.MethodGet, "/widgets?fields=name", nil)
+			req.Header.Set(header.Accept, header.MimeTypeXml)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			handler.handleResourceAction(resweave.List, context.TODO(), recorder, req)
+
+			// Assert
+			resp := recorder.Result()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotAcceptable))
+			Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(response.SvcErrorNotAcceptable))
+		})
+
+		It("should reject queries that the list options don't allow", func() {
+			// Arrange
+			handler.SetListOptions(ListOptions{MaxLimit: 10, Sorts: []string{"name"}})
+
+			// Act
+			resp := list(handler, "/widgets?sort=id&limit=11")
+
+			// Assert
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			err := response.ParseResponse(resp, http.StatusOK)
+			Expect(err).To(MatchError(response.SvcErrorInvalidQuery))
+			var svcErr *response.SvcError
+			Expect(errors.As(err, &svcErr)).To(BeTrue())
+			Expect(svcErr.FieldViolations()).To(HaveLen(2))
+			Expect(resource.lastQuery.Params).To(BeNil())
+		})
+
+		It("should write pages with a link to the next page", func() {
+			// Arrange
+			resource.widgets[3] = widget{ID: 3, Name: "cog"}
+			paged := NewTypedResource[widget, int]("widgets", pagedWidgetResource{resource})
+
+			// Act
+			first := list(paged, "/widgets?limit=2")
+			var page struct {
+				Items []widget `json:"items"`
+				Next  string   `json:"next"`
+			}
+			Expect(response.ParseResponseJsonData(first, http.StatusOK, &page)).To(Succeed())
+			link := first.Header.Get(header.Link)
+			second := list(paged, strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+
+			// Assert
+			Expect(page.Items).To(Equal([]widget{{ID: 1, Name: "sprocket"}, {ID: 2, Name: "gear"}}))
+			Expect(page.Next).ToNot(BeEmpty())
+			Expect(link).To(HaveSuffix(`>; rel="next"`))
+			body, err := response.ParseResponseBinaryData(second, http.StatusOK)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(body).To(MatchJSON(`{"items": [{"id": 3, "name": "cog"}]}`))
+			Expect(second.Header.Values(header.Link)).To(BeEmpty())
+		})
+	})
+
+	Context("ids", func() {
+		It("should parse and format ids", func() {
+			Expect(ParseID[int]("42")).To(Equal(42))
+			Expect(ParseID[uint32]("42")).To(BeEquivalentTo(42))
+			Expect(ParseID[widgetName]("gear")).To(Equal(widgetName("gear")))
+			Expect(FormatID(-42)).To(Equal("-42"))
+			Expect(FormatID(uint64(42))).To(Equal("42"))
+			Expect(FormatID(widgetName("gear"))).To(Equal("gear"))
+		})
+
+		DescribeTable("should reject invalid ids",
+			func(parse func() error) {
+				Expect(parse()).To(MatchError(response.SvcErrorInvalidResourceId))
+			},
+			Entry("with an empty string", func() error { _, err := ParseID[string](""); return err }),
+			Entry("with a non-numeric int", func() error { _, err := ParseID[int64]("abc"); return err }),
+			Entry("with a negative uint", func() error { _, err := ParseID[uint]("-1"); return err }),
+			Entry("with an out of range int", func() error { _, err := ParseID[int32]("3000000000"); return err }),
+		)
+	})
+
+	It("should decode with the registered codecs", func() {
+		var w widget
+		req := httptest.NewRequest(http.MethodPost, "/widgets", strings.NewReader("<widget><ID>4</ID><Name>cog</Name></widget>"))
+		req.Header.Set(header.ContentType, header.MimeTypeXml)
+		Expect(decodeBody(req, &w)).To(Succeed())
+		Expect(w).To(Equal(widget{ID: 4, Name: "cog"}))
+		Expect(decodeBody(&http.Request{}, &w)).To(MatchError(rw.ErrorNoData))
+	})
+})
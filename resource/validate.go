@@ -0,0 +1,296 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+)
+
+var (
+	ErrInvalidValidationTag = errors.New("invalid validation tag")
+)
+
+// Checks the `validate` tags of a struct's fields, e.g.
+//
+//	type Foo struct {
+//	  Name     string   `json:"name" validate:"required,min=1,max=64"`
+//	  Email    string   `json:"email,omitempty" validate:"email"`
+//	  Status   string   `json:"status" validate:"oneof=active inactive"`
+//	  Tags     []string `json:"tags" validate:"max=10"`
+//	  Password string   `json:"password" validate:"min=12,secret"`
+//	}
+//
+// The rules are:
+//
+//	required      the field can't be empty (the zero value, or an empty string, slice or map)
+//	min=N, max=N  the length of a string (in characters), slice or map, or the value of a number
+//	email         an email address, without a display name
+//	oneof=a b c   one of the space-separated values
+//	secret        violations don't include the field's value (e.g. for passwords)
+//
+// Optional fields (pointers, and fields tagged `json:",omitempty"` or `json:",omitzero"`) that are empty are only
+// checked by `required`, so they can have rules too; other fields are always checked, so `min=1` rejects 0 and "".
+// Nested structs (and slices and maps of them) are checked as well.
+//
+// Every violation is returned in a response.SvcErrorValidationFailed error; fields are named the way they are
+// in JSON, e.g. "items[2].name".  A tag that can't be understood returns ErrInvalidValidationTag instead.
+func Validate(object interface{}) error {
+	var violations []response.FieldViolation
+	if err := validateValue(reflect.ValueOf(object), "", &violations); err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return response.SvcErrorValidationFailed.WithFieldViolations(violations...)
+	}
+	return nil
+}
+
+// Decodes the request body according to its Content-Type (JSON if there isn't one), then validates it (see Validate)
+func DecodeAndValidate(req *http.Request, object interface{}) error {
+	if err := decodeBody(req, object); err != nil {
+		return err
+	}
+	return Validate(object)
+}
+
+// Makes a validator (see SetValidator) that decodes the request body as a T and validates it, so that resource
+// methods only see valid bodies.  The body is restored so that the resource method can read it again.
+func ValidateBody[T any]() ValidateFunc {
+	return func(_ context.Context, _ response.Writer, req *http.Request) (int, response.ServiceError) {
+		data, err := rw.ReadAll(req.Body)
+		if err != nil {
+			return http.StatusBadRequest, response.SvcErrorReadRequestFailed.WithError(err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+
+		var body T
+		if err = rw.Unmarshal(bytes.NewReader(data), req.Header.Get(header.ContentType), &body); err == nil {
+			err = Validate(&body)
+		}
+		if err != nil {
+			svcErr := response.MapError(err)
+			return response.StatusOf(svcErr), svcErr
+		}
+		return 0, nil
+	}
+}
+
+func validateValue(value reflect.Value, path string, violations *[]response.FieldViolation) error {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		valueType := value.Type()
+		for index := 0; index < valueType.NumField(); index++ {
+			field := valueType.Field(index)
+			name, skip := fieldName(field)
+			if skip {
+				continue
+			}
+			fieldPath := path
+			if name != "" {
+				fieldPath = joinPath(path, name)
+			}
+
+			fieldValue := value.Field(index)
+			if tag := field.Tag.Get("validate"); tag != "" {
+				if err := checkRules(fieldValue, fieldPath, tag, isOptional(field), violations); err != nil {
+					return err
+				}
+			}
+			if err := validateValue(fieldValue, fieldPath, violations); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for index := 0; index < value.Len(); index++ {
+			if err := validateValue(value.Index(index), fmt.Sprintf("%s[%d]", path, index), violations); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			if err := validateValue(value.MapIndex(key), fmt.Sprintf("%s[%v]", path, key), violations); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the field's JSON name, or "" for embedded structs whose fields are promoted
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", true
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch {
+	case name == "-":
+		return "", true
+	case name != "":
+		return name, false
+	case field.Anonymous:
+		return "", false
+	}
+	return field.Name, false
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// True if the field can be left out: a pointer (or interface), or a field that JSON leaves out when it's empty
+func isOptional(field reflect.StructField) bool {
+	if kind := field.Type.Kind(); kind == reflect.Pointer || kind == reflect.Interface {
+		return true
+	}
+	_, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+	for _, option := range strings.Split(options, ",") {
+		if option == "omitempty" || option == "omitzero" {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRules(value reflect.Value, path string, tag string, optional bool, violations *[]response.FieldViolation) error {
+	rules := strings.Split(tag, ",")
+	if isEmpty(value) {
+		for _, rule := range rules {
+			if strings.TrimSpace(rule) == "required" {
+				*violations = append(*violations, response.FieldViolation{Field: path, Reason: "is required"})
+				return nil
+			}
+		}
+		if optional {
+			return nil
+		}
+	}
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	var echoed interface{} = value.Interface()
+	for _, rule := range rules {
+		if strings.TrimSpace(rule) == "secret" {
+			echoed = nil
+		}
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		var reason string
+		var err error
+		switch name {
+		case "required", "secret":
+			continue
+		case "min":
+			reason, err = checkSize(value, arg, func(size float64, limit float64) bool { return size >= limit }, "at least")
+		case "max":
+			reason, err = checkSize(value, arg, func(size float64, limit float64) bool { return size <= limit }, "at most")
+		case "email":
+			reason, err = checkEmail(value)
+		case "oneof":
+			reason, err = checkOneOf(value, arg)
+		default:
+			err = errors.New("unknown rule")
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s: %q: %w", ErrInvalidValidationTag, path, rule, err)
+		}
+		if reason != "" {
+			*violations = append(*violations, response.FieldViolation{Field: path, Reason: reason, Value: echoed})
+		}
+	}
+	return nil
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// Returns a reason if the size doesn't pass the test
+func checkSize(value reflect.Value, arg string, test func(float64, float64) bool, comparison string) (string, error) {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return "", err
+	}
+
+	var size float64
+	reason := "must be %s %s"
+	switch value.Kind() {
+	case reflect.String:
+		size, reason = float64(utf8.RuneCountInString(value.String())), "must be %s %s characters long"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		size, reason = float64(value.Len()), "must have %s %s items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	default:
+		return "", fmt.Errorf("unsupported type %s", value.Type())
+	}
+
+	if test(size, limit) {
+		return "", nil
+	}
+	return fmt.Sprintf(reason, comparison, arg), nil
+}
+
+func checkEmail(value reflect.Value) (string, error) {
+	if value.Kind() != reflect.String {
+		return "", fmt.Errorf("unsupported type %s", value.Type())
+	}
+	address, err := mail.ParseAddress(value.String())
+	if err != nil || address.Address != value.String() {
+		return "must be an email address", nil
+	}
+	return "", nil
+}
+
+func checkOneOf(value reflect.Value, arg string) (string, error) {
+	switch value.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return "", fmt.Errorf("unsupported type %s", value.Type())
+	}
+
+	allowed := strings.Fields(arg)
+	actual := fmt.Sprint(value.Interface())
+	for _, option := range allowed {
+		if option == actual {
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("must be one of: %s", strings.Join(allowed, ", ")), nil
+}
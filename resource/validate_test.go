@@ -0,0 +1,267 @@
+package resource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/response"
+	"github.com/keithpaterson/resweave-utils/utility/test"
+	"github.com/mortedecai/resweave"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type address struct {
+	City    string `json:"city" validate:"required"`
+	Country string `json:"country" validate:"oneof=CA US"`
+}
+
+type Audit struct {
+	CreatedBy string `json:"createdBy" validate:"email"`
+}
+
+type account struct {
+	Audit
+	Name     string             `json:"name" validate:"required,min=2,max=8"`
+	Email    string             `json:"email,omitempty" validate:"email"`
+	Age      int                `json:"age" validate:"min=18,max=130"`
+	Level    uint               `json:"level" validate:"oneof=1 2 3"`
+	Tags     []string           `json:"tags" validate:"max=2"`
+	Home     *address           `json:"home" validate:"required"`
+	Previous []address          `json:"previous"`
+	Contacts map[string]address `json:"contacts"`
+	Ignored  string             `json:"-" validate:"required"`
+	internal string             `validate:"required"`
+}
+
+func validAccount() account {
+	return account{
+		Audit: Audit{CreatedBy: "admin@example.com"},
+		Name:  "bob",
+		Email: "bob@example.com",
+		Age:   30,
+		Level: 2,
+		Home:  &address{City: "Ottawa", Country: "CA"},
+	}
+}
+
+var _ = Describe("Validation", func() {
+	It("should accept valid objects", func() {
+		Expect(Validate(validAccount())).To(Succeed())
+		account := validAccount()
+		Expect(Validate(&account)).To(Succeed())
+	})
+
+	It("should count characters rather than bytes", func() {
+		account := validAccount()
+		account.Name = "éééééééé"
+		Expect(Validate(account)).To(Succeed())
+	})
+
+	DescribeTable("should report violations",
+		func(modify func(*account), expect ...response.FieldViolation) {
+			// Arrange
+			account := validAccount()
+			modify(&account)
+
+			// Act
+			err := Validate(account)
+
+			// Assert
+			Expect(err).To(MatchError(response.SvcErrorValidationFailed))
+			var svcErr *response.SvcError
+			Expect(err).To(BeAssignableToTypeOf(svcErr))
+			Expect(err.(*response.SvcError).FieldViolations()).To(Equal(expect))
+		},
+		Entry("with a missing required field", func(a *account) { a.Name = "" },
+			response.FieldViolation{Field: "name", Reason: "is required"}),
+		Entry("with a short string", func(a *account) { a.Name = "b" },
+			response.FieldViolation{Field: "name", Reason: "must be at least 2 characters long", Value: "b"}),
+		Entry("with a long string", func(a *account) { a.Name = "bartholomew" },
+			response.FieldViolation{Field: "name", Reason: "must be at most 8 characters long", Value: "bartholomew"}),
+		Entry("with a small number", func(a *account) { a.Age = 17 },
+			response.FieldViolation{Field: "age", Reason: "must be at least 18", Value: 17}),
+		Entry("with a zero number", func(a *account) { a.Age = 0 },
+			response.FieldViolation{Field: "age", Reason: "must be at least 18", Value: 0}),
+		Entry("with an empty field that isn't optional", func(a *account) { a.CreatedBy = "" },
+			response.FieldViolation{Field: "createdBy", Reason: "must be an email address", Value: ""}),
+		Entry("with a number that isn't allowed", func(a *account) { a.Level = 4 },
+			response.FieldViolation{Field: "level", Reason: "must be one of: 1, 2, 3", Value: uint(4)}),
+		Entry("with too many items", func(a *account) { a.Tags = []string{"a", "b", "c"} },
+			response.FieldViolation{Field: "tags", Reason: "must have at most 2 items", Value: []string{"a", "b", "c"}}),
+		Entry("with an invalid email", func(a *account) { a.Email = "Bob <bob@example.com>" },
+			response.FieldViolation{Field: "email", Reason: "must be an email address", Value: "Bob <bob@example.com>"}),
+		Entry("with a missing pointer", func(a *account) { a.Home = nil },
+			response.FieldViolation{Field: "home", Reason: "is required"}),
+		Entry("with an invalid promoted field", func(a *account) { a.CreatedBy = "admin" },
+			response.FieldViolation{Field: "createdBy", Reason: "must be an email address", Value: "admin"}),
+		Entry("with invalid nested fields", func(a *account) {
+			a.Home.City = ""
+			a.Previous = []address{{City: "Paris", Country: "FR"}}
+			a.Contacts = map[string]address{"work": {Country: "US"}}
+		},
+			response.FieldViolation{Field: "home.city", Reason: "is required"},
+			response.FieldViolation{Field: "previous[0].country", Reason: "must be one of: CA, US", Value: "FR"},
+			response.FieldViolation{Field: "contacts[work].city", Reason: "is required"}),
+		Entry("with several violations", func(a *account) {
+			a.Name = ""
+			a.Age = 200
+		},
+			response.FieldViolation{Field: "name", Reason: "is required"},
+			response.FieldViolation{Field: "age", Reason: "must be at most 130", Value: 200}),
+	)
+
+	It("should not check optional fields that are empty", func() {
+		account := validAccount()
+		account.Email = ""
+		Expect(Validate(account)).To(Succeed())
+		Expect(Validate(struct {
+			Count *int `json:"count" validate:"min=1"`
+		}{})).To(Succeed())
+	})
+
+	It("should not report the values of secret fields", func() {
+		// Act
+		err := Validate(struct {
+			Password string `json:"password" validate:"min=12,secret"`
+		}{Password: "hunter2"})
+
+		// Assert
+		Expect(err).To(MatchError(response.SvcErrorValidationFailed))
+		Expect(err.(*response.SvcError).FieldViolations()).To(Equal([]response.FieldViolation{
+			{Field: "password", Reason: "must be at least 12 characters long"},
+		}))
+	})
+
+	DescribeTable("should reject invalid tags",
+		func(object interface{}) {
+			Expect(Validate(object)).To(MatchError(ErrInvalidValidationTag))
+		},
+		Entry("with an unknown rule", struct {
+			Name string `validate:"shiny"`
+		}{Name: "x"}),
+		Entry("with an invalid limit", struct {
+			Name string `validate:"min=two"`
+		}{Name: "x"}),
+		Entry("with an email rule on a number", struct {
+			Count int `validate:"email"`
+		}{Count: 1}),
+		Entry("with a size rule on a bool", struct {
+			Flag bool `validate:"max=1"`
+		}{Flag: true}),
+	)
+
+	Context("in the resource handler", func() {
+		var recorder *httptest.ResponseRecorder
+		newRequest := func(body string) *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/test", strings.NewReader(body))
+			req.Header.Set(header.ContentType, header.MimeTypeJson)
+			return req
+		}
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+		})
+
+		It("should reject invalid bodies before calling the resource", func() {
+			// Arrange
+			res := newTestEasyResource()
+			res.SetValidator(resweave.Create, ValidateBody[account]())
+
+			// Act
+			res.handleResourceAction(resweave.Create, context.TODO(), recorder, newRequest(`{"name":"b"}`))
+
+			// Assert
+			resp := recorder.Result()
+			Expect(resp.StatusCode).To(Equal(http.StatusUnprocessableEntity))
+			err := response.ParseResponse(resp, http.StatusOK)
+			Expect(err).To(MatchError(response.SvcErrorValidationFailed))
+			// empty fields are checked unless they're optional (e.g. email, which is omitempty)
+			Expect(err.(*response.SvcError).FieldViolations()).To(HaveExactElements(
+				HaveField("Field", "createdBy"),
+				HaveField("Field", "name"),
+				HaveField("Field", "age"),
+				HaveField("Field", "level"),
+				HaveField("Field", "home"),
+			))
+			Expect(res.resource.(*testEasyResource).calls).To(BeEmpty())
+		})
+
+		It("should restore the body for the resource", func() {
+			// Arrange
+			res := newTestEasyResource()
+			req := newRequest(string(test.MustMarshalJson(validAccount())))
+			var body account
+			res.SetValidator(resweave.Create, func(ctx context.Context, w response.Writer, r *http.Request) (int, response.ServiceError) {
+				status, svcErr := ValidateBody[account]()(ctx, w, r)
+				if svcErr == nil {
+					Expect(DecodeAndValidate(r, &body)).To(Succeed())
+				}
+				return status, svcErr
+			})
+
+			// Act
+			res.handleResourceAction(resweave.Create, context.TODO(), recorder, req)
+
+			// Assert
+			Expect(recorder.Result().StatusCode).To(Equal(http.StatusOK))
+			Expect(body).To(Equal(validAccount()))
+			Expect(res.resource.(*testEasyResource).calls).To(HaveLen(1))
+		})
+
+		It("should reject bodies that can't be decoded", func() {
+			// Arrange
+			res := newTestEasyResource()
+			res.SetValidator(resweave.Create, ValidateBody[account]())
+
+			// Act
+			res.handleResourceAction(resweave.Create, context.TODO(), recorder, newRequest(`{"name":`))
+
+			// Assert
+			resp := recorder.Result()
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			Expect(response.ParseResponse(resp, http.StatusOK)).To(MatchError(response.SvcErrorUnmarshalFailed))
+		})
+
+		It("should remove validators", func() {
+			res := newTestEasyResource()
+			res.SetValidator(resweave.Create, ValidateBody[account]())
+			res.SetValidator(resweave.Create, nil)
+			Expect(res.validations).ToNot(HaveKey(resweave.Create))
+		})
+
+		It("should validate typed resource bodies", func() {
+			// Arrange
+			type gadget struct {
+				ID   int    `json:"id"`
+				Name string `json:"name" validate:"required"`
+			}
+			handler := NewTypedResource[gadget, int]("gadgets", &gadgetResource[gadget]{LogHolder: resweave.NewLogholder("gadgets", nil)})
+
+			// Act
+			handler.handleResourceAction(resweave.Create, context.TODO(), recorder, newRequest(`{"id":1}`))
+
+			// Assert
+			resp := recorder.Result()
+			Expect(resp.StatusCode).To(Equal(http.StatusUnprocessableEntity))
+			err := response.ParseResponse(resp, http.StatusCreated)
+			Expect(err).To(MatchError(response.SvcErrorValidationFailed))
+			Expect(err.(*response.SvcError).FieldViolations()).To(Equal([]response.FieldViolation{{Field: "name", Reason: "is required"}}))
+		})
+	})
+})
+
+// a typed resource that only creates
+type gadgetResource[T any] struct {
+	resweave.LogHolder
+}
+
+func (gr *gadgetResource[T]) IDOf(T) int {
+	return 1
+}
+
+func (gr *gadgetResource[T]) Create(_ context.Context, gadget T) (T, error) {
+	return gadget, nil
+}
@@ -0,0 +1,170 @@
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// A field in the request that failed validation
+type FieldViolation struct {
+	Field  string      `json:"field"`
+	Reason string      `json:"reason"`
+	Value  interface{} `json:"value,omitempty"`
+}
+
+// Tells clients that the request can be retried, and when
+type RetryHint struct {
+	After time.Duration
+}
+
+// Where clients can find out more about the error
+type HelpLink struct {
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url"`
+}
+
+// Structured details that are written along with the service error.
+//
+// In problem+json responses these are written as extension members with the same names.
+type errorDetails struct {
+	Violations []FieldViolation       `json:"violations,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	Retry      *RetryHint             `json:"retry,omitempty"`
+	Help       []HelpLink             `json:"help,omitempty"`
+}
+
+var detailMembers = []string{"violations", "metadata", "retry", "help"}
+
+type retryHintJson struct {
+	AfterSeconds int64 `json:"afterSeconds"`
+}
+
+// Retry hints are sent in whole seconds (rounded up), the same as the Retry-After header
+func (r RetryHint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(retryHintJson{AfterSeconds: r.seconds()})
+}
+
+func (r *RetryHint) UnmarshalJSON(data []byte) error {
+	var hint retryHintJson
+	if err := json.Unmarshal(data, &hint); err != nil {
+		return err
+	}
+	r.After = time.Duration(hint.AfterSeconds) * time.Second
+	return nil
+}
+
+func (r RetryHint) seconds() int64 {
+	return int64(math.Ceil(r.After.Seconds()))
+}
+
+// Add a field violation; returns a new error.
+func (e *SvcError) WithFieldViolation(field string, reason string, value interface{}) ServiceError {
+	return e.WithFieldViolations(FieldViolation{Field: field, Reason: reason, Value: value})
+}
+
+// Add field violations; returns a new error.
+func (e *SvcError) WithFieldViolations(violations ...FieldViolation) ServiceError {
+	c := e.clone()
+	c.details.Violations = append(append(make([]FieldViolation, 0, len(e.details.Violations)+len(violations)), e.details.Violations...), violations...)
+	return c
+}
+
+// Add a metadata value; the value must be serializable as JSON.  Returns a new error.
+func (e *SvcError) WithMetadata(key string, value interface{}) ServiceError {
+	c := e.clone()
+	c.details.Metadata = make(map[string]interface{}, len(e.details.Metadata)+1)
+	for k, v := range e.details.Metadata {
+		c.details.Metadata[k] = v
+	}
+	c.details.Metadata[key] = value
+	return c
+}
+
+// Tell clients that they may retry after the given time; this also sets the Retry-After header.  Returns a new error.
+func (e *SvcError) WithRetryAfter(after time.Duration) ServiceError {
+	c := e.clone()
+	c.details.Retry = &RetryHint{After: after}
+	return c
+}
+
+// Add a help link; returns a new error.
+func (e *SvcError) WithHelpLink(description string, url string) ServiceError {
+	c := e.clone()
+	c.details.Help = append(append(make([]HelpLink, 0, len(e.details.Help)+1), e.details.Help...), HelpLink{Description: description, URL: url})
+	return c
+}
+
+func (e *SvcError) FieldViolations() []FieldViolation {
+	return e.details.Violations
+}
+
+func (e *SvcError) Metadata() map[string]interface{} {
+	return e.details.Metadata
+}
+
+// Decode a metadata value into target, which must be a pointer.
+//
+// This is useful for errors that were read from a response, where metadata values have been decoded
+// into generic types (e.g. map[string]interface{}).
+func (e *SvcError) MetadataAs(key string, target interface{}) error {
+	value, found := e.details.Metadata[key]
+	if !found {
+		return fmt.Errorf("%w: %q", ErrorNoSuchMetadata, key)
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
+
+func (e *SvcError) RetryHint() (RetryHint, bool) {
+	if e.details.Retry == nil {
+		return RetryHint{}, false
+	}
+	return *e.details.Retry, true
+}
+
+func (e *SvcError) HelpLinks() []HelpLink {
+	return e.details.Help
+}
+
+// adds the details to problem extension members; returns a new map if there are any details
+func (d errorDetails) toExtensions(extensions map[string]interface{}) map[string]interface{} {
+	if len(d.Violations) > 0 {
+		extensions = withMember(extensions, "violations", d.Violations)
+	}
+	if len(d.Metadata) > 0 {
+		extensions = withMember(extensions, "metadata", d.Metadata)
+	}
+	if d.Retry != nil {
+		extensions = withMember(extensions, "retry", d.Retry)
+	}
+	if len(d.Help) > 0 {
+		extensions = withMember(extensions, "help", d.Help)
+	}
+	return extensions
+}
+
+// decodes the details from problem extension members, which have generic types after unmarshaling
+func detailsFromExtensions(extensions map[string]interface{}) (errorDetails, error) {
+	var details errorDetails
+	found := make(map[string]interface{})
+	for _, name := range detailMembers {
+		if value, ok := extensions[name]; ok {
+			found[name] = value
+		}
+	}
+	if len(found) == 0 {
+		return details, nil
+	}
+
+	raw, err := json.Marshal(found)
+	if err != nil {
+		return details, err
+	}
+	err = json.Unmarshal(raw, &details)
+	return details, err
+}
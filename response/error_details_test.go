@@ -0,0 +1,146 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/mocks"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+)
+
+type quota struct {
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+}
+
+var _ = Describe("Error Details", func() {
+	detailedError := func() ServiceError {
+		return NewServiceError(123, "validation failed").
+			WithFieldViolation("name", "required", nil).
+			WithFieldViolations(FieldViolation{Field: "age", Reason: "must be positive", Value: -1}).
+			WithMetadata("quota", quota{Limit: 10, Remaining: 0}).
+			WithRetryAfter(1500*time.Millisecond).
+			WithHelpLink("validation rules", "https://docs.test.org/rules")
+	}
+
+	It("should not modify the original error", func() {
+		// Arrange
+		original := NewServiceError(123, "validation failed").WithFieldViolation("name", "required", nil).WithMetadata("a", 1)
+
+		// Act
+		_ = original.WithFieldViolation("age", "required", nil).WithMetadata("b", 2).WithHelpLink("", "https://docs.test.org")
+
+		// Assert
+		Expect(original.(*SvcError).FieldViolations()).To(HaveLen(1))
+		Expect(original.(*SvcError).Metadata()).To(Equal(map[string]interface{}{"a": 1}))
+		Expect(original.(*SvcError).HelpLinks()).To(BeEmpty())
+		_, found := original.(*SvcError).RetryHint()
+		Expect(found).To(BeFalse())
+	})
+	It("should keep the wrapped error and details when adding text details", func() {
+		// Arrange
+		wrapped := errors.New("wrapped")
+
+		// Act
+		actual := NewServiceError(123, "abc").WithError(wrapped).WithFieldViolation("name", "required", nil).WithDetail("def")
+
+		// Assert
+		Expect(actual).To(MatchError(wrapped))
+		Expect(actual.Error()).To(Equal("123: abc: def: wrapped"))
+		Expect(actual.(*SvcError).FieldViolations()).To(HaveLen(1))
+	})
+	It("should marshal the details", func() {
+		// Act
+		raw, err := json.Marshal(detailedError())
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(raw).To(MatchJSON(`{
+			"code": 123, "description": "validation failed", "wrapped": "",
+			"violations": [{"field": "name", "reason": "required"}, {"field": "age", "reason": "must be positive", "value": -1}],
+			"metadata": {"quota": {"limit": 10, "remaining": 0}},
+			"retry": {"afterSeconds": 2},
+			"help": [{"description": "validation rules", "url": "https://docs.test.org/rules"}]
+		}`))
+	})
+	It("should not marshal empty details", func() {
+		raw, err := json.Marshal(NewServiceError(123, "abc"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(raw).To(MatchJSON(`{"code": 123, "description": "abc", "wrapped": ""}`))
+	})
+	DescribeTable("should round-trip the details",
+		func(encode func(ServiceError) ([]byte, error), decode func([]byte) (*SvcError, error)) {
+			// Arrange
+			raw, err := encode(detailedError())
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			actual, err := decode(raw)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actual.FieldViolations()).To(Equal([]FieldViolation{
+				{Field: "name", Reason: "required"}, {Field: "age", Reason: "must be positive", Value: float64(-1)},
+			}))
+			var q quota
+			Expect(actual.MetadataAs("quota", &q)).To(Succeed())
+			Expect(q).To(Equal(quota{Limit: 10}))
+			Expect(actual.MetadataAs("missing", &q)).To(MatchError(ErrorNoSuchMetadata))
+			hint, found := actual.RetryHint()
+			Expect(found).To(BeTrue())
+			Expect(hint.After).To(Equal(2 * time.Second))
+			Expect(actual.HelpLinks()).To(Equal([]HelpLink{{Description: "validation rules", URL: "https://docs.test.org/rules"}}))
+			Expect(actual.Extensions()).To(BeEmpty())
+		},
+		Entry("with service error json",
+			func(svcErr ServiceError) ([]byte, error) { return json.Marshal(svcErr) },
+			func(raw []byte) (*SvcError, error) {
+				var svcErr SvcError
+				err := json.Unmarshal(raw, &svcErr)
+				return &svcErr, err
+			}),
+		Entry("with problem json",
+			func(svcErr ServiceError) ([]byte, error) {
+				return json.Marshal(newProblem(http.StatusBadRequest, svcErr, ""))
+			},
+			func(raw []byte) (*SvcError, error) {
+				var problem Problem
+				err := json.Unmarshal(raw, &problem)
+				return problem.ServiceError().(*SvcError), err
+			}),
+	)
+	It("should keep details that cannot be decoded as extensions", func() {
+		// Arrange
+		problem := Problem{Title: "abc", Code: 123, Extensions: map[string]interface{}{"violations": "not a list"}}
+
+		// Act
+		actual := problem.ServiceError().(*SvcError)
+
+		// Assert
+		Expect(actual.FieldViolations()).To(BeEmpty())
+		Expect(actual.Extensions()).To(Equal(map[string]interface{}{"violations": "not a list"}))
+	})
+	It("should set the Retry-After header", func() {
+		// Arrange
+		ctrl := gomock.NewController(GinkgoT())
+		defer ctrl.Finish()
+		mockWriter := mocks.NewMockResponseWriter(ctrl)
+		headers := http.Header{}
+		mockWriter.EXPECT().Header().AnyTimes().Return(headers)
+		mockWriter.EXPECT().WriteHeader(http.StatusServiceUnavailable).Times(1)
+		mockWriter.EXPECT().Write(gomock.Any()).Times(1).Return(0, nil)
+
+		// Act
+		err := NewWriter(mockWriter).WriteErrorResponse(http.StatusServiceUnavailable, NewServiceError(123, "busy").WithRetryAfter(30*time.Second))
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(headers.Get(header.RetryAfter)).To(Equal("30"))
+	})
+})
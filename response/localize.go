@@ -0,0 +1,222 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"golang.org/x/text/language"
+)
+
+var (
+	ErrorLoadingCatalog  = errors.New("failed to load message catalog")
+	ErrorInvalidMessage  = errors.New("invalid message template")
+	ErrorInvalidLanguage = errors.New("invalid language tag")
+)
+
+// Localized service error descriptions, keyed by language and message key.
+//
+// Messages are text/template templates that are executed with the error's message arguments (see
+// SvcError.WithMessage), e.g. "le machin {{.id}} est cassé".  Errors without a message key use their code as the
+// key, e.g. "10500".
+type Catalog struct {
+	mtx             sync.RWMutex
+	defaultLanguage language.Tag
+	messages        map[language.Tag]map[string]*template.Template
+	matcher         language.Matcher // rebuilt when languages are added
+	matchTags       []language.Tag   // the languages known to the matcher, in its order
+}
+
+// Used by writers that don't set their own catalog (see Writer.WithCatalog); nil means descriptions are not localized
+var DefaultCatalog *Catalog
+
+// Make an empty catalog; the default language is used when the request's languages can't be matched,
+// and should be the language that the service error descriptions are written in.
+func NewCatalog(defaultLanguage language.Tag) *Catalog {
+	return &Catalog{defaultLanguage: defaultLanguage, messages: make(map[language.Tag]map[string]*template.Template)}
+}
+
+// Load a catalog from JSON files named after their language, e.g. "fr.json" or "fr-CA.json", in the root of fsys.
+//
+// Each file is an object of message keys and templates:
+//
+//	{"10500": "identifiant de ressource invalide", "whatsit.broken": "le machin {{.id}} est cassé"}
+func LoadCatalog(fsys fs.FS, defaultLanguage language.Tag) (*Catalog, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorLoadingCatalog, err)
+	}
+
+	catalog := NewCatalog(defaultLanguage)
+	for _, file := range files {
+		if err = catalog.loadFile(fsys, file); err != nil {
+			return nil, err
+		}
+	}
+	return catalog, nil
+}
+
+func (c *Catalog) loadFile(fsys fs.FS, file string) error {
+	tag, err := language.Parse(strings.TrimSuffix(path.Base(file), ".json"))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w: %w", ErrorLoadingCatalog, file, ErrorInvalidLanguage, err)
+	}
+	raw, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrorLoadingCatalog, file, err)
+	}
+	var messages map[string]string
+	if err = json.Unmarshal(raw, &messages); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrorLoadingCatalog, file, err)
+	}
+	for key, message := range messages {
+		if err = c.Add(tag, key, message); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrorLoadingCatalog, file, err)
+		}
+	}
+	return nil
+}
+
+// Add (or replace) a message
+func (c *Catalog) Add(tag language.Tag, key string, message string) error {
+	tmpl, err := template.New(key).Option("missingkey=zero").Parse(message)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", ErrorInvalidMessage, key, err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, found := c.messages[tag]; !found {
+		c.messages[tag] = make(map[string]*template.Template)
+		c.matcher = nil
+	}
+	c.messages[tag][key] = tmpl
+	return nil
+}
+
+// The languages that have messages; the default language is first
+func (c *Catalog) Languages() []language.Tag {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.languages()
+}
+
+func (c *Catalog) languages() []language.Tag {
+	tags := []language.Tag{c.defaultLanguage}
+	for tag := range c.messages {
+		if tag != c.defaultLanguage {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Choose the catalog language for an Accept-Language header value
+func (c *Catalog) Match(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return c.defaultLanguage
+	}
+
+	c.mtx.Lock()
+	if c.matcher == nil {
+		c.matchTags = c.languages()
+		c.matcher = language.NewMatcher(c.matchTags)
+	}
+	matcher, matchTags := c.matcher, c.matchTags
+	c.mtx.Unlock()
+
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return c.defaultLanguage
+	}
+	return matchTags[index]
+}
+
+// Returns the localized title of the service error and its language, or false if the catalog doesn't have a
+// message for it.
+//
+// Messages in the requested language are preferred; otherwise the default language is used.
+func (c *Catalog) localize(tag language.Tag, svcErr *SvcError) (string, language.Tag, bool) {
+	key := svcErr.messageKey
+	if key == "" {
+		key = strconv.Itoa(svcErr.Code)
+	}
+
+	c.mtx.RLock()
+	tmpl, found := c.messages[tag][key]
+	if !found {
+		tag = c.defaultLanguage
+		tmpl, found = c.messages[tag][key]
+	}
+	c.mtx.RUnlock()
+	if !found {
+		return "", tag, false
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, svcErr.messageArgs); err != nil {
+		return "", tag, false
+	}
+	return sb.String(), tag, true
+}
+
+// Set the catalog key and template arguments used to localize the description; returns a new error.
+//
+// The description is still used when the catalog has no message for the key.
+func (e *SvcError) WithMessage(key string, args map[string]interface{}) ServiceError {
+	c := e.clone()
+	c.messageKey = key
+	c.messageArgs = args
+	return c
+}
+
+// Localize the error's description according to the writer's locale (or the request's Accept-Language header),
+// and set the Content-Language header to match (unless it has been set already).  When the language comes from the
+// request, Vary: Accept-Language is added as well.
+//
+// Details added with WithDetail() are kept as they are.
+func (w Writer) localizeError(svcErr ServiceError) ServiceError {
+	catalog := w.catalog
+	if catalog == nil {
+		catalog = DefaultCatalog
+	}
+	se, ok := svcErr.(*SvcError)
+	if catalog == nil || !ok {
+		return svcErr
+	}
+
+	acceptLanguage := ""
+	if w.locale != language.Und {
+		acceptLanguage = w.locale.String()
+	} else if w.request != nil {
+		acceptLanguage = w.request.Header.Get(header.AcceptLanguage)
+		// the language depends on the request, so caches must keep a response for each one
+		addVary(w.writer.Header(), header.AcceptLanguage)
+	}
+	tag := catalog.Match(acceptLanguage)
+
+	title, tag, found := catalog.localize(tag, se)
+	if !found {
+		return svcErr
+	}
+
+	localized := se.clone()
+	localized.title = title
+	localized.Description = title
+	if detail := se.Detail(); detail != "" {
+		localized.Description = fmt.Sprintf("%s: %s", title, detail)
+	}
+	if w.writer.Header().Get(header.ContentLanguage) == "" {
+		// responses with many errors (e.g. batches) are in the language of the first
+		w.writer.Header().Set(header.ContentLanguage, tag.String())
+	}
+	return localized
+}
@@ -0,0 +1,144 @@
+package response
+
+import (
+	"net/http"
+	"testing/fstest"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/mocks"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/text/language"
+)
+
+var _ = Describe("Localization", func() {
+	catalogFiles := fstest.MapFS{
+		"en.json":    {Data: []byte(`{"whatsit.broken": "whatsit {{.id}} is broken"}`)},
+		"fr.json":    {Data: []byte(`{"10500": "identifiant de ressource invalide", "whatsit.broken": "le machin {{.id}} est cassé"}`)},
+		"de.json":    {Data: []byte(`{"10500": "ungültige Ressourcen-ID"}`)},
+		"README.txt": {Data: []byte("ignored")},
+	}
+
+	Context("LoadCatalog", func() {
+		It("should load messages for each language", func() {
+			// Act
+			catalog, err := LoadCatalog(catalogFiles, language.English)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(catalog.Languages()).To(HaveLen(3))
+			Expect(catalog.Languages()[0]).To(Equal(language.English))
+			Expect(catalog.Languages()).To(ContainElements(language.French, language.German))
+		})
+		DescribeTable("should fail to load invalid files",
+			func(files fstest.MapFS, expect error) {
+				_, err := LoadCatalog(files, language.English)
+				Expect(err).To(MatchError(ErrorLoadingCatalog))
+				Expect(err).To(MatchError(expect))
+			},
+			Entry("with invalid language", fstest.MapFS{"not a language.json": {Data: []byte(`{}`)}}, ErrorInvalidLanguage),
+			Entry("with invalid template", fstest.MapFS{"fr.json": {Data: []byte(`{"a": "{{.id"}`)}}, ErrorInvalidMessage),
+			Entry("with invalid json", fstest.MapFS{"fr.json": {Data: []byte(`["a"]`)}}, ErrorLoadingCatalog),
+		)
+	})
+
+	DescribeTable("Match",
+		func(acceptLanguage string, expect language.Tag) {
+			catalog, err := LoadCatalog(catalogFiles, language.English)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(catalog.Match(acceptLanguage)).To(Equal(expect))
+		},
+		Entry("with exact match", "fr", language.French),
+		Entry("with regional variant", "fr-CA", language.French),
+		Entry("with preferences", "es, de;q=0.8, fr;q=0.5", language.German),
+		Entry("with no match", "ja", language.English),
+		Entry("with no header", "", language.English),
+		Entry("with invalid header", "@@@", language.English),
+	)
+
+	Context("WriteErrorResponse", func() {
+		var (
+			ctrl        *gomock.Controller
+			mockWriter  *mocks.MockResponseWriter
+			httpHeaders http.Header
+			written     []byte
+			catalog     *Catalog
+		)
+		BeforeEach(func() {
+			ctrl = gomock.NewController(GinkgoT())
+			mockWriter = mocks.NewMockResponseWriter(ctrl)
+			httpHeaders = http.Header{}
+			written = nil
+			mockWriter.EXPECT().WriteHeader(http.StatusBadRequest).Times(1)
+			mockWriter.EXPECT().Header().AnyTimes().Return(httpHeaders)
+			mockWriter.EXPECT().Write(gomock.Any()).Times(1).DoAndReturn(func(data []byte) (int, error) {
+				written = data
+				return len(data), nil
+			})
+
+			var err error
+			catalog, err = LoadCatalog(catalogFiles, language.English)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			ctrl.Finish()
+		})
+
+		newRequest := func(acceptLanguage string) *http.Request {
+			req, err := http.NewRequest(http.MethodGet, "/whatsits/123", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set(header.AcceptLanguage, acceptLanguage)
+			return req
+		}
+
+		DescribeTable("should localize the description",
+			func(acceptLanguage string, svcErr ServiceError, expectLanguage string, expectDescription string) {
+				// Arrange
+				writer := NewWriter(mockWriter).WithRequest(newRequest(acceptLanguage)).WithCatalog(catalog)
+
+				// Act
+				err := writer.WriteErrorResponse(http.StatusBadRequest, svcErr)
+
+				// Assert
+				Expect(err).ToNot(HaveOccurred())
+				Expect(httpHeaders.Get(header.ContentLanguage)).To(Equal(expectLanguage))
+				Expect(httpHeaders.Values(header.Vary)).To(Equal([]string{header.AcceptLanguage}))
+				var actual SvcError
+				Expect(actual.UnmarshalJSON(written)).To(Succeed())
+				Expect(actual.Description).To(Equal(expectDescription))
+			},
+			Entry("with code key", "fr-CA", SvcErrorInvalidResourceId, "fr", "identifiant de ressource invalide"),
+			Entry("with code key and detail", "de", SvcErrorInvalidResourceId.WithDetail("abc"), "de", "ungültige Ressourcen-ID: abc"),
+			Entry("with message key and args", "fr", NewServiceError(20000, "whatsit is broken").WithMessage("whatsit.broken", map[string]interface{}{"id": 123}), "fr", "le machin 123 est cassé"),
+			Entry("with fallback to default language", "de", NewServiceError(20000, "whatsit is broken").WithMessage("whatsit.broken", map[string]interface{}{"id": 123}), "en", "whatsit 123 is broken"),
+			Entry("with fallback to description", "fr", SvcErrorInvalidMethod.WithDetail("PUT"), "", "invalid request method: PUT"),
+		)
+		It("should prefer the writer's locale", func() {
+			// Arrange
+			writer := NewWriter(mockWriter).WithRequest(newRequest("de")).WithCatalog(catalog).WithLocale(language.French)
+
+			// Act
+			err := writer.WriteErrorResponse(http.StatusBadRequest, SvcErrorInvalidResourceId)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(written).To(MatchJSON(`{"code":10500,"description":"identifiant de ressource invalide","wrapped":""}`))
+			Expect(httpHeaders.Get(header.ContentLanguage)).To(Equal("fr"))
+			Expect(httpHeaders.Values(header.Vary)).To(BeEmpty())
+		})
+		It("should use the default catalog", func() {
+			// Arrange
+			DefaultCatalog = catalog
+			defer func() { DefaultCatalog = nil }()
+
+			// Act
+			err := NewWriter(mockWriter).WithRequest(newRequest("fr")).WithErrorFormat(ErrorFormatProblem).WriteErrorResponse(http.StatusBadRequest, SvcErrorInvalidResourceId.WithDetail("abc"))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(written).To(MatchJSON(`{"title":"identifiant de ressource invalide","detail":"abc","status":400,"instance":"/whatsits/123","code":10500}`))
+		})
+	})
+})
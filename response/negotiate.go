@@ -0,0 +1,137 @@
+package response
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+)
+
+// Set the MIME types that Negotiate() may choose from, in order of preference.
+//
+// By default every MIME type with a registered codec is offered, with JSON preferred (see rw.MimeTypes()).
+// Each type needs a registered codec in order to be written.
+func (w Writer) WithOffers(mimeTypes ...string) Writer {
+	w.offers = mimeTypes
+	return w
+}
+
+// Writes the object using the MIME type that best matches the request's Accept header.
+//
+// If the request has no Accept header the most-preferred type is used.  If none of the offered types are
+// acceptable a 406 (Not Acceptable) error response, listing the offered types, is written instead.  Either way the
+// response has Vary: Accept.
+func (w Writer) Negotiate(r *http.Request, statusCode int, object interface{}) error {
+	accept := strings.Join(r.Header.Values(header.Accept), ",")
+	offers := w.getOffers()
+	mimeType, ok := negotiateMimeType(accept, offers)
+	// the response depends on the Accept header either way
+	addVary(w.writer.Header(), header.Accept)
+	if !ok {
+		return w.WriteErrorResponse(http.StatusNotAcceptable, SvcErrorNotAcceptable.WithDetail("supported types: "+strings.Join(offers, ", ")))
+	}
+	return w.WriteEncodedResponse(statusCode, object, mimeType)
+}
+
+// Adds the request header to Vary, unless it is there already
+func addVary(h http.Header, name string) {
+	for _, value := range h.Values(header.Vary) {
+		for _, varied := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(varied), name) {
+				return
+			}
+		}
+	}
+	h.Add(header.Vary, name)
+}
+
+func (w Writer) getOffers() []string {
+	if len(w.offers) > 0 {
+		return w.offers
+	}
+	return rw.MimeTypes()
+}
+
+type mediaRange struct {
+	mediaType string
+	subType   string
+	quality   float64
+}
+
+// returns how specifically the range matches the MIME type: 0 = no match, 1 = */*, 2 = type/*, 3 = type/subtype
+func (m mediaRange) match(mediaType string, subType string) int {
+	switch {
+	case m.mediaType == "*" && m.subType == "*":
+		return 1
+	case m.mediaType != mediaType:
+		return 0
+	case m.subType == "*":
+		return 2
+	case m.subType == subType:
+		return 3
+	}
+	return 0
+}
+
+// Parses an Accept header into its media ranges; invalid ranges are ignored
+func parseAccept(accept string) []mediaRange {
+	ranges := make([]mediaRange, 0)
+	for _, value := range strings.Split(accept, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(value)
+		if err != nil {
+			continue
+		}
+		fullType, subType, found := strings.Cut(mediaType, "/")
+		if !found {
+			continue
+		}
+
+		quality := 1.0
+		if q, found := params["q"]; found {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: fullType, subType: subType, quality: quality})
+	}
+	return ranges
+}
+
+// Chooses the offer with the highest quality, using the most specific matching range for each offer (RFC 9110 12.5.1).
+// Ties go to the offer that comes first.
+func negotiateMimeType(accept string, offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+	best := ""
+	bestQuality := 0.0
+	for _, offer := range offers {
+		mediaType, subType, _ := strings.Cut(strings.ToLower(offer), "/")
+
+		specificity := 0
+		quality := 0.0
+		for _, r := range ranges {
+			if s := r.match(mediaType, subType); s > specificity {
+				specificity = s
+				quality = r.quality
+			}
+		}
+		if quality > bestQuality {
+			best = offer
+			bestQuality = quality
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,125 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/mocks"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Content Negotiation", func() {
+	Context("negotiateMimeType", func() {
+		offers := []string{header.MimeTypeJson, header.MimeTypeXml, "text/csv"}
+
+		DescribeTable("Validation",
+			func(accept string, expectType string, expectOk bool) {
+				// Act
+				mimeType, ok := negotiateMimeType(accept, offers)
+
+				// Assert
+				Expect(ok).To(Equal(expectOk))
+				Expect(mimeType).To(Equal(expectType))
+			},
+			Entry("with no accept header uses first offer", "", header.MimeTypeJson, true),
+			Entry("with exact match uses match", "text/csv", "text/csv", true),
+			Entry("with full wildcard uses first offer", "*/*", header.MimeTypeJson, true),
+			Entry("with type wildcard uses first matching offer", "text/*", "text/csv", true),
+			Entry("with quality values uses highest quality", "application/json;q=0.5, application/xml;q=0.9", header.MimeTypeXml, true),
+			Entry("with specific range overriding wildcard", "application/*;q=0.9, application/json;q=0.1", header.MimeTypeXml, true),
+			Entry("with zero quality excludes offer", "application/json;q=0, */*;q=0.1", header.MimeTypeXml, true),
+			Entry("with case differences still matches", "Application/XML", header.MimeTypeXml, true),
+			Entry("with invalid ranges ignores them", "not-a-type, text/csv;q=abc, application/xml;q=2, text/csv", "text/csv", true),
+			Entry("with no acceptable offer fails", "image/png", "", false),
+			Entry("with everything excluded fails", "*/*;q=0", "", false),
+		)
+		It("should fail when there are no offers", func() {
+			_, ok := negotiateMimeType("*/*", nil)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("Negotiate", func() {
+		var (
+			ctrl        *gomock.Controller
+			mockWriter  *mocks.MockResponseWriter
+			httpHeaders http.Header
+			written     []byte
+		)
+		BeforeEach(func() {
+			ctrl = gomock.NewController(GinkgoT())
+			mockWriter = mocks.NewMockResponseWriter(ctrl)
+			httpHeaders = http.Header{}
+			written = nil
+			mockWriter.EXPECT().Header().AnyTimes().Return(httpHeaders)
+			mockWriter.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(data []byte) (int, error) {
+				written = append(written, data...)
+				return len(data), nil
+			})
+		})
+		AfterEach(func() {
+			ctrl.Finish()
+		})
+
+		DescribeTable("should write the negotiated type",
+			func(accept []string, expectType string, expectData string) {
+				// Arrange
+				mockWriter.EXPECT().WriteHeader(http.StatusOK).Times(1)
+				req, err := http.NewRequest(http.MethodGet, "/test", nil)
+				Expect(err).ToNot(HaveOccurred())
+				for _, value := range accept {
+					req.Header.Add(header.Accept, value)
+				}
+
+				// Act
+				err = NewWriter(mockWriter).Negotiate(req, http.StatusOK, testData{"simple"})
+
+				// Assert
+				Expect(err).ToNot(HaveOccurred())
+				Expect(httpHeaders.Get(header.ContentType)).To(Equal(expectType))
+				Expect(httpHeaders.Get(header.Vary)).To(Equal(header.Accept))
+				Expect(string(written)).To(Equal(expectData))
+			},
+			Entry("with no accept header writes json", nil, header.MimeTypeJson, `{"name":"simple"}`),
+			Entry("with xml accept header writes xml", []string{"application/xml"}, header.MimeTypeXml, `<testData><Name>simple</Name></testData>`),
+			Entry("with multiple accept headers uses all of them", []string{"text/html", "application/xml;q=0.5"}, header.MimeTypeXml, `<testData><Name>simple</Name></testData>`),
+		)
+		It("should only use the writer's offers", func() {
+			// Arrange
+			mockWriter.EXPECT().WriteHeader(http.StatusOK).Times(1)
+			req, err := http.NewRequest(http.MethodGet, "/test", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set(header.Accept, "application/json;q=0.5, */*")
+
+			// Act
+			err = NewWriter(mockWriter).WithOffers(header.MimeTypeCbor, header.MimeTypeJson).Negotiate(req, http.StatusOK, testData{"ok"})
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(httpHeaders.Get(header.ContentType)).To(Equal(header.MimeTypeCbor))
+		})
+		It("should write 406 when nothing is acceptable", func() {
+			// Arrange
+			mockWriter.EXPECT().WriteHeader(http.StatusNotAcceptable).Times(1)
+			req, err := http.NewRequest(http.MethodGet, "/test", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set(header.Accept, "image/png")
+
+			// Act
+			err = NewWriter(mockWriter).WithOffers(header.MimeTypeJson, header.MimeTypeXml).Negotiate(req, http.StatusOK, testData{"simple"})
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			var svcErr SvcError
+			Expect(json.Unmarshal(written, &svcErr)).To(Succeed())
+			Expect(&svcErr).To(MatchError(SvcErrorNotAcceptable))
+			Expect(svcErr.Description).To(ContainSubstring("supported types: application/json, application/xml"))
+			Expect(svcErr.Description).ToNot(ContainSubstring("image/png"))
+			Expect(httpHeaders.Values(header.Vary)).To(Equal([]string{header.Accept}))
+		})
+	})
+})
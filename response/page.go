@@ -0,0 +1,53 @@
+package response
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+)
+
+// The query parameter that carries a page's cursor, in the Link headers written by WritePage
+const CursorParam = "cursor"
+
+// A page of a list: the items, and the cursor of the next page (empty on the last page)
+type Page struct {
+	Items interface{} `json:"items"`
+	Next  string      `json:"next,omitempty"`
+}
+
+// Add a Link header (RFC 8288), e.g. AddLink("next", "/foos?cursor=abc")
+func (w Writer) AddLink(rel string, target string) Writer {
+	w.writer.Header().Add(header.Link, fmt.Sprintf("<%s>; rel=%q", target, rel))
+	return w
+}
+
+// Writes a page of a list, with a Link to the next page if there is one: the request's URL (see WithRequest) with
+// its cursor set to page.Next.  The page is written using the request's Accept header (see Negotiate), or as JSON
+// if there isn't a request.
+func (w Writer) WritePage(statusCode int, page Page) error {
+	if w.request == nil {
+		return w.WriteJsonResponse(statusCode, page)
+	}
+	if page.Next != "" {
+		w.AddLink("next", pageURL(w.request.URL, page.Next))
+	}
+	return w.Negotiate(w.request, statusCode, page)
+}
+
+// The path and query of the page with the cursor; offsets don't mix with cursors, so the offset is removed.  The
+// other parameters are kept as they are, since re-encoding them would break filters such as created>=2024-01-01.
+func pageURL(current *url.URL, cursor string) string {
+	var parts []string
+	for _, part := range strings.Split(current.RawQuery, "&") {
+		name, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(name); part == "" || (err == nil && (name == CursorParam || name == "offset")) {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	parts = append(parts, CursorParam+"="+url.QueryEscape(cursor))
+	next := url.URL{Path: current.Path, RawPath: current.RawPath, RawQuery: strings.Join(parts, "&")}
+	return next.String()
+}
@@ -0,0 +1,65 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/keithpaterson/resweave-utils/header"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pages", func() {
+	It("should write a page with a link to the next page", func() {
+		// Arrange
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/foos?status=active&created>=2024-01-01&offset=40&cursor=old", nil)
+
+		// Act
+		err := NewWriter(recorder).WithRequest(req).WritePage(http.StatusOK, Page{Items: []int{1, 2}, Next: "abc"})
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get(header.Link)).To(Equal(`</foos?status=active&created>=2024-01-01&cursor=abc>; rel="next"`))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"items": [1, 2], "next": "abc"}`))
+	})
+
+	It("should write the last page without a link", func() {
+		// Arrange
+		recorder := httptest.NewRecorder()
+
+		// Act
+		err := NewWriter(recorder).WithRequest(httptest.NewRequest(http.MethodGet, "/foos", nil)).WritePage(http.StatusOK, Page{Items: []int{}})
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Header().Values(header.Link)).To(BeEmpty())
+		Expect(recorder.Body.String()).To(MatchJSON(`{"items": []}`))
+	})
+
+	It("should write pages as json without a request", func() {
+		// Arrange
+		recorder := httptest.NewRecorder()
+
+		// Act
+		err := NewWriter(recorder).WritePage(http.StatusOK, Page{Items: []string{"a"}, Next: "abc"})
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Header().Get(header.ContentType)).To(Equal(header.MimeTypeJson))
+		Expect(recorder.Header().Values(header.Link)).To(BeEmpty())
+	})
+
+	It("should add links", func() {
+		// Arrange
+		recorder := httptest.NewRecorder()
+
+		// Act
+		NewWriter(recorder).AddLink("prev", "/foos?cursor=a").AddLink("next", "/foos?cursor=b")
+
+		// Assert
+		Expect(recorder.Header().Values(header.Link)).To(Equal([]string{`</foos?cursor=a>; rel="prev"`, `</foos?cursor=b>; rel="next"`}))
+	})
+})
@@ -0,0 +1,245 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/keithpaterson/resweave-utils/header"
+)
+
+// How service errors are written to responses
+type ErrorFormat int
+
+const (
+	ErrorFormatDefault      ErrorFormat = iota // use DefaultErrorFormat
+	ErrorFormatServiceError                    // {"code":..., "description":..., "wrapped":...} as "application/json"
+	ErrorFormatProblem                         // RFC 9457 "application/problem+json"
+	ErrorFormatNegotiate                       // problem+json if the request's Accept header prefers it, otherwise ErrorFormatServiceError
+)
+
+// Used by writers that don't set their own error format (see Writer.WithErrorFormat)
+var DefaultErrorFormat = ErrorFormatServiceError
+
+// If set, problem+json responses use this base plus the error code as the problem type,
+// e.g. "https://errors.test.org/" gives "https://errors.test.org/10500".
+//
+// Otherwise the type is omitted, which is equivalent to "about:blank".
+var ProblemTypeBaseURI = ""
+
+// RFC 9457 problem details, plus the service error code and any extension members
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Code       int
+	Extensions map[string]interface{}
+}
+
+var problemMembers = []string{"type", "title", "status", "detail", "instance", "code"}
+
+func newProblem(statusCode int, svcErr ServiceError, instance string) Problem {
+	problem := Problem{Status: statusCode, Instance: instance}
+
+	var se *SvcError
+	if !errors.As(svcErr, &se) {
+		problem.Title = svcErr.Error()
+		return problem
+	}
+	problem.Code = se.Code
+	problem.Title = se.Title()
+	problem.Detail = se.Detail()
+	problem.Extensions = se.details.toExtensions(se.extensions)
+	if se.correlationId != "" {
+		problem.Extensions = withMember(problem.Extensions, correlationIdMember, se.correlationId)
+	}
+	if ProblemTypeBaseURI != "" {
+		problem.Type = fmt.Sprintf("%s%d", ProblemTypeBaseURI, se.Code)
+	}
+	return problem
+}
+
+// Reconstruct the service error that the problem describes
+func (p Problem) ServiceError() ServiceError {
+	svcErr := &SvcError{Code: p.Code, Description: p.Title, extensions: p.Extensions}
+	if id, ok := p.Extensions[correlationIdMember].(string); ok {
+		svcErr.correlationId = id
+		svcErr.extensions = withoutMembers(svcErr.extensions, correlationIdMember)
+	}
+	// details that can't be decoded are left as extensions
+	if details, err := detailsFromExtensions(svcErr.extensions); err == nil {
+		svcErr.details = details
+		svcErr.extensions = withoutMembers(svcErr.extensions, detailMembers...)
+	}
+	if p.Detail != "" {
+		svcErr.Description = fmt.Sprintf("%s: %s", p.Title, p.Detail)
+		svcErr.title = p.Title
+	}
+	return svcErr
+}
+
+// copy-on-write helpers for extension members
+func withMember(members map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(members)+1)
+	for k, v := range members {
+		c[k] = v
+	}
+	c[name] = value
+	return c
+}
+
+func withoutMembers(members map[string]interface{}, names ...string) map[string]interface{} {
+	c := make(map[string]interface{}, len(members))
+	for k, v := range members {
+		c[k] = v
+	}
+	for _, name := range names {
+		delete(c, name)
+	}
+	if len(c) == 0 {
+		return nil
+	}
+	return c
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+len(problemMembers))
+	for name, value := range p.Extensions {
+		members[name] = value
+	}
+	// standard members can't be overridden by extensions
+	for _, name := range problemMembers {
+		delete(members, name)
+	}
+	setIf := func(name string, value interface{}, isSet bool) {
+		if isSet {
+			members[name] = value
+		}
+	}
+	setIf("type", p.Type, p.Type != "")
+	setIf("title", p.Title, p.Title != "")
+	setIf("status", p.Status, p.Status != 0)
+	setIf("detail", p.Detail, p.Detail != "")
+	setIf("instance", p.Instance, p.Instance != "")
+	members["code"] = p.Code
+	return json.Marshal(members)
+}
+
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	*p = Problem{}
+	fields := map[string]interface{}{
+		"type": &p.Type, "title": &p.Title, "status": &p.Status, "detail": &p.Detail, "instance": &p.Instance, "code": &p.Code,
+	}
+	for name, raw := range members {
+		if field, found := fields[name]; found {
+			if err := json.Unmarshal(raw, field); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]interface{})
+		}
+		p.Extensions[name] = value
+	}
+	return nil
+}
+
+// Choose the format for the writer; ErrorFormatNegotiate requires the request (see Writer.WithRequest)
+func (w Writer) resolveErrorFormat() ErrorFormat {
+	format := w.errorFormat
+	if format == ErrorFormatDefault {
+		format = DefaultErrorFormat
+	}
+	if format != ErrorFormatNegotiate {
+		return format
+	}
+
+	if w.request != nil {
+		accept := strings.Join(w.request.Header.Values(header.Accept), ",")
+		if mimeType, _ := negotiateMimeType(accept, []string{header.MimeTypeJson, header.MimeTypeProblemJson}); mimeType == header.MimeTypeProblemJson {
+			return ErrorFormatProblem
+		}
+	}
+	return ErrorFormatServiceError
+}
+
+// returns the encoded error and its MIME type
+func (w Writer) marshalError(statusCode int, svcErr ServiceError) ([]byte, string, error) {
+	svcErr = w.redactError(svcErr)
+
+	var raw []byte
+	var err error
+	mimeType := header.MimeTypeJson
+	if w.resolveErrorFormat() == ErrorFormatProblem {
+		instance := ""
+		if w.request != nil {
+			instance = w.request.URL.RequestURI()
+		}
+		raw, err = json.Marshal(newProblem(statusCode, svcErr, instance))
+		mimeType = header.MimeTypeProblemJson
+	} else {
+		raw, err = json.Marshal(svcErr)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	raw, err = w.redactionPolicy().filterFields(raw)
+	return raw, mimeType, err
+}
+
+// Read a service error from an error response in either format
+func parseServiceError(resp *http.Response) (ServiceError, error) {
+	if resp.Body == nil {
+		return nil, ErrorNonstandardResponse
+	}
+	var raw json.RawMessage
+	if err := parseJsonData(resp.Body, &raw); err != nil {
+		return nil, err
+	}
+
+	if isProblemResponse(resp, raw) {
+		var problem Problem
+		if err := json.Unmarshal(raw, &problem); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrorBadResponseBody, err)
+		}
+		return problem.ServiceError(), nil
+	}
+
+	var svcErr SvcError
+	if err := json.Unmarshal(raw, &svcErr); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorBadResponseBody, err)
+	}
+	return &svcErr, nil
+}
+
+// Uses the content type if there is one, otherwise looks for problem members in the data
+func isProblemResponse(resp *http.Response, raw json.RawMessage) bool {
+	if strings.HasPrefix(resp.Header.Get(header.ContentType), header.MimeTypeProblemJson) {
+		return true
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return false
+	}
+	_, hasDescription := members["description"]
+	_, hasTitle := members["title"]
+	_, hasStatus := members["status"]
+	return !hasDescription && (hasTitle || hasStatus)
+}
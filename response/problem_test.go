@@ -0,0 +1,199 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/mocks"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Problem Details", func() {
+	Context("Problem JSON", func() {
+		It("should marshal standard members, code and extensions", func() {
+			// Arrange
+			problem := Problem{
+				Type: "https://errors.test.org/10500", Title: "invalid resource id", Status: http.StatusBadRequest,
+				Detail: "abc", Instance: "/foo/abc", Code: 10500,
+				Extensions: map[string]interface{}{"traceId": "123", "title": "ignored"},
+			}
+
+			// Act
+			raw, err := json.Marshal(problem)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(raw).To(MatchJSON(`{
+				"type":"https://errors.test.org/10500", "title":"invalid resource id", "status":400,
+				"detail":"abc", "instance":"/foo/abc", "code":10500, "traceId":"123"
+			}`))
+		})
+		It("should omit empty members except code", func() {
+			raw, err := json.Marshal(Problem{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(raw).To(MatchJSON(`{"code":0}`))
+		})
+		It("should unmarshal standard members, code and extensions", func() {
+			// Act
+			var problem Problem
+			err := json.Unmarshal([]byte(`{"title":"not acceptable","status":406,"code":10600,"traceId":"123","retry":{"after":5}}`), &problem)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(problem).To(Equal(Problem{
+				Title: "not acceptable", Status: http.StatusNotAcceptable, Code: 10600,
+				Extensions: map[string]interface{}{"traceId": "123", "retry": map[string]interface{}{"after": float64(5)}},
+			}))
+		})
+		DescribeTable("should fail to unmarshal invalid data",
+			func(data string) {
+				var problem Problem
+				Expect(json.Unmarshal([]byte(data), &problem)).ToNot(Succeed())
+			},
+			Entry("with non-object", `[1,2]`),
+			Entry("with invalid standard member", `{"status":"bad"}`),
+		)
+	})
+
+	Context("newProblem", func() {
+		It("should describe a service error without leaking the wrapped error", func() {
+			// Arrange
+			svcErr := SvcErrorInvalidMethod.WithDetail("PUT").WithExtension("allowed", []string{"GET"}).WithError(errors.New("secret"))
+
+			// Act
+			problem := newProblem(http.StatusMethodNotAllowed, svcErr, "/foo")
+
+			// Assert
+			Expect(problem).To(Equal(Problem{
+				Title: "invalid request method", Status: http.StatusMethodNotAllowed, Detail: "PUT", Instance: "/foo", Code: 10400,
+				Extensions: map[string]interface{}{"allowed": []string{"GET"}},
+			}))
+		})
+		It("should use the problem type base uri when set", func() {
+			// Arrange
+			ProblemTypeBaseURI = "https://errors.test.org/"
+			defer func() { ProblemTypeBaseURI = "" }()
+
+			// Act
+			problem := newProblem(http.StatusBadRequest, SvcErrorInvalidResourceId, "")
+
+			// Assert
+			Expect(problem.Type).To(Equal("https://errors.test.org/10500"))
+		})
+		It("should round-trip a service error", func() {
+			// Arrange
+			svcErr := NewServiceError(123, "abc").WithDetail("def").WithExtension("x", "y")
+
+			// Act
+			actual := newProblem(http.StatusBadRequest, svcErr, "").ServiceError()
+
+			// Assert
+			Expect(actual.Error()).To(Equal(svcErr.Error()))
+			Expect(actual).To(MatchError(svcErr))
+			Expect(actual.(*SvcError).Title()).To(Equal("abc"))
+			Expect(actual.(*SvcError).Extensions()).To(Equal(map[string]interface{}{"x": "y"}))
+		})
+	})
+
+	Context("WriteErrorResponse", func() {
+		var (
+			ctrl        *gomock.Controller
+			mockWriter  *mocks.MockResponseWriter
+			httpHeaders http.Header
+			written     []byte
+		)
+		BeforeEach(func() {
+			ctrl = gomock.NewController(GinkgoT())
+			mockWriter = mocks.NewMockResponseWriter(ctrl)
+			httpHeaders = http.Header{}
+			written = nil
+			mockWriter.EXPECT().WriteHeader(http.StatusBadRequest).Times(1)
+			mockWriter.EXPECT().Header().AnyTimes().Return(httpHeaders)
+			mockWriter.EXPECT().Write(gomock.Any()).Times(1).DoAndReturn(func(data []byte) (int, error) {
+				written = data
+				return len(data), nil
+			})
+		})
+		AfterEach(func() {
+			ctrl.Finish()
+		})
+
+		newRequest := func(accept string) *http.Request {
+			req, err := http.NewRequest(http.MethodGet, "/foo/abc?x=1", nil)
+			Expect(err).ToNot(HaveOccurred())
+			if accept != "" {
+				req.Header.Set(header.Accept, accept)
+			}
+			return req
+		}
+
+		DescribeTable("should write the selected format",
+			func(format ErrorFormat, accept string, expectProblem bool) {
+				// Arrange
+				writer := NewWriter(mockWriter).WithRequest(newRequest(accept)).WithErrorFormat(format)
+
+				// Act
+				err := writer.WriteErrorResponse(http.StatusBadRequest, SvcErrorInvalidResourceId.WithDetail("abc"))
+
+				// Assert
+				Expect(err).ToNot(HaveOccurred())
+				if expectProblem {
+					Expect(httpHeaders.Get(header.ContentType)).To(Equal(header.MimeTypeProblemJson))
+					Expect(written).To(MatchJSON(`{"title":"invalid resource id","status":400,"detail":"abc","instance":"/foo/abc?x=1","code":10500}`))
+				} else {
+					Expect(httpHeaders.Get(header.ContentType)).To(Equal(header.MimeTypeJson))
+					Expect(written).To(MatchJSON(`{"code":10500,"description":"invalid resource id: abc","wrapped":""}`))
+				}
+			},
+			Entry("with default format writes service error", ErrorFormatDefault, header.MimeTypeProblemJson, false),
+			Entry("with service error format writes service error", ErrorFormatServiceError, header.MimeTypeProblemJson, false),
+			Entry("with problem format writes problem", ErrorFormatProblem, "", true),
+			Entry("with negotiated problem writes problem", ErrorFormatNegotiate, "application/problem+json, application/json;q=0.5", true),
+			Entry("with negotiated json writes service error", ErrorFormatNegotiate, "application/json", false),
+			Entry("with negotiated wildcard writes service error", ErrorFormatNegotiate, "*/*", false),
+			Entry("with negotiated but no accept writes service error", ErrorFormatNegotiate, "", false),
+		)
+		It("should use the default error format", func() {
+			// Arrange
+			DefaultErrorFormat = ErrorFormatProblem
+			defer func() { DefaultErrorFormat = ErrorFormatServiceError }()
+
+			// Act
+			err := NewWriter(mockWriter).WriteErrorResponse(http.StatusBadRequest, SvcErrorInvalidResourceId)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(httpHeaders.Get(header.ContentType)).To(Equal(header.MimeTypeProblemJson))
+			Expect(written).To(MatchJSON(`{"title":"invalid resource id","status":400,"code":10500}`))
+		})
+	})
+
+	Context("ParseResponse", func() {
+		DescribeTable("should reconstruct service errors from either format",
+			func(mimeType string, body string, expect ServiceError) {
+				// Arrange
+				resp := &http.Response{StatusCode: http.StatusBadRequest, Header: http.Header{}, Body: io.NopCloser(bytes.NewBufferString(body))}
+				if mimeType != "" {
+					resp.Header.Set(header.ContentType, mimeType)
+				}
+
+				// Act
+				err := ParseResponse(resp, http.StatusOK)
+
+				// Assert
+				Expect(err).To(MatchError(expect))
+				Expect(err.Error()).To(Equal(expect.Error()))
+			},
+			Entry("with service error", header.MimeTypeJson, `{"code":10500,"description":"invalid resource id: abc"}`, SvcErrorInvalidResourceId.WithDetail("abc")),
+			Entry("with problem", header.MimeTypeProblemJson, `{"title":"invalid resource id","detail":"abc","status":400,"code":10500}`, SvcErrorInvalidResourceId.WithDetail("abc")),
+			Entry("with problem and no content type", "", `{"title":"invalid resource id","status":400,"code":10500}`, SvcErrorInvalidResourceId),
+		)
+	})
+})
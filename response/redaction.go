@@ -0,0 +1,122 @@
+package response
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/logging"
+)
+
+// How much of a wrapped error is exposed to clients
+type ErrorExposure int
+
+const (
+	ExposeFull          ErrorExposure = iota // the wrapped error's text is written (development)
+	ExposeCorrelationId                      // a correlation id is written instead; the wrapped error is logged (production)
+)
+
+// the member that holds the correlation id in both error formats
+const correlationIdMember = "correlationId"
+
+// Controls what error responses reveal about wrapped errors.
+//
+// e.g. for production:
+//
+//	response.DefaultRedactionPolicy = response.RedactionPolicy{
+//	  Exposure:      response.ExposeCorrelationId,
+//	  AllowedFields: []string{"description", "title", "status", "detail"},
+//	  Logger:        logging.LogFactory{LogHolder: holder},
+//	}
+type RedactionPolicy struct {
+	Exposure ErrorExposure
+
+	// When set, only these members (plus "code" and the correlation id) are written; this applies to
+	// extension members as well.
+	AllowedFields []string
+
+	// Where wrapped errors are logged, along with their correlation id, when they are not exposed
+	Logger logging.LogFactory
+
+	// Makes correlation ids when the request doesn't have one (see header.CorrelationId); defaults to random ids
+	NewCorrelationId func() string
+}
+
+// Used by writers that don't set their own policy (see Writer.WithRedaction)
+var DefaultRedactionPolicy = RedactionPolicy{Exposure: ExposeFull}
+
+func (p RedactionPolicy) isAllowed(name string) bool {
+	if len(p.AllowedFields) == 0 || name == "code" || name == correlationIdMember {
+		return true
+	}
+	for _, allowed := range p.AllowedFields {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Writer) redactionPolicy() RedactionPolicy {
+	if w.redaction != nil {
+		return *w.redaction
+	}
+	return DefaultRedactionPolicy
+}
+
+// Returns the service error as it should be exposed; with ExposeCorrelationId the wrapped error is replaced
+// by a correlation id, and logged if the policy has a logger.
+func (w Writer) redactError(svcErr ServiceError) ServiceError {
+	policy := w.redactionPolicy()
+	se, ok := svcErr.(*SvcError)
+	if !ok || policy.Exposure == ExposeFull || se.wrapped == nil {
+		return svcErr
+	}
+
+	id := w.correlationId(policy)
+	if policy.Logger.LogHolder != nil {
+		policy.Logger.NewError("WriteErrorResponse", se).With(correlationIdMember, id).Log()
+	}
+	redacted := se.clone()
+	redacted.wrapped = nil
+	redacted.correlationId = id
+	return redacted
+}
+
+func (w Writer) correlationId(policy RedactionPolicy) string {
+	if w.request != nil {
+		if id := w.request.Header.Get(header.CorrelationId); id != "" {
+			return id
+		}
+	}
+	if policy.NewCorrelationId != nil {
+		return policy.NewCorrelationId()
+	}
+	return newCorrelationId()
+}
+
+func newCorrelationId() string {
+	id := make([]byte, 16)
+	// crypto/rand.Read never returns an error on supported platforms
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Removes the members that the policy doesn't allow from an encoded error
+func (p RedactionPolicy) filterFields(raw []byte) ([]byte, error) {
+	if len(p.AllowedFields) == 0 {
+		return raw, nil
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return nil, err
+	}
+	for name := range members {
+		if !p.isAllowed(name) {
+			delete(members, name)
+		}
+	}
+	return json.Marshal(members)
+}
@@ -0,0 +1,146 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/logging"
+	"github.com/keithpaterson/resweave-utils/mocks"
+	"github.com/mortedecai/resweave"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var _ = Describe("Redaction", func() {
+	var (
+		ctrl       *gomock.Controller
+		mockWriter *mocks.MockResponseWriter
+		written    []byte
+	)
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		mockWriter = mocks.NewMockResponseWriter(ctrl)
+		written = nil
+		mockWriter.EXPECT().WriteHeader(http.StatusInternalServerError).Times(1)
+		mockWriter.EXPECT().Header().AnyTimes().Return(http.Header{})
+		mockWriter.EXPECT().Write(gomock.Any()).Times(1).DoAndReturn(func(data []byte) (int, error) {
+			written = data
+			return len(data), nil
+		})
+	})
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	fixedId := func() string { return "abc123" }
+	secretError := func() ServiceError {
+		return NewServiceError(123, "storage failed").WithError(errors.New("open /var/secret/db: permission denied"))
+	}
+
+	DescribeTable("should expose wrapped errors according to the policy",
+		func(policy RedactionPolicy, format ErrorFormat, expect string) {
+			// Arrange
+			writer := NewWriter(mockWriter).WithRedaction(policy).WithErrorFormat(format)
+
+			// Act
+			err := writer.WriteErrorResponse(http.StatusInternalServerError, secretError())
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(written).To(MatchJSON(expect))
+		},
+		Entry("with full exposure", RedactionPolicy{Exposure: ExposeFull}, ErrorFormatServiceError,
+			`{"code":123,"description":"storage failed","wrapped":"open /var/secret/db: permission denied"}`),
+		Entry("with correlation id", RedactionPolicy{Exposure: ExposeCorrelationId, NewCorrelationId: fixedId}, ErrorFormatServiceError,
+			`{"code":123,"description":"storage failed","wrapped":"","correlationId":"abc123"}`),
+		Entry("with correlation id and allowlist", RedactionPolicy{Exposure: ExposeCorrelationId, NewCorrelationId: fixedId, AllowedFields: []string{"description"}}, ErrorFormatServiceError,
+			`{"code":123,"description":"storage failed","correlationId":"abc123"}`),
+		Entry("with problem and correlation id", RedactionPolicy{Exposure: ExposeCorrelationId, NewCorrelationId: fixedId}, ErrorFormatProblem,
+			`{"code":123,"title":"storage failed","status":500,"correlationId":"abc123"}`),
+		Entry("with problem and allowlist", RedactionPolicy{Exposure: ExposeFull, AllowedFields: []string{"title"}}, ErrorFormatProblem,
+			`{"code":123,"title":"storage failed"}`),
+	)
+	It("should use the default policy", func() {
+		// Arrange
+		DefaultRedactionPolicy = RedactionPolicy{Exposure: ExposeCorrelationId, NewCorrelationId: fixedId}
+		defer func() { DefaultRedactionPolicy = RedactionPolicy{Exposure: ExposeFull} }()
+
+		// Act
+		err := NewWriter(mockWriter).WriteErrorResponse(http.StatusInternalServerError, secretError())
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(written).To(MatchJSON(`{"code":123,"description":"storage failed","wrapped":"","correlationId":"abc123"}`))
+	})
+	It("should use the request's correlation id", func() {
+		// Arrange
+		req, err := http.NewRequest(http.MethodGet, "/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set(header.CorrelationId, "req-42")
+		writer := NewWriter(mockWriter).WithRequest(req).WithRedaction(RedactionPolicy{Exposure: ExposeCorrelationId})
+
+		// Act
+		err = writer.WriteErrorResponse(http.StatusInternalServerError, secretError())
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(written).To(MatchJSON(`{"code":123,"description":"storage failed","wrapped":"","correlationId":"req-42"}`))
+	})
+	It("should log the wrapped error with the correlation id", func() {
+		// Arrange
+		observed, logs := observer.New(zapcore.DebugLevel)
+		holder := resweave.NewLogholder("test", nil)
+		holder.SetLogger(zap.New(observed).Sugar(), false)
+		policy := RedactionPolicy{Exposure: ExposeCorrelationId, Logger: logging.LogFactory{LogHolder: holder}}
+
+		// Act
+		err := NewWriter(mockWriter).WithRedaction(policy).WriteErrorResponse(http.StatusInternalServerError, secretError())
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		var svcErr SvcError
+		Expect(svcErr.UnmarshalJSON(written)).To(Succeed())
+		Expect(svcErr.CorrelationId()).To(HaveLen(32))
+		Expect(svcErr.Unwrap()).To(BeNil())
+
+		Expect(logs.All()).To(HaveLen(1))
+		fields := logs.All()[0].ContextMap()
+		Expect(fields[correlationIdMember]).To(Equal(svcErr.CorrelationId()))
+		Expect(fields[logging.LogKeyError]).To(ContainSubstring("permission denied"))
+	})
+})
+
+var _ = Describe("Redacted Service Errors", func() {
+	It("should redact errors marshaled for other responses", func() {
+		// Arrange
+		recorder := httptest.NewRecorder()
+		policy := RedactionPolicy{Exposure: ExposeCorrelationId, NewCorrelationId: func() string { return "abc123" }, AllowedFields: []string{"description"}}
+		svcErr := NewServiceError(123, "storage failed").WithError(errors.New("open /var/secret/db: permission denied"))
+
+		// Act
+		raw, err := NewWriter(recorder).WithRedaction(policy).MarshalError(svcErr)
+
+		// Assert
+		Expect(err).ToNot(HaveOccurred())
+		Expect(raw).To(MatchJSON(`{"code":123,"description":"storage failed","correlationId":"abc123"}`))
+		Expect(recorder.Body.Len()).To(BeZero())
+	})
+	It("should round-trip the correlation id through a problem", func() {
+		// Arrange
+		svcErr := &SvcError{Code: 123, Description: "storage failed", correlationId: "abc123"}
+
+		// Act
+		actual := newProblem(http.StatusInternalServerError, svcErr, "").ServiceError()
+
+		// Assert
+		Expect(actual.(*SvcError).CorrelationId()).To(Equal("abc123"))
+		Expect(actual.(*SvcError).Extensions()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,160 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+)
+
+var (
+	ErrorDuplicateServiceErrorCode = errors.New("duplicate service error code")
+	ErrorInvalidServiceError       = errors.New("invalid service error")
+)
+
+// Converts an error into a service error; return nil if the error isn't one that the mapper handles.
+type ErrorMapper func(err error) ServiceError
+
+// A registered service error and the HTTP status that it is written with
+type RegisteredError struct {
+	Error  ServiceError
+	Status int
+}
+
+type errorRegistry struct {
+	mtx     sync.RWMutex
+	errors  map[int]RegisteredError
+	mappers []ErrorMapper
+}
+
+var registry = &errorRegistry{errors: make(map[int]RegisteredError)}
+
+func init() {
+	RegisterErrorMapping(rw.ErrorNoData, SvcErrorReadRequestFailed)
+	RegisterErrorMapping(rw.ErrorJsonUnmarshalFailed, SvcErrorJsonUnmarshalFailed)
+	RegisterErrorMapping(rw.ErrorUnmarshalFailed, SvcErrorUnmarshalFailed)
+	RegisterErrorMapping(rw.ErrorUnsupportedMimeType, SvcErrorUnsupportedMediaType)
+}
+
+// Create and register a service error; intended for package-level declarations, e.g.
+//
+//	var ErrSvcInvalidWhatsit = response.DeclareServiceError(20000, "invalid whatsit", http.StatusBadRequest)
+//
+// Panics if the code has already been registered.
+func DeclareServiceError(code int, description string, status int) ServiceError {
+	svcErr := NewServiceError(code, description)
+	if err := RegisterServiceError(svcErr, status); err != nil {
+		panic(err)
+	}
+	return svcErr
+}
+
+// Register a service error with the HTTP status that WriteError() should use for it.
+//
+// Each code can only be registered once.
+func RegisterServiceError(svcErr ServiceError, status int) error {
+	var se *SvcError
+	if !errors.As(svcErr, &se) {
+		return fmt.Errorf("%w: %v", ErrorInvalidServiceError, svcErr)
+	}
+
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+	if existing, found := registry.errors[se.Code]; found {
+		return fmt.Errorf("%w: %d: %q is already registered as %q", ErrorDuplicateServiceErrorCode, se.Code, se.Description, existing.Error.(*SvcError).Description)
+	}
+	registry.errors[se.Code] = RegisteredError{Error: svcErr, Status: status}
+	return nil
+}
+
+// All of the registered service errors, sorted by code
+func RegisteredErrors() []RegisteredError {
+	registry.mtx.RLock()
+	defer registry.mtx.RUnlock()
+
+	registered := make([]RegisteredError, 0, len(registry.errors))
+	for _, entry := range registry.errors {
+		registered = append(registered, entry)
+	}
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].Error.(*SvcError).Code < registered[j].Error.(*SvcError).Code
+	})
+	return registered
+}
+
+// Add a mapper used by MapError(); mappers are tried in the order they were registered.
+func RegisterErrorMapper(mapper ErrorMapper) {
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+	registry.mappers = append(registry.mappers, mapper)
+}
+
+// Map any error that matches target (using errors.Is) to the service error, wrapping the original error.
+func RegisterErrorMapping(target error, svcErr ServiceError) {
+	RegisterErrorMapper(func(err error) ServiceError {
+		if errors.Is(err, target) {
+			return svcErr.WithError(err)
+		}
+		return nil
+	})
+}
+
+// Find the service error for an error, if there is one.
+//
+// Service errors are returned as-is; other errors are passed to the registered mappers and finally
+// checked for a wrapped service error.
+func LookupError(err error) (ServiceError, bool) {
+	if err == nil {
+		return nil, false
+	}
+	if svcErr, ok := err.(ServiceError); ok {
+		return svcErr, true
+	}
+
+	registry.mtx.RLock()
+	mappers := registry.mappers
+	registry.mtx.RUnlock()
+	for _, mapper := range mappers {
+		if svcErr := mapper(err); svcErr != nil {
+			return svcErr, true
+		}
+	}
+
+	var se *SvcError
+	if errors.As(err, &se) {
+		return se, true
+	}
+	return nil, false
+}
+
+// Convert any error into a service error; unknown errors become SvcErrorInternal.
+//
+// A nil error returns nil.
+func MapError(err error) ServiceError {
+	if err == nil {
+		return nil
+	}
+	if svcErr, found := LookupError(err); found {
+		return svcErr
+	}
+	return SvcErrorInternal.WithError(err)
+}
+
+// The HTTP status registered for the service error's code, or 500 (Internal Server Error)
+// if the code isn't registered.
+func StatusOf(svcErr ServiceError) int {
+	var se *SvcError
+	if !errors.As(svcErr, &se) {
+		return http.StatusInternalServerError
+	}
+
+	registry.mtx.RLock()
+	defer registry.mtx.RUnlock()
+	if entry, found := registry.errors[se.Code]; found {
+		return entry.Status
+	}
+	return http.StatusInternalServerError
+}
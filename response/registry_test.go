@@ -0,0 +1,153 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/mocks"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Service Error Registry", func() {
+	Context("RegisterServiceError", func() {
+		It("should register a service error with its status", func() {
+			// Arrange
+			svcErr := NewServiceError(99001, "registered")
+
+			// Act
+			err := RegisterServiceError(svcErr, http.StatusConflict)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(StatusOf(svcErr)).To(Equal(http.StatusConflict))
+			Expect(StatusOf(svcErr.WithDetail("detail"))).To(Equal(http.StatusConflict))
+			Expect(RegisteredErrors()).To(ContainElement(RegisteredError{Error: svcErr, Status: http.StatusConflict}))
+		})
+		It("should reject a duplicate code", func() {
+			// Act
+			err := RegisterServiceError(NewServiceError(10500, "also invalid"), http.StatusBadRequest)
+
+			// Assert
+			Expect(err).To(MatchError(ErrorDuplicateServiceErrorCode))
+			Expect(StatusOf(SvcErrorInvalidResourceId)).To(Equal(http.StatusBadRequest))
+		})
+		It("should panic when declaring a duplicate code", func() {
+			Expect(func() { DeclareServiceError(10500, "also invalid", http.StatusBadRequest) }).To(PanicWith(MatchError(ErrorDuplicateServiceErrorCode)))
+		})
+		It("should list registered errors by code", func() {
+			// Act
+			registered := RegisteredErrors()
+
+			// Assert
+			Expect(registered[0]).To(Equal(RegisteredError{Error: SvcErrorInternal, Status: http.StatusInternalServerError}))
+			for index := 1; index < len(registered); index++ {
+				Expect(registered[index].Error.(*SvcError).Code).To(BeNumerically(">", registered[index-1].Error.(*SvcError).Code))
+			}
+		})
+		It("should use 500 for unregistered codes", func() {
+			Expect(StatusOf(NewServiceError(99999, "unregistered"))).To(Equal(http.StatusInternalServerError))
+			Expect(StatusOf(nil)).To(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	Context("MapError", func() {
+		errMapped := errors.New("mapped error")
+		errCustom := errors.New("custom error")
+		svcErrMapped := DeclareServiceError(99002, "mapped", http.StatusConflict)
+		svcErrCustom := DeclareServiceError(99003, "custom", http.StatusTeapot)
+		RegisterErrorMapping(errMapped, svcErrMapped)
+		RegisterErrorMapper(func(err error) ServiceError {
+			if errors.Is(err, errCustom) {
+				return svcErrCustom.WithDetail(err.Error())
+			}
+			return nil
+		})
+
+		DescribeTable("should map errors to service errors",
+			func(err error, expect ServiceError) {
+				// Act
+				actual := MapError(err)
+
+				// Assert
+				Expect(actual).To(MatchError(expect))
+				Expect(actual.Error()).To(Equal(expect.Error()))
+			},
+			Entry("with service error", SvcErrorInvalidMethod.WithDetail("PUT"), SvcErrorInvalidMethod.WithDetail("PUT")),
+			Entry("with wrapped service error", fmt.Errorf("oops: %w", SvcErrorResourceIdMismatch), SvcErrorResourceIdMismatch),
+			Entry("with no data", fmt.Errorf("%w: body", rw.ErrorNoData), SvcErrorReadRequestFailed.WithError(fmt.Errorf("%w: body", rw.ErrorNoData))),
+			Entry("with unsupported mime type", rw.ErrorUnsupportedMimeType, SvcErrorUnsupportedMediaType.WithError(rw.ErrorUnsupportedMimeType)),
+			Entry("with registered mapping", fmt.Errorf("%w: x", errMapped), svcErrMapped.WithError(fmt.Errorf("%w: x", errMapped))),
+			Entry("with registered mapper", errCustom, svcErrCustom.WithDetail("custom error")),
+			Entry("with unknown error", errors.New("unknown"), SvcErrorInternal.WithError(errors.New("unknown"))),
+		)
+		It("should return nil for nil", func() {
+			Expect(MapError(nil)).To(BeNil())
+			_, found := LookupError(nil)
+			Expect(found).To(BeFalse())
+		})
+		It("should not find unknown errors", func() {
+			_, found := LookupError(errors.New("unknown"))
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	Context("WriteError", func() {
+		var (
+			ctrl       *gomock.Controller
+			mockWriter *mocks.MockResponseWriter
+		)
+		BeforeEach(func() {
+			ctrl = gomock.NewController(GinkgoT())
+			mockWriter = mocks.NewMockResponseWriter(ctrl)
+		})
+		AfterEach(func() {
+			ctrl.Finish()
+		})
+
+		DescribeTable("should write the registered status",
+			func(err error, expectStatus int, expectCode int) {
+				// Arrange
+				var written []byte
+				mockWriter.EXPECT().WriteHeader(expectStatus).Times(1)
+				mockWriter.EXPECT().Header().AnyTimes().Return(http.Header{})
+				mockWriter.EXPECT().Write(gomock.Any()).Times(1).DoAndReturn(func(data []byte) (int, error) {
+					written = data
+					return len(data), nil
+				})
+
+				// Act
+				actual := NewWriter(mockWriter).WithErrorFormat(ErrorFormatProblem).WriteError(err)
+
+				// Assert
+				Expect(actual).ToNot(HaveOccurred())
+				var problem Problem
+				Expect(problem.UnmarshalJSON(written)).To(Succeed())
+				Expect(problem.Code).To(Equal(expectCode))
+				Expect(problem.Status).To(Equal(expectStatus))
+			},
+			Entry("with service error", SvcErrorNotAcceptable, http.StatusNotAcceptable, 10600),
+			Entry("with mapped error", rw.ErrorJsonUnmarshalFailed, http.StatusBadRequest, 10110),
+			Entry("with unknown error", errors.New("unknown"), http.StatusInternalServerError, 10000),
+		)
+		It("should set the content type", func() {
+			// Arrange
+			headers := http.Header{}
+			mockWriter.EXPECT().WriteHeader(http.StatusMethodNotAllowed).Times(1)
+			mockWriter.EXPECT().Header().AnyTimes().Return(headers)
+			mockWriter.EXPECT().Write(gomock.Any()).Times(1).Return(10, nil)
+
+			// Act
+			err := NewWriter(mockWriter).WriteError(SvcErrorInvalidMethod)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(headers.Get(header.ContentType)).To(Equal(header.MimeTypeJson))
+		})
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/keithpaterson/resweave-utils/header"
 	"github.com/keithpaterson/resweave-utils/utility/rw"
 )
 
@@ -18,12 +19,12 @@ var (
 // Parse a simple response with no data.
 //
 //	If the response status code != the expected success code then an error is returned.
-//	If the response contains an error from the service, it is converted to error and returned.
+//	If the response contains an error from the service, it is converted to error and returned;
+//	both service error and problem+json (RFC 9457) responses are understood.
 func ParseResponse(resp *http.Response, successStatusCode int) error {
 	if resp.StatusCode != successStatusCode {
-		var svcErr SvcError
-		if err := parseJsonData(resp.Body, &svcErr); err == nil {
-			return &svcErr
+		if svcErr, err := parseServiceError(resp); err == nil {
+			return svcErr
 		}
 
 		return fmt.Errorf("%w: got %d: expected %d", ErrorUnexpectedResponseStatus, resp.StatusCode, successStatusCode)
@@ -43,6 +44,22 @@ func ParseResponseJsonData(resp *http.Response, successStatusCode int, object in
 	return parseJsonData(resp.Body, object)
 }
 
+// Parse a response containing encoded data or an error
+//
+//	The decoder is chosen using the response's Content-Type (JSON if there isn't one); see rw.RegisterCodec.
+//	If the response status code != the expected success code then an error is returned.
+//	If the response contains an error from the service, it is converted to error and returned.
+func ParseResponseData(resp *http.Response, successStatusCode int, object interface{}) error {
+	if err := ParseResponse(resp, successStatusCode); err != nil {
+		return err
+	}
+
+	if err := rw.Unmarshal(resp.Body, resp.Header.Get(header.ContentType), object); err != nil {
+		return fmt.Errorf("%w: %w", ErrorBadResponseBody, err)
+	}
+	return nil
+}
+
 // Parse a response containing non-json data bytes or an error
 //
 //	If the response status code != the expected success code then an error is returned.
@@ -7,7 +7,9 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/keithpaterson/resweave-utils/header"
 	"github.com/keithpaterson/resweave-utils/mocks"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -84,6 +86,57 @@ var _ = Describe("Response Helpers", func() {
 		)
 	})
 
+	Context("ParseResponseData", func() {
+		type responseData struct {
+			code     int
+			mimeType string
+			body     []byte
+		}
+		type expectations struct {
+			actual testData
+			err    error
+		}
+
+		DescribeTable("Validate",
+			func(successCode int, response responseData, expect expectations) {
+				resp := &http.Response{StatusCode: response.code, Header: http.Header{}, Body: io.NopCloser(bytes.NewBuffer(response.body))}
+				if response.mimeType != "" {
+					resp.Header.Set(header.ContentType, response.mimeType)
+				}
+
+				var value testData
+				err := ParseResponseData(resp, successCode, &value)
+				if expect.err != nil {
+					Expect(err).To(MatchError(expect.err))
+				} else {
+					Expect(err).To(BeNil())
+				}
+				Expect(value).To(Equal(expect.actual))
+			},
+			Entry("return json data with no content type", http.StatusOK,
+				responseData{http.StatusOK, "", []byte(`{"name":"successful"}`)},
+				expectations{testData{Name: "successful"}, nil}),
+			Entry("return json data with json content type", http.StatusOK,
+				responseData{http.StatusOK, "application/json; charset=utf-8", []byte(`{"name":"successful"}`)},
+				expectations{testData{Name: "successful"}, nil}),
+			Entry("return xml data with xml content type", http.StatusOK,
+				responseData{http.StatusOK, header.MimeTypeXml, []byte(`<testData><Name>successful</Name></testData>`)},
+				expectations{testData{Name: "successful"}, nil}),
+			Entry("return cbor data with cbor content type", http.StatusOK,
+				responseData{http.StatusOK, header.MimeTypeCbor, []byte{0xa1, 0x64, 'n', 'a', 'm', 'e', 0x62, 'o', 'k'}},
+				expectations{testData{Name: "ok"}, nil}),
+			Entry("return error with unsupported content type", http.StatusOK,
+				responseData{http.StatusOK, "text/csv", []byte("name\nsuccessful")},
+				expectations{testData{}, rw.ErrorUnsupportedMimeType}),
+			Entry("return error with invalid body", http.StatusOK,
+				responseData{http.StatusOK, header.MimeTypeXml, []byte("not xml")},
+				expectations{testData{}, ErrorBadResponseBody}),
+			Entry("return error with svc error in body", http.StatusOK,
+				responseData{http.StatusBadRequest, header.MimeTypeJson, []byte(`{"code":100,"description":"irreconcilable differences"}`)},
+				expectations{testData{}, NewServiceError(100, "irreconcilable differences")}),
+		)
+	})
+
 	Context("ParseResponseBinaryData", func() {
 		type responseData struct {
 			code int
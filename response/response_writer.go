@@ -1,18 +1,132 @@
 package response
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/utility/rw"
+	"golang.org/x/text/language"
+)
+
+var (
+	ErrorHeadersSent = errors.New("response headers have already been sent")
 )
 
 type Writer struct {
-	writer http.ResponseWriter
+	writer      *trackingWriter
+	request     *http.Request
+	offers      []string // MIME types for content negotiation, in order of preference
+	errorFormat ErrorFormat
+	redaction   *RedactionPolicy
+	catalog     *Catalog
+	locale      language.Tag
 }
 
+// Each writer made for a plain http.ResponseWriter tracks what it sends (see HeadersSent, Status and BytesWritten),
+// separately from other writers made for it.  Writers made for the writer's ResponseWriter() share its state, so pass
+// that on (rather than the original) when more than one writer is used for a response.
 func NewWriter(w http.ResponseWriter) Writer {
-	return Writer{writer: w}
+	if tracked, ok := w.(*trackingWriter); ok {
+		return Writer{writer: tracked}
+	}
+	return Writer{writer: &trackingWriter{ResponseWriter: w}}
+}
+
+// Associate the request with the writer; this is needed to negotiate the error format and is used as the
+// problem+json "instance".
+func (w Writer) WithRequest(r *http.Request) Writer {
+	w.request = r
+	return w
+}
+
+// Choose how errors are written by WriteErrorResponse(); see ErrorFormat.
+func (w Writer) WithErrorFormat(format ErrorFormat) Writer {
+	w.errorFormat = format
+	return w
+}
+
+// Control what error responses reveal about wrapped errors; see RedactionPolicy.
+func (w Writer) WithRedaction(policy RedactionPolicy) Writer {
+	w.redaction = &policy
+	return w
+}
+
+// Localize error descriptions using this catalog instead of DefaultCatalog; see Catalog.
+func (w Writer) WithCatalog(catalog *Catalog) Writer {
+	w.catalog = catalog
+	return w
+}
+
+// Localize error descriptions for this language instead of the request's Accept-Language header.
+func (w Writer) WithLocale(tag language.Tag) Writer {
+	w.locale = tag
+	return w
+}
+
+// The response headers; changes made after the headers have been sent are ignored (except for trailers).
+func (w Writer) Header() http.Header {
+	return w.writer.Header()
+}
+
+// Set the Location header, e.g. for 201 (Created) responses
+func (w Writer) SetLocation(location string) Writer {
+	w.writer.Header().Set(header.Location, location)
+	return w
+}
+
+// Set the ETag header; the tag is formatted with FormatETag.
+func (w Writer) SetETag(etag string) Writer {
+	w.writer.Header().Set(header.ETag, FormatETag(etag))
+	return w
+}
+
+// Make an entity tag from a version: the version is quoted unless it already is (or is a weak tag, e.g. `W/"1234"`).
+// Versions with characters that entity tags can't have (quotes, spaces, controls and non-ASCII) are base64url-encoded,
+// so that clients can send the tag back as it is.
+func FormatETag(version string) string {
+	if strings.HasPrefix(version, `"`) || strings.HasPrefix(version, `W/"`) {
+		return version
+	}
+	for _, c := range []byte(version) {
+		// etagc is %x21 / %x23-7E / obs-text, but clients don't reliably echo obs-text
+		if c < 0x21 || c == '"' || c > 0x7e {
+			return `"` + base64.RawURLEncoding.EncodeToString([]byte(version)) + `"`
+		}
+	}
+	return `"` + version + `"`
+}
+
+// Set the Cache-Control header, e.g. SetCacheControl("private", "max-age=60")
+func (w Writer) SetCacheControl(directives ...string) Writer {
+	w.writer.Header().Set(header.CacheControl, strings.Join(directives, ", "))
+	return w
+}
+
+// True once the status and headers have been sent
+func (w Writer) HeadersSent() bool {
+	return w.writer.status != 0
+}
+
+// The status that was sent, or zero if it hasn't been sent yet
+func (w Writer) Status() int {
+	return w.writer.status
+}
+
+// The number of body bytes written so far
+func (w Writer) BytesWritten() int64 {
+	return w.writer.bytesWritten
+}
+
+// The http.ResponseWriter that this writer writes to; pass this on (e.g. from middleware) to keep track of what
+// is written through it.
+func (w Writer) ResponseWriter() http.ResponseWriter {
+	return w.writer
 }
 
 func (w Writer) WriteResponse(statusCode int) {
@@ -28,7 +142,21 @@ func (w Writer) WriteJsonResponse(statusCode int, object interface{}) error {
 	return w.WriteDataResponse(statusCode, raw, header.MimeTypeJson)
 }
 
+// Encodes the object using the codec registered for the MIME type (see rw.RegisterCodec)
+func (w Writer) WriteEncodedResponse(statusCode int, object interface{}, mimeType string) error {
+	raw, err := rw.Marshal(object, mimeType)
+	if err != nil {
+		return w.WriteErrorResponse(http.StatusInternalServerError, SvcErrorMarshalFailed.WithError(err))
+	}
+
+	return w.WriteDataResponse(statusCode, raw, mimeType)
+}
+
 func (w Writer) WriteDataResponse(statusCode int, data []byte, mimeType string) error {
+	if w.HeadersSent() {
+		return ErrorHeadersSent
+	}
+	w.writer.Header().Set(header.ContentType, mimeType)
 	w.writer.WriteHeader(statusCode)
 
 	wrote := 0
@@ -40,27 +168,98 @@ func (w Writer) WriteDataResponse(statusCode int, data []byte, mimeType string)
 		total += wrote
 	}
 	if err != nil {
-		return w.WriteErrorResponse(http.StatusInternalServerError, SvcErrorWriteFailed.WithError(err))
+		// the status has been sent, so the failure can't be reported to the client
+		return SvcErrorWriteFailed.WithError(err)
 	}
-
-	w.writer.Header().Add(header.ContentType, mimeType)
 	return nil
 }
 
 func (w Writer) WriteErrorResponse(statusCode int, svcErr ServiceError) error {
-	w.writer.WriteHeader(statusCode)
+	if w.HeadersSent() {
+		return fmt.Errorf("%w: %w", ErrorHeadersSent, svcErr)
+	}
+
+	svcErr = w.localizeError(svcErr)
+	var se *SvcError
+	if errors.As(svcErr, &se) {
+		if hint, ok := se.RetryHint(); ok {
+			w.writer.Header().Set(header.RetryAfter, strconv.FormatInt(hint.seconds(), 10))
+		}
+	}
 
 	// Don't call WriteJsonResponse() or WriteDataResponse() here because they fall-back to this function
 	// if there is an error, and if we get errors here we need to return them instead of trying to add them
 	// to the response.
-	raw, err := json.Marshal(svcErr)
+	raw, mimeType, err := w.marshalError(statusCode, svcErr)
 	if err != nil {
+		// at least send the status
+		w.writer.WriteHeader(statusCode)
 		return SvcErrorJsonMarshalFailed.WithDetail("service error").WithError(svcErr)
 	}
+	w.writer.Header().Set(header.ContentType, mimeType)
+	w.writer.WriteHeader(statusCode)
 	_, err = w.writer.Write(raw)
 	if err != nil {
 		return SvcErrorWriteFailed.WithDetail("service error").WithError(svcErr)
 	}
-	w.writer.Header().Add(header.ContentType, header.MimeTypeJson)
 	return nil
 }
+
+// Write any error as a service error, using the code and HTTP status registered for it (see MapError and StatusOf)
+func (w Writer) WriteError(err error) error {
+	svcErr := MapError(err)
+	return w.WriteErrorResponse(StatusOf(svcErr), svcErr)
+}
+
+// Encode a service error the way this writer's error responses would expose it (localized, and redacted according to
+// its RedactionPolicy), in the service error format, for errors that are part of another response (e.g. batch results).
+func (w Writer) MarshalError(svcErr ServiceError) (json.RawMessage, error) {
+	raw, err := json.Marshal(w.redactError(w.localizeError(svcErr)))
+	if err != nil {
+		return nil, err
+	}
+	return w.redactionPolicy().filterFields(raw)
+}
+
+// Keeps track of what has been sent, so that the status is only sent once
+type trackingWriter struct {
+	http.ResponseWriter
+	status       int
+	bytesWritten int64
+}
+
+// Calls after the first are ignored
+func (t *trackingWriter) WriteHeader(statusCode int) {
+	if t.status != 0 {
+		return
+	}
+	t.status = statusCode
+	t.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (t *trackingWriter) Write(data []byte) (int, error) {
+	if t.status == 0 {
+		// like net/http, writing the body sends 200 (OK) if no status was sent
+		t.WriteHeader(http.StatusOK)
+	}
+	n, err := t.ResponseWriter.Write(data)
+	t.bytesWritten += int64(n)
+	return n, err
+}
+
+// Does nothing if the underlying writer can't flush; see canFlush()
+func (t *trackingWriter) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (t *trackingWriter) canFlush() bool {
+	_, ok := t.ResponseWriter.(http.Flusher)
+	return ok
+}
+
+// Lets http.ResponseController reach the underlying writer
+func (t *trackingWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"math"
 	"net/http"
+	"net/http/httptest"
+	"time"
 
 	"github.com/keithpaterson/resweave-utils/header"
 	"github.com/keithpaterson/resweave-utils/mocks"
@@ -59,18 +61,21 @@ var _ = Describe("Response Writer Helpers", func() {
 				defer ctrl.Finish()
 				mockWriter := mocks.NewMockResponseWriter(ctrl)
 				httpHeaders := http.Header{}
+				// the headers must be set before the status is sent, and the status is only sent once
 				if expect.data != nil {
-					mockWriter.EXPECT().WriteHeader(expect.statusCode).Times(1)
-					mockWriter.EXPECT().Write(expect.data).Times(1).Return(len(expect.data), nil)
-					mockWriter.EXPECT().Header().Times(1).Return(httpHeaders)
+					gomock.InOrder(
+						mockWriter.EXPECT().Header().Times(1).Return(httpHeaders),
+						mockWriter.EXPECT().WriteHeader(expect.statusCode).Times(1),
+						mockWriter.EXPECT().Write(expect.data).Times(1).Return(len(expect.data), nil),
+					)
 				}
 				if expect.err != nil {
-					// expect two writes because we will try to write the first error to the response
-					// also expect WriteHeader twice, but the first will always be OK;
-					//   note that the real implementation will actually return OK - can't easily mock that
-					mockWriter.EXPECT().WriteHeader(http.StatusOK).Times(1)
-					mockWriter.EXPECT().WriteHeader(expect.statusCode).Times(1)
-					mockWriter.EXPECT().Write(gomock.Any()).Times(2).Return(0, errors.New("irreconcilable differences"))
+					// once the status has been sent the failure can't be reported in the response
+					gomock.InOrder(
+						mockWriter.EXPECT().Header().Times(1).Return(httpHeaders),
+						mockWriter.EXPECT().WriteHeader(expect.statusCode).Times(1),
+						mockWriter.EXPECT().Write(gomock.Any()).Times(1).Return(0, errors.New("irreconcilable differences")),
+					)
 				}
 
 				// Act
@@ -93,10 +98,58 @@ var _ = Describe("Response Writer Helpers", func() {
 				expectations{http.StatusInternalServerError, jsonErrorData, jsonHeaders, nil}),
 			Entry("with write failure returns error",
 				inputs{http.StatusOK, testData{"simple"}},
-				expectations{http.StatusInternalServerError, nil, http.Header{}, SvcErrorWriteFailed}),
+				expectations{http.StatusOK, nil, jsonHeaders, SvcErrorWriteFailed}),
 		)
 	})
 
+	Context("WriteEncodedResponse", func() {
+		It("should write data encoded for the mime type", func() {
+			// Arrange
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			httpHeaders := http.Header{}
+			expectData := []byte("<testData><Name>simple</Name></testData>")
+			mockWriter := mocks.NewMockResponseWriter(ctrl)
+			mockWriter.EXPECT().WriteHeader(http.StatusOK).Times(1)
+			mockWriter.EXPECT().Write(expectData).Times(1).Return(len(expectData), nil)
+			mockWriter.EXPECT().Header().Times(1).Return(httpHeaders)
+
+			writer := NewWriter(mockWriter)
+
+			// Act
+			err := writer.WriteEncodedResponse(http.StatusOK, testData{"simple"}, header.MimeTypeXml)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(httpHeaders).To(Equal(http.Header{header.ContentType: []string{header.MimeTypeXml}}))
+		})
+		It("should write an error when the mime type has no codec", func() {
+			// Arrange
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			httpHeaders := http.Header{}
+			var written []byte
+			mockWriter := mocks.NewMockResponseWriter(ctrl)
+			mockWriter.EXPECT().WriteHeader(http.StatusInternalServerError).Times(1)
+			mockWriter.EXPECT().Write(gomock.Any()).Times(1).DoAndReturn(func(data []byte) (int, error) {
+				written = data
+				return len(data), nil
+			})
+			mockWriter.EXPECT().Header().Times(1).Return(httpHeaders)
+
+			writer := NewWriter(mockWriter)
+
+			// Act
+			err := writer.WriteEncodedResponse(http.StatusOK, testData{"simple"}, "text/csv")
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			var svcErr SvcError
+			Expect(json.Unmarshal(written, &svcErr)).To(Succeed())
+			Expect(&svcErr).To(MatchError(SvcErrorMarshalFailed))
+		})
+	})
+
 	Context("WriteDataResponse", func() {
 		binaryHeaders := http.Header{header.ContentType: []string{header.MimeTypeBinary}}
 
@@ -117,18 +170,21 @@ var _ = Describe("Response Writer Helpers", func() {
 				defer ctrl.Finish()
 				mockWriter := mocks.NewMockResponseWriter(ctrl)
 				httpHeaders := http.Header{}
+				// the headers must be set before the status is sent, and the status is only sent once
 				if expect.data != nil {
-					mockWriter.EXPECT().WriteHeader(expect.statusCode).Times(1)
-					mockWriter.EXPECT().Write(expect.data).Times(1).Return(len(expect.data), nil)
-					mockWriter.EXPECT().Header().Times(1).Return(httpHeaders)
+					gomock.InOrder(
+						mockWriter.EXPECT().Header().Times(1).Return(httpHeaders),
+						mockWriter.EXPECT().WriteHeader(expect.statusCode).Times(1),
+						mockWriter.EXPECT().Write(expect.data).Times(1).Return(len(expect.data), nil),
+					)
 				}
 				if expect.err != nil {
-					// expect two writes because we will try to write the first error to the response
-					// also expect WriteHeader twice, but the first will always be OK;
-					//   note that the real implementation will actually return OK - can't easily mock that
-					mockWriter.EXPECT().WriteHeader(http.StatusOK).Times(1)
-					mockWriter.EXPECT().WriteHeader(expect.statusCode).Times(1)
-					mockWriter.EXPECT().Write(gomock.Any()).Times(2).Return(0, errors.New("irreconcilable differences"))
+					// once the status has been sent the failure can't be reported in the response
+					gomock.InOrder(
+						mockWriter.EXPECT().Header().Times(1).Return(httpHeaders),
+						mockWriter.EXPECT().WriteHeader(expect.statusCode).Times(1),
+						mockWriter.EXPECT().Write(gomock.Any()).Times(1).Return(0, errors.New("irreconcilable differences")),
+					)
 				}
 
 				// Act
@@ -148,7 +204,7 @@ var _ = Describe("Response Writer Helpers", func() {
 				expectations{http.StatusOK, []byte("simple"), binaryHeaders, nil}),
 			Entry("with write failure returns error",
 				inputs{http.StatusOK, []byte("simple")},
-				expectations{http.StatusInternalServerError, nil, http.Header{}, SvcErrorWriteFailed}),
+				expectations{http.StatusOK, nil, binaryHeaders, SvcErrorWriteFailed}),
 		)
 		It("should write multiple times until all data is written", func() {
 			// Arrange
@@ -170,4 +226,181 @@ var _ = Describe("Response Writer Helpers", func() {
 			Expect(len(httpHeaders)).To(Equal(1))
 		})
 	})
+
+	Context("WriteErrorResponse", func() {
+		It("should set the headers before sending the status", func() {
+			// Arrange
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			httpHeaders := http.Header{}
+			mockWriter := mocks.NewMockResponseWriter(ctrl)
+			gomock.InOrder(
+				mockWriter.EXPECT().Header().MinTimes(1).Return(httpHeaders),
+				mockWriter.EXPECT().WriteHeader(http.StatusServiceUnavailable).Times(1).Do(func(int) {
+					Expect(httpHeaders.Get(header.ContentType)).To(Equal(header.MimeTypeJson))
+					Expect(httpHeaders.Get(header.RetryAfter)).To(Equal("30"))
+				}),
+				mockWriter.EXPECT().Write(gomock.Any()).Times(1).DoAndReturn(func(data []byte) (int, error) {
+					return len(data), nil
+				}),
+			)
+
+			// Act
+			err := NewWriter(mockWriter).WriteErrorResponse(http.StatusServiceUnavailable, SvcErrorInternal.WithRetryAfter(30*time.Second))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should not send a second status when the first write fails", func() {
+			// Arrange
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			mockWriter := mocks.NewMockResponseWriter(ctrl)
+			mockWriter.EXPECT().Header().AnyTimes().Return(http.Header{})
+			mockWriter.EXPECT().WriteHeader(http.StatusBadRequest).Times(1)
+			mockWriter.EXPECT().Write(gomock.Any()).Times(1).Return(0, errors.New("irreconcilable differences"))
+
+			// Act
+			err := NewWriter(mockWriter).WriteErrorResponse(http.StatusBadRequest, SvcErrorInvalidResourceId)
+
+			// Assert
+			Expect(err).To(MatchError(SvcErrorWriteFailed))
+		})
+
+		It("should not write an error after the status has been sent", func() {
+			// Arrange
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			mockWriter := mocks.NewMockResponseWriter(ctrl)
+			mockWriter.EXPECT().WriteHeader(http.StatusOK).Times(1)
+			writer := NewWriter(mockWriter)
+			writer.WriteResponse(http.StatusOK)
+
+			// Act
+			err := writer.WriteErrorResponse(http.StatusBadRequest, SvcErrorInvalidResourceId)
+
+			// Assert
+			Expect(err).To(MatchError(ErrorHeadersSent))
+			Expect(err).To(MatchError(SvcErrorInvalidResourceId))
+		})
+	})
+
+	Context("Header helpers", func() {
+		DescribeTable("SetETag",
+			func(etag string, expect string) {
+				recorder := httptest.NewRecorder()
+				NewWriter(recorder).SetETag(etag).WriteResponse(http.StatusOK)
+				Expect(recorder.Result().Header.Get(header.ETag)).To(Equal(expect))
+			},
+			Entry("with an unquoted tag", "1234", `"1234"`),
+			Entry("with a quoted tag", `"1234"`, `"1234"`),
+			Entry("with a weak tag", `W/"1234"`, `W/"1234"`),
+			Entry("with punctuation", "2024-01-01T10:00:00Z/v3", `"2024-01-01T10:00:00Z/v3"`),
+			Entry("with a quote inside", `v"3`, `"diIz"`),
+			Entry("with a space", "v 3", `"diAz"`),
+			Entry("with non-ASCII", "café", `"Y2Fmw6k"`),
+		)
+
+		It("should set the location and cache control headers", func() {
+			// Arrange
+			recorder := httptest.NewRecorder()
+
+			// Act
+			err := NewWriter(recorder).
+				SetLocation("/things/1").
+				SetCacheControl("private", "max-age=60").
+				WriteJsonResponse(http.StatusCreated, testData{"simple"})
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			result := recorder.Result()
+			Expect(result.StatusCode).To(Equal(http.StatusCreated))
+			Expect(result.Header.Get(header.Location)).To(Equal("/things/1"))
+			Expect(result.Header.Get(header.CacheControl)).To(Equal("private, max-age=60"))
+			Expect(result.Header.Get(header.ContentType)).To(Equal(header.MimeTypeJson))
+		})
+
+		It("should expose the response headers", func() {
+			recorder := httptest.NewRecorder()
+			writer := NewWriter(recorder)
+			writer.Header().Set("X-Custom", "yes")
+			writer.WriteResponse(http.StatusNoContent)
+			Expect(recorder.Result().Header.Get("X-Custom")).To(Equal("yes"))
+		})
+	})
+
+	Context("Response state", func() {
+		It("should report the status and bytes written", func() {
+			// Arrange
+			recorder := httptest.NewRecorder()
+			writer := NewWriter(recorder)
+			Expect(writer.HeadersSent()).To(BeFalse())
+			Expect(writer.Status()).To(BeZero())
+
+			// Act
+			err := writer.WriteDataResponse(http.StatusAccepted, []byte("simple"), header.MimeTypeBinary)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.HeadersSent()).To(BeTrue())
+			Expect(writer.Status()).To(Equal(http.StatusAccepted))
+			Expect(writer.BytesWritten()).To(BeEquivalentTo(6))
+		})
+
+		It("should send the status only once", func() {
+			// Arrange
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			mockWriter := mocks.NewMockResponseWriter(ctrl)
+			mockWriter.EXPECT().WriteHeader(http.StatusOK).Times(1)
+			writer := NewWriter(mockWriter)
+
+			// Act
+			writer.WriteResponse(http.StatusOK)
+			writer.WriteResponse(http.StatusInternalServerError)
+			err := writer.WriteDataResponse(http.StatusOK, []byte("late"), header.MimeTypeBinary)
+
+			// Assert
+			Expect(err).To(MatchError(ErrorHeadersSent))
+			Expect(writer.Status()).To(Equal(http.StatusOK))
+		})
+
+		It("should send 200 (OK) when the body is written without a status", func() {
+			// Arrange
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			mockWriter := mocks.NewMockResponseWriter(ctrl)
+			gomock.InOrder(
+				mockWriter.EXPECT().WriteHeader(http.StatusOK).Times(1),
+				mockWriter.EXPECT().Write([]byte("body")).Times(1).Return(4, nil),
+			)
+			writer := NewWriter(mockWriter)
+
+			// Act
+			n, err := writer.ResponseWriter().Write([]byte("body"))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(4))
+			Expect(writer.Status()).To(Equal(http.StatusOK))
+			Expect(writer.BytesWritten()).To(BeEquivalentTo(4))
+		})
+
+		It("should share state with writers made from its ResponseWriter", func() {
+			// Arrange
+			recorder := httptest.NewRecorder()
+			outer := NewWriter(recorder)
+
+			// Act
+			inner := NewWriter(outer.ResponseWriter())
+			Expect(inner.WriteJsonResponse(http.StatusOK, testData{"simple"})).To(Succeed())
+
+			// Assert
+			Expect(outer.Status()).To(Equal(http.StatusOK))
+			Expect(outer.BytesWritten()).To(BeEquivalentTo(len(`{"name":"simple"}`)))
+			Expect(http.NewResponseController(outer.ResponseWriter()).Flush()).To(Succeed())
+			Expect(recorder.Flushed).To(BeTrue())
+		})
+	})
 })
@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 )
 
 // Allow ServiceError to be passed anywhere an `error` type is accepted.
+//
+// Service errors are immutable: the With functions return a new error, so package-level errors can be
+// decorated and shared safely.
 type ServiceError interface {
 	Error() string
 	Unwrap() error
@@ -15,6 +20,13 @@ type ServiceError interface {
 
 	WithError(error) ServiceError
 	WithDetail(string) ServiceError
+	WithExtension(name string, value interface{}) ServiceError
+	WithFieldViolation(field string, reason string, value interface{}) ServiceError
+	WithFieldViolations(...FieldViolation) ServiceError
+	WithMetadata(key string, value interface{}) ServiceError
+	WithRetryAfter(time.Duration) ServiceError
+	WithHelpLink(description string, url string) ServiceError
+	WithMessage(key string, args map[string]interface{}) ServiceError
 }
 
 func NewServiceError(code int, description string) ServiceError {
@@ -25,17 +37,50 @@ type SvcError struct {
 	Code        int
 	Description string
 	wrapped     error
+
+	title      string                 // the description without any details; see WithDetail()
+	extensions map[string]interface{} // extension members for problem+json responses
+
+	correlationId string // identifies the logged error when the wrapped error is redacted; see RedactionPolicy
+
+	details errorDetails // field violations, metadata, etc.
+
+	messageKey  string                 // catalog key for the localized description; see WithMessage()
+	messageArgs map[string]interface{} // template arguments for the localized description
 }
 
 var (
-	SvcErrorJsonMarshalFailed   = NewServiceError(10100, "json marshal failed")
-	SvcErrorJsonUnmarshalFailed = NewServiceError(10110, "json unmarshal failed")
-	SvcErrorWriteFailed         = NewServiceError(10200, "write response failed")
-	SvcErrorReadRequestFailed   = NewServiceError(10300, "read request failed")
-	SvcErrorInvalidMethod       = NewServiceError(10400, "invalid request method")
-	SvcErrorNoRegisteredMethod  = NewServiceError(10401, "no registered request method")
-	SvcErrorInvalidResourceId   = NewServiceError(10500, "invalid resource id")
-	SvcErrorResourceIdMismatch  = NewServiceError(10501, "resource id mismatch")
+	ErrorNoSuchMetadata = errors.New("no such metadata")
+)
+
+// built-in service errors; these are registered with the HTTP status WriteError() uses for them
+var (
+	SvcErrorInternal             = DeclareServiceError(10000, "internal error", http.StatusInternalServerError)
+	SvcErrorJsonMarshalFailed    = DeclareServiceError(10100, "json marshal failed", http.StatusInternalServerError)
+	SvcErrorMarshalFailed        = DeclareServiceError(10101, "marshal failed", http.StatusInternalServerError)
+	SvcErrorJsonUnmarshalFailed  = DeclareServiceError(10110, "json unmarshal failed", http.StatusBadRequest)
+	SvcErrorUnmarshalFailed      = DeclareServiceError(10111, "unmarshal failed", http.StatusBadRequest)
+	SvcErrorWriteFailed          = DeclareServiceError(10200, "write response failed", http.StatusInternalServerError)
+	SvcErrorStreamFailed         = DeclareServiceError(10201, "stream response failed", http.StatusInternalServerError)
+	SvcErrorReadRequestFailed    = DeclareServiceError(10300, "read request failed", http.StatusBadRequest)
+	SvcErrorValidationFailed     = DeclareServiceError(10310, "request validation failed", http.StatusUnprocessableEntity)
+	SvcErrorInvalidPatch         = DeclareServiceError(10320, "invalid patch", http.StatusBadRequest)
+	SvcErrorPatchFailed          = DeclareServiceError(10321, "patch could not be applied", http.StatusConflict)
+	SvcErrorInvalidQuery         = DeclareServiceError(10330, "invalid query", http.StatusBadRequest)
+	SvcErrorInvalidMethod        = DeclareServiceError(10400, "invalid request method", http.StatusMethodNotAllowed)
+	SvcErrorNoRegisteredMethod   = DeclareServiceError(10401, "no registered request method", http.StatusMethodNotAllowed)
+	SvcErrorInvalidResourceId    = DeclareServiceError(10500, "invalid resource id", http.StatusBadRequest)
+	SvcErrorResourceIdMismatch   = DeclareServiceError(10501, "resource id mismatch", http.StatusBadRequest)
+	SvcErrorResourceNotFound     = DeclareServiceError(10502, "resource not found", http.StatusNotFound)
+	SvcErrorNotAcceptable        = DeclareServiceError(10600, "not acceptable", http.StatusNotAcceptable)
+	SvcErrorUnsupportedMediaType = DeclareServiceError(10601, "unsupported media type", http.StatusUnsupportedMediaType)
+	SvcErrorPreconditionFailed   = DeclareServiceError(10700, "precondition failed", http.StatusPreconditionFailed)
+	SvcErrorPreconditionRequired = DeclareServiceError(10701, "precondition required", http.StatusPreconditionRequired)
+	SvcErrorRequestInProgress    = DeclareServiceError(10800, "a request with this idempotency key is in progress", http.StatusConflict)
+	SvcErrorIdempotencyKeyReused = DeclareServiceError(10801, "idempotency key was used for a different request", http.StatusUnprocessableEntity)
+	SvcErrorInvalidBatch         = DeclareServiceError(10900, "invalid batch", http.StatusBadRequest)
+	SvcErrorBatchTooLarge        = DeclareServiceError(10901, "batch too large", http.StatusRequestEntityTooLarge)
+	SvcErrorBatchRolledBack      = DeclareServiceError(10902, "batch operation rolled back", http.StatusFailedDependency)
 )
 
 // Allow ServiceError to be passed anywhere an `error` type is accepted.
@@ -58,22 +103,69 @@ func (e *SvcError) Unwrap() error {
 	return e.wrapped
 }
 
+// Service errors match by code, so an error made from a sentinel (e.g. with WithDetail or WithError) still matches it.
 func (e *SvcError) Is(target error) bool {
 	se, ok := target.(*SvcError)
 	if !ok {
 		return false
 	}
 
-	return e.Code == se.Code && strings.HasPrefix(e.Description, se.Description)
+	return e.Code == se.Code
 }
 
+// Append descriptive text to the description; returns a new error.
 func (e *SvcError) WithDetail(detail string) ServiceError {
-	return NewServiceError(e.Code, fmt.Sprintf("%s: %s", e.Description, detail))
+	c := e.clone()
+	c.Description = fmt.Sprintf("%s: %s", e.Description, detail)
+	c.title = e.Title()
+	return c
+}
+
+// a shallow copy; the With functions replace maps and slices rather than modifying them
+func (e *SvcError) clone() *SvcError {
+	c := *e
+	return &c
 }
 
+// The description without any of the details added by WithDetail()
+func (e *SvcError) Title() string {
+	if e.title == "" {
+		return e.Description
+	}
+	return e.title
+}
+
+// The details added by WithDetail(), if any
+func (e *SvcError) Detail() string {
+	return strings.TrimPrefix(strings.TrimPrefix(e.Description, e.Title()), ": ")
+}
+
+// Add an extension member to problem+json responses (see ErrorFormatProblem); returns a new error.
+func (e *SvcError) WithExtension(name string, value interface{}) ServiceError {
+	extensions := make(map[string]interface{}, len(e.extensions)+1)
+	for k, v := range e.extensions {
+		extensions[k] = v
+	}
+	extensions[name] = value
+	c := e.clone()
+	c.extensions = extensions
+	return c
+}
+
+func (e *SvcError) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+// Identifies the logged error when the wrapped error was redacted; see RedactionPolicy
+func (e *SvcError) CorrelationId() string {
+	return e.correlationId
+}
+
+// Wrap an error; returns a new error.
 func (e *SvcError) WithError(err error) ServiceError {
-	e.wrapped = err
-	return e
+	c := e.clone()
+	c.wrapped = err
+	return c
 }
 
 // we use this internally to send as json; we have our own marshal/unmarshal code as a result
@@ -81,12 +173,15 @@ type serviceErrorJson struct {
 	Code        int    `json:"code"`
 	Description string `json:"description"`
 	Wrapped     string `json:"wrapped"` // cannot send errors as-is, can only send their string value
+
+	CorrelationId string `json:"correlationId,omitempty"`
+	errorDetails
 }
 
 func (e SvcError) MarshalJSON() ([]byte, error) {
 	// convert the wrapped error to its error string and send that.
 	jsonerr := serviceErrorJson{
-		Code: e.Code, Description: e.Description,
+		Code: e.Code, Description: e.Description, CorrelationId: e.correlationId, errorDetails: e.details,
 	}
 	if e.wrapped != nil {
 		jsonerr.Wrapped = e.wrapped.Error()
@@ -103,6 +198,8 @@ func (e *SvcError) UnmarshalJSON(data []byte) error {
 	e.Code = jsonerr.Code
 	e.Description = jsonerr.Description
 	e.wrapped = nil
+	e.correlationId = jsonerr.CorrelationId
+	e.details = jsonerr.errorDetails
 	// since we can only send the error as a string, a simple re-constitution is all we can do here
 	if jsonerr.Wrapped != "" {
 		e.wrapped = errors.New(jsonerr.Wrapped)
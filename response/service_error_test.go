@@ -3,6 +3,8 @@ package response
 import (
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -29,4 +31,80 @@ var _ = Describe("ServiceErrorTest", func() {
 			Expect(errors.Is(err, data)).To(BeTrue())
 		}
 	})
+	It("Is() should match by code", func() {
+		Expect(NewServiceError(123, "abc").Is(NewServiceError(123, "def"))).To(BeTrue())
+		Expect(errors.Is(SvcErrorReadRequestFailed.WithError(errors.New("oops")), SvcErrorReadRequestFailed.WithDetail("body"))).To(BeTrue())
+	})
+	It("errors.As() should extract the code and details", func() {
+		// Arrange
+		err := fmt.Errorf("handler: %w", SvcErrorInvalidResourceId.WithDetail("abc").WithFieldViolation("id", "not numeric", "abc"))
+
+		// Act
+		var svcErr *SvcError
+		found := errors.As(err, &svcErr)
+
+		// Assert
+		Expect(found).To(BeTrue())
+		Expect(svcErr.Code).To(Equal(10500))
+		Expect(svcErr.Title()).To(Equal("invalid resource id"))
+		Expect(svcErr.Detail()).To(Equal("abc"))
+		Expect(svcErr.FieldViolations()).To(Equal([]FieldViolation{{Field: "id", Reason: "not numeric", Value: "abc"}}))
+	})
+
+	DescribeTable("With functions should not modify the receiver",
+		func(decorate func(ServiceError) ServiceError) {
+			// Arrange
+			original := NewServiceError(123, "abc").WithExtension("x", 1).WithMetadata("y", 2).WithFieldViolation("z", "bad", 3)
+			before := *original.(*SvcError)
+
+			// Act
+			decorated := decorate(original)
+
+			// Assert
+			Expect(decorated).ToNot(BeIdenticalTo(original))
+			Expect(*original.(*SvcError)).To(Equal(before))
+		},
+		Entry("WithError", func(e ServiceError) ServiceError { return e.WithError(errors.New("oops")) }),
+		Entry("WithDetail", func(e ServiceError) ServiceError { return e.WithDetail("def") }),
+		Entry("WithExtension", func(e ServiceError) ServiceError { return e.WithExtension("x", 2) }),
+		Entry("WithFieldViolation", func(e ServiceError) ServiceError { return e.WithFieldViolation("z", "worse", 4) }),
+		Entry("WithFieldViolations", func(e ServiceError) ServiceError { return e.WithFieldViolations(FieldViolation{Field: "w"}) }),
+		Entry("WithMetadata", func(e ServiceError) ServiceError { return e.WithMetadata("y", 3) }),
+		Entry("WithRetryAfter", func(e ServiceError) ServiceError { return e.WithRetryAfter(time.Second) }),
+		Entry("WithHelpLink", func(e ServiceError) ServiceError { return e.WithHelpLink("help", "https://docs.test.org") }),
+	)
+
+	// run with -race to detect shared-state mutation
+	It("should be safe to decorate a shared error concurrently", func() {
+		// Arrange
+		const workers = 32
+		results := make([]ServiceError, workers)
+		var wg sync.WaitGroup
+
+		// Act
+		for index := 0; index < workers; index++ {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				err := fmt.Errorf("request %d", index)
+				results[index] = SvcErrorReadRequestFailed.
+					WithError(err).
+					WithDetail(fmt.Sprint(index)).
+					WithExtension("request", index).
+					WithFieldViolation("field", "reason", index).
+					WithMetadata("request", index)
+				_ = results[index].Error()
+				_, _ = MapError(err).(*SvcError).MarshalJSON()
+			}(index)
+		}
+		wg.Wait()
+
+		// Assert
+		Expect(SvcErrorReadRequestFailed.Unwrap()).To(BeNil())
+		Expect(SvcErrorReadRequestFailed.Error()).To(Equal("10300: read request failed"))
+		for index, result := range results {
+			Expect(result.Error()).To(Equal(fmt.Sprintf("10300: read request failed: %d: request %d", index, index)))
+			Expect(result.(*SvcError).Extensions()).To(Equal(map[string]interface{}{"request": index}))
+		}
+	})
 })
@@ -0,0 +1,292 @@
+package response
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keithpaterson/resweave-utils/header"
+)
+
+var (
+	ErrorStreamingUnsupported = errors.New("response writer does not support streaming")
+	ErrorEventStreamClosed    = errors.New("event stream is closed")
+	ErrorInvalidEvent         = errors.New("invalid event")
+)
+
+// A server-sent event (see https://html.spec.whatwg.org/multipage/server-sent-events.html)
+type Event struct {
+	ID    string
+	Event string        // the event type; clients treat an empty type as "message"
+	Data  string        // may contain newlines
+	Retry time.Duration // tells clients how long to wait before reconnecting; zero means not sent
+}
+
+// Make an event with JSON data
+func JsonEvent(eventType string, object interface{}) (Event, error) {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return Event{}, SvcErrorJsonMarshalFailed.WithError(err)
+	}
+	return Event{Event: eventType, Data: string(raw)}, nil
+}
+
+// Ids and types can't contain newlines, and ids can't contain NUL
+func (e Event) validate() error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return fmt.Errorf("%w: id %q", ErrorInvalidEvent, e.ID)
+	}
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return fmt.Errorf("%w: event type %q", ErrorInvalidEvent, e.Event)
+	}
+	return nil
+}
+
+func (e Event) encode() string {
+	var sb strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&sb, "id: %s\n", e.ID)
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&sb, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&sb, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(e.Data), "\n") {
+		fmt.Fprintf(&sb, "data: %s\n", line)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// Writes server-sent events, flushing after each one.
+//
+// e.g.
+//
+//	stream, err := response.NewWriter(w).WithRequest(r).NewEventStream()
+//	if err != nil {
+//	  return err
+//	}
+//	defer stream.Close()
+//	stream.WithHeartbeat(15 * time.Second)
+//	for progress := range job.Progress(stream.LastEventID()) {
+//	  event, _ := response.JsonEvent("progress", progress)
+//	  event.ID = progress.ID
+//	  if err := stream.Send(event); err != nil {
+//	    return err // the client has gone away
+//	  }
+//	}
+type EventStream struct {
+	writer      Writer
+	ctx         context.Context
+	lastEventId string
+
+	mtx    sync.Mutex // events and heartbeats are written from different goroutines
+	closed bool
+	stop   chan struct{}
+}
+
+// Start an event stream; this sends the status (200) and headers.
+//
+// The stream ends when the request's context is done (see WithRequest), e.g. when the client disconnects.
+func (w Writer) NewEventStream() (*EventStream, error) {
+	if !w.writer.canFlush() {
+		return nil, ErrorStreamingUnsupported
+	}
+
+	stream := &EventStream{writer: w, ctx: context.Background(), stop: make(chan struct{})}
+	if w.request != nil {
+		stream.ctx = w.request.Context()
+		stream.lastEventId = w.request.Header.Get(header.LastEventId)
+	}
+
+	headers := w.writer.Header()
+	headers.Set(header.ContentType, header.MimeTypeEventStream)
+	headers.Set(header.CacheControl, "no-cache")
+	w.writer.WriteHeader(http.StatusOK)
+	w.writer.Flush()
+	return stream, nil
+}
+
+// The id of the last event the client received before reconnecting (the Last-Event-ID header), if any;
+// use this to resume the stream.
+func (s *EventStream) LastEventID() string {
+	return s.lastEventId
+}
+
+// Closed when the client disconnects
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Send a comment every interval so that proxies don't close an idle connection.
+func (s *EventStream) WithHeartbeat(interval time.Duration) *EventStream {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.write(": heartbeat\n\n"); err != nil {
+					return
+				}
+			case <-s.stop:
+				return
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// Send an event; returns the context's error once the client has disconnected.
+func (s *EventStream) Send(event Event) error {
+	if err := event.validate(); err != nil {
+		return err
+	}
+	return s.write(event.encode())
+}
+
+// Send a comment, which clients ignore
+func (s *EventStream) SendComment(comment string) error {
+	var sb strings.Builder
+	for _, line := range strings.Split(comment, "\n") {
+		fmt.Fprintf(&sb, ": %s\n", line)
+	}
+	sb.WriteString("\n")
+	return s.write(sb.String())
+}
+
+func (s *EventStream) write(data string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return ErrorEventStreamClosed
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(s.writer.writer, data); err != nil {
+		return SvcErrorStreamFailed.WithError(err)
+	}
+	s.writer.writer.Flush()
+	return nil
+}
+
+// Stop the heartbeat; nothing more can be sent.
+func (s *EventStream) Close() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+}
+
+// Reads server-sent events from a response body; see client.Subscribe for a reader that reconnects.
+type EventReader struct {
+	scanner     *bufio.Scanner
+	lastEventId string
+	retry       time.Duration
+}
+
+func NewEventReader(reader io.Reader) *EventReader {
+	scanner := bufio.NewScanner(reader)
+	scanner.Split(scanEventLines)
+	return &EventReader{scanner: scanner}
+}
+
+// The id of the last event read; like a browser, this carries over to events that don't have an id.
+func (r *EventReader) LastEventID() string {
+	return r.lastEventId
+}
+
+// The last retry value sent by the server, or zero if it hasn't sent one
+func (r *EventReader) Retry() time.Duration {
+	return r.retry
+}
+
+// Read the next event; returns io.EOF at the end of the stream.
+//
+// Comments and events without data are skipped (though their id and retry values are kept).
+func (r *EventReader) Next() (Event, error) {
+	var event Event
+	var data []string
+	hasData := false
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			if hasData {
+				event.ID = r.lastEventId
+				event.Data = strings.Join(data, "\n")
+				return event, nil
+			}
+			event = Event{}
+			data = nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				r.lastEventId = value
+			}
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+				r.retry = event.Retry
+			}
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	// an incomplete event at the end of the stream is discarded
+	return Event{}, io.EOF
+}
+
+// Splits lines ending in "\r\n", "\n" or "\r"
+func scanEventLines(data []byte, atEOF bool) (int, []byte, error) {
+	for index, c := range data {
+		switch c {
+		case '\n':
+			return index + 1, data[:index], nil
+		case '\r':
+			if index+1 < len(data) {
+				if data[index+1] == '\n' {
+					return index + 2, data[:index], nil
+				}
+				return index + 1, data[:index], nil
+			}
+			if atEOF {
+				return index + 1, data[:index], nil
+			}
+			// need more data to know whether this is "\r\n"
+			return 0, nil, nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,222 @@
+package response
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/mocks"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+)
+
+// a recorder that can be read while a heartbeat goroutine writes to it
+type syncRecorder struct {
+	*httptest.ResponseRecorder
+	ch chan string
+}
+
+func (r *syncRecorder) Write(p []byte) (int, error) {
+	r.ch <- string(p)
+	return len(p), nil
+}
+
+func (r *syncRecorder) WriteString(s string) (int, error) {
+	return r.Write([]byte(s))
+}
+
+var _ = Describe("Server-Sent Events", func() {
+	Context("Event", func() {
+		DescribeTable("encode",
+			func(event Event, expect string) {
+				Expect(event.encode()).To(Equal(expect))
+			},
+			Entry("with data only", Event{Data: "hello"}, "data: hello\n\n"),
+			Entry("with all fields", Event{ID: "7", Event: "update", Data: "hello", Retry: 1500 * time.Millisecond}, "id: 7\nevent: update\nretry: 1500\ndata: hello\n\n"),
+			Entry("with multi-line data", Event{Data: "one\ntwo\r\nthree"}, "data: one\ndata: two\ndata: three\n\n"),
+			Entry("with empty data", Event{Event: "ping"}, "event: ping\ndata: \n\n"),
+		)
+
+		DescribeTable("validate",
+			func(event Event, expectErr bool) {
+				err := event.validate()
+				if expectErr {
+					Expect(err).To(MatchError(ErrorInvalidEvent))
+				} else {
+					Expect(err).ToNot(HaveOccurred())
+				}
+			},
+			Entry("with a valid event", Event{ID: "1", Event: "update", Data: "a\nb"}, false),
+			Entry("with a newline in the id", Event{ID: "1\n2"}, true),
+			Entry("with a NUL in the id", Event{ID: "1\x002"}, true),
+			Entry("with a newline in the type", Event{Event: "up\rdate"}, true),
+		)
+
+		It("should make JSON events", func() {
+			event, err := JsonEvent("update", row{ID: 3, Name: "thing"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(event).To(Equal(Event{Event: "update", Data: `{"id":3,"name":"thing"}`}))
+		})
+
+		It("should fail to make a JSON event from an unmarshalable object", func() {
+			_, err := JsonEvent("update", make(chan int))
+			Expect(err).To(MatchError(SvcErrorJsonMarshalFailed))
+		})
+	})
+
+	Context("EventStream", func() {
+		var recorder *httptest.ResponseRecorder
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+		})
+
+		It("should send the headers and events", func() {
+			// Arrange
+			req := httptest.NewRequest(http.MethodGet, "/events", nil)
+			req.Header.Set(header.LastEventId, "41")
+
+			// Act
+			stream, err := NewWriter(recorder).WithRequest(req).NewEventStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.Send(Event{ID: "42", Data: "hello"})).To(Succeed())
+			Expect(stream.SendComment("still\nhere")).To(Succeed())
+
+			// Assert
+			Expect(stream.LastEventID()).To(Equal("41"))
+			result := recorder.Result()
+			Expect(result.StatusCode).To(Equal(http.StatusOK))
+			Expect(result.Header.Get(header.ContentType)).To(Equal(header.MimeTypeEventStream))
+			Expect(result.Header.Get(header.CacheControl)).To(Equal("no-cache"))
+			Expect(recorder.Flushed).To(BeTrue())
+			Expect(recorder.Body.String()).To(Equal("id: 42\ndata: hello\n\n: still\n: here\n\n"))
+		})
+
+		It("should fail if the writer can't flush", func() {
+			// Arrange
+			ctrl := gomock.NewController(GinkgoT())
+			writer := mocks.NewMockResponseWriter(ctrl)
+
+			// Act
+			_, err := NewWriter(writer).NewEventStream()
+
+			// Assert
+			Expect(err).To(MatchError(ErrorStreamingUnsupported))
+		})
+
+		It("should reject invalid events", func() {
+			stream, err := NewWriter(recorder).NewEventStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.Send(Event{ID: "a\nb"})).To(MatchError(ErrorInvalidEvent))
+			Expect(recorder.Body.String()).To(BeEmpty())
+		})
+
+		It("should not send after Close", func() {
+			stream, err := NewWriter(recorder).NewEventStream()
+			Expect(err).ToNot(HaveOccurred())
+			stream.Close()
+			stream.Close()
+			Expect(stream.Send(Event{Data: "late"})).To(MatchError(ErrorEventStreamClosed))
+		})
+
+		It("should not send after the client disconnects", func() {
+			// Arrange
+			ctx, cancel := context.WithCancel(context.Background())
+			req := httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(ctx)
+			stream, err := NewWriter(recorder).WithRequest(req).NewEventStream()
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			cancel()
+
+			// Assert
+			Eventually(stream.Done()).Should(BeClosed())
+			Expect(stream.Send(Event{Data: "late"})).To(MatchError(context.Canceled))
+		})
+
+		It("should send heartbeats until closed", func() {
+			// Arrange
+			recorder := &syncRecorder{ResponseRecorder: httptest.NewRecorder(), ch: make(chan string, 10)}
+			stream, err := NewWriter(recorder).NewEventStream()
+			Expect(err).ToNot(HaveOccurred())
+
+			// Act
+			stream.WithHeartbeat(5 * time.Millisecond)
+
+			// Assert
+			Eventually(recorder.ch).Should(Receive(Equal(": heartbeat\n\n")))
+			stream.Close()
+			Expect(stream.SendComment("late")).To(MatchError(ErrorEventStreamClosed))
+		})
+	})
+
+	Context("EventReader", func() {
+		readAll := func(reader *EventReader) []Event {
+			var events []Event
+			for {
+				event, err := reader.Next()
+				if errors.Is(err, io.EOF) {
+					return events
+				}
+				Expect(err).ToNot(HaveOccurred())
+				events = append(events, event)
+			}
+		}
+
+		It("should read what EventStream writes", func() {
+			// Arrange
+			recorder := httptest.NewRecorder()
+			stream, err := NewWriter(recorder).NewEventStream()
+			Expect(err).ToNot(HaveOccurred())
+			sent := []Event{
+				{ID: "1", Event: "update", Data: "one\ntwo"},
+				{ID: "2", Data: "three", Retry: time.Second},
+			}
+			for _, event := range sent {
+				Expect(stream.Send(event)).To(Succeed())
+			}
+
+			// Act
+			reader := NewEventReader(recorder.Body)
+			events := readAll(reader)
+
+			// Assert
+			Expect(events).To(Equal(sent))
+			Expect(reader.LastEventID()).To(Equal("2"))
+			Expect(reader.Retry()).To(Equal(time.Second))
+		})
+
+		DescribeTable("parsing",
+			func(stream string, expect []Event, expectLastId string, expectRetry time.Duration) {
+				reader := NewEventReader(strings.NewReader(stream))
+				Expect(readAll(reader)).To(Equal(expect))
+				Expect(reader.LastEventID()).To(Equal(expectLastId))
+				Expect(reader.Retry()).To(Equal(expectRetry))
+			},
+			Entry("with CRLF line endings",
+				"id: 1\r\ndata: a\r\n\r\ndata: b\r\rdata:c\n\n",
+				[]Event{{ID: "1", Data: "a"}, {ID: "1", Data: "b"}, {ID: "1", Data: "c"}}, "1", time.Duration(0)),
+			Entry("with comments and unknown fields",
+				": hello\nfoo: bar\ndata: a\n\n",
+				[]Event{{Data: "a"}}, "", time.Duration(0)),
+			Entry("with events that have no data",
+				"id: 5\nevent: nothing\n\nretry: 250\n\ndata: a\n\n",
+				[]Event{{ID: "5", Data: "a"}}, "5", 250*time.Millisecond),
+			Entry("with an invalid retry",
+				"retry: soon\ndata: a\n\n",
+				[]Event{{Data: "a"}}, "", time.Duration(0)),
+			Entry("with an incomplete event at the end",
+				"data: a\n\ndata: b\n",
+				[]Event{{Data: "a"}}, "", time.Duration(0)),
+			Entry("with an empty id that resets the last id",
+				"id: 1\ndata: a\n\nid\ndata: b\n\n",
+				[]Event{{ID: "1", Data: "a"}, {Data: "b"}}, "", time.Duration(0)),
+		)
+	})
+})
@@ -0,0 +1,219 @@
+package response
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/keithpaterson/resweave-utils/header"
+)
+
+var (
+	ErrorEncoderClosed = errors.New("encoder is closed")
+)
+
+// the size of the chunks written by WriteStream() and buffered by ArrayEncoder
+const streamChunkSize = 32 * 1024
+
+// ArrayEncoder flushes after this many items by default
+const DefaultFlushInterval = 100
+
+// Copy the reader to the response in chunks, flushing after each one so that clients receive data as it is read.
+//
+// Once the first chunk is written the status and headers have been sent, so a read failure after that can't be
+// reported with an error response.  Instead the error is sent as the X-Stream-Error trailer (see header.StreamError)
+// and returned; clients should treat a response with that trailer as incomplete.
+//
+// A read failure before anything is written is reported with an error response as usual.
+func (w Writer) WriteStream(statusCode int, mimeType string, reader io.Reader) error {
+	buf := make([]byte, streamChunkSize)
+	started := false
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if !started {
+				w.startStream(statusCode, mimeType)
+				started = true
+			}
+			if _, werr := w.writer.Write(buf[:n]); werr != nil {
+				return SvcErrorStreamFailed.WithError(werr)
+			}
+			w.flush()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !started {
+				return w.WriteError(SvcErrorStreamFailed.WithError(err))
+			}
+			return w.failStream(err)
+		}
+	}
+
+	if !started {
+		// empty stream
+		w.startStream(statusCode, mimeType)
+	}
+	return nil
+}
+
+// Sends the status and headers, announcing the error trailer
+func (w Writer) startStream(statusCode int, mimeType string) {
+	headers := w.writer.Header()
+	headers.Set(header.ContentType, mimeType)
+	headers.Add(header.Trailer, header.StreamError)
+	w.writer.WriteHeader(statusCode)
+}
+
+func (w Writer) flush() {
+	w.writer.Flush()
+}
+
+// Reports a failure after the headers have been sent; returns the service error that was reported
+func (w Writer) failStream(err error) error {
+	svcErr := MapError(err)
+	if !errors.Is(svcErr, SvcErrorStreamFailed) {
+		svcErr = SvcErrorStreamFailed.WithError(err)
+	}
+	w.writer.Header().Set(header.StreamError, streamErrorText(w.redactError(svcErr)))
+	w.flush()
+	return svcErr
+}
+
+// The error's text, plus its correlation id (if it was redacted) so that the failure can be found in the logs,
+// e.g. "10201: stream response failed (correlationId: abc)"
+func streamErrorText(svcErr ServiceError) string {
+	if se, ok := svcErr.(*SvcError); ok && se.correlationId != "" {
+		return fmt.Sprintf("%s (%s: %s)", se.Error(), correlationIdMember, se.correlationId)
+	}
+	return svcErr.Error()
+}
+
+// Writes a JSON array one item at a time, so that large lists don't need to be held in memory.
+//
+// e.g.
+//
+//	encoder := writer.NewArrayEncoder(http.StatusOK)
+//	for rows.Next() {
+//	  if err := encoder.Encode(row); err != nil {
+//	    return encoder.Fail(err)
+//	  }
+//	}
+//	return encoder.Close()
+//
+// Nothing is sent until the first item is encoded (or the encoder is closed), so a failure before then is written
+// as an error response.  After that the status and headers have been sent, so Fail() leaves the array unterminated,
+// which makes the body invalid JSON, and sends the error as the X-Stream-Error trailer.
+type ArrayEncoder struct {
+	writer        Writer
+	statusCode    int
+	buffer        *bufio.Writer
+	flushInterval int
+	count         int
+	closed        bool
+}
+
+func (w Writer) NewArrayEncoder(statusCode int) *ArrayEncoder {
+	return &ArrayEncoder{writer: w, statusCode: statusCode, flushInterval: DefaultFlushInterval}
+}
+
+// Flush the response after this many items (and whenever the buffer fills up)
+func (e *ArrayEncoder) WithFlushInterval(items int) *ArrayEncoder {
+	e.flushInterval = items
+	return e
+}
+
+// The number of items encoded so far
+func (e *ArrayEncoder) Count() int {
+	return e.count
+}
+
+// Add an item to the array.
+//
+// An item that can't be marshaled isn't written and its error is returned, so the caller can decide whether
+// to skip it or to Fail().
+func (e *ArrayEncoder) Encode(item interface{}) error {
+	if e.closed {
+		return ErrorEncoderClosed
+	}
+	raw, err := json.Marshal(item)
+	if err != nil {
+		return SvcErrorJsonMarshalFailed.WithError(err)
+	}
+
+	separator := ","
+	if e.buffer == nil {
+		e.start()
+		separator = "["
+	}
+	if _, err = e.buffer.WriteString(separator); err == nil {
+		_, err = e.buffer.Write(raw)
+	}
+	if err != nil {
+		e.closed = true
+		return SvcErrorStreamFailed.WithError(err)
+	}
+
+	e.count++
+	if e.flushInterval > 0 && e.count%e.flushInterval == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+// Finish the array; an empty array is written if no items were encoded.
+func (e *ArrayEncoder) Close() error {
+	if e.closed {
+		return ErrorEncoderClosed
+	}
+	e.closed = true
+
+	terminator := "]"
+	if e.buffer == nil {
+		e.start()
+		terminator = "[]"
+	}
+	if _, err := e.buffer.WriteString(terminator); err != nil {
+		return SvcErrorStreamFailed.WithError(err)
+	}
+	return e.flush()
+}
+
+// Report a failure; returns the service error that was reported.
+//
+// If nothing has been sent yet an error response is written, otherwise the buffered items are sent, the array
+// is left unterminated and the error is sent as the X-Stream-Error trailer.
+func (e *ArrayEncoder) Fail(err error) error {
+	if e.closed {
+		return ErrorEncoderClosed
+	}
+	e.closed = true
+
+	if e.buffer == nil {
+		svcErr := MapError(err)
+		if werr := e.writer.WriteErrorResponse(StatusOf(svcErr), svcErr); werr != nil {
+			return werr
+		}
+		return svcErr
+	}
+	// the error is reported in the trailer whether or not the buffered data could be sent
+	_ = e.buffer.Flush()
+	return e.writer.failStream(err)
+}
+
+func (e *ArrayEncoder) start() {
+	e.writer.startStream(e.statusCode, header.MimeTypeJson)
+	e.buffer = bufio.NewWriterSize(e.writer.writer, streamChunkSize)
+}
+
+func (e *ArrayEncoder) flush() error {
+	if err := e.buffer.Flush(); err != nil {
+		e.closed = true
+		return SvcErrorStreamFailed.WithError(err)
+	}
+	e.writer.flush()
+	return nil
+}
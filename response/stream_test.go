@@ -0,0 +1,204 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing/iotest"
+
+	"github.com/keithpaterson/resweave-utils/header"
+	"github.com/keithpaterson/resweave-utils/mocks"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+)
+
+type row struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// fails after the data has been read
+type failingReader struct {
+	data io.Reader
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+var _ = Describe("Streaming Responses", func() {
+	var recorder *httptest.ResponseRecorder
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+	})
+
+	Context("WriteStream", func() {
+		It("should copy the reader and flush", func() {
+			// Arrange
+			data := strings.Repeat("0123456789", 10000)
+
+			// Act
+			err := NewWriter(recorder).WriteStream(http.StatusOK, "text/csv", strings.NewReader(data))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			result := recorder.Result()
+			Expect(result.StatusCode).To(Equal(http.StatusOK))
+			Expect(result.Header.Get(header.ContentType)).To(Equal("text/csv"))
+			Expect(recorder.Flushed).To(BeTrue())
+			Expect(recorder.Body.String()).To(Equal(data))
+			Expect(result.Trailer.Get(header.StreamError)).To(BeEmpty())
+		})
+		It("should send the headers for an empty stream", func() {
+			err := NewWriter(recorder).WriteStream(http.StatusNoContent, "text/csv", strings.NewReader(""))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(recorder.Code).To(Equal(http.StatusNoContent))
+			Expect(recorder.Header().Get(header.ContentType)).To(Equal("text/csv"))
+		})
+		It("should write an error response when the first read fails", func() {
+			// Act
+			err := NewWriter(recorder).WriteStream(http.StatusOK, "text/csv", iotest.ErrReader(errors.New("disk failure")))
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"code":10201,"description":"stream response failed","wrapped":"disk failure"}`))
+		})
+		It("should report a failure after the stream starts in the trailer", func() {
+			// Arrange
+			reader := &failingReader{data: strings.NewReader("a,b,c\n"), err: errors.New("disk failure")}
+
+			// Act
+			err := NewWriter(recorder).WriteStream(http.StatusOK, "text/csv", reader)
+
+			// Assert
+			Expect(err).To(MatchError(SvcErrorStreamFailed))
+			result := recorder.Result()
+			Expect(result.StatusCode).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal("a,b,c\n"))
+			Expect(result.Trailer.Get(header.StreamError)).To(Equal("10201: stream response failed: disk failure"))
+		})
+		It("should return write failures", func() {
+			// Arrange
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			mockWriter := mocks.NewMockResponseWriter(ctrl)
+			mockWriter.EXPECT().Header().AnyTimes().Return(http.Header{})
+			mockWriter.EXPECT().WriteHeader(http.StatusOK).Times(1)
+			mockWriter.EXPECT().Write(gomock.Any()).Times(1).Return(0, errors.New("connection reset"))
+
+			// Act
+			err := NewWriter(mockWriter).WriteStream(http.StatusOK, "text/csv", strings.NewReader("a,b,c"))
+
+			// Assert
+			Expect(err).To(MatchError(SvcErrorStreamFailed))
+			Expect(err).To(MatchError(ContainSubstring("connection reset")))
+		})
+	})
+
+	Context("ArrayEncoder", func() {
+		It("should write items as a json array", func() {
+			// Arrange
+			encoder := NewWriter(recorder).NewArrayEncoder(http.StatusOK).WithFlushInterval(2)
+
+			// Act
+			for index := 1; index <= 5; index++ {
+				Expect(encoder.Encode(row{ID: index, Name: "row"})).To(Succeed())
+			}
+			err := encoder.Close()
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encoder.Count()).To(Equal(5))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get(header.ContentType)).To(Equal(header.MimeTypeJson))
+			var rows []row
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &rows)).To(Succeed())
+			Expect(rows).To(HaveLen(5))
+			Expect(rows[4]).To(Equal(row{ID: 5, Name: "row"}))
+		})
+		It("should write an empty array", func() {
+			encoder := NewWriter(recorder).NewArrayEncoder(http.StatusOK)
+			Expect(encoder.Close()).To(Succeed())
+			Expect(recorder.Body.String()).To(Equal("[]"))
+			Expect(encoder.Encode(row{})).To(MatchError(ErrorEncoderClosed))
+			Expect(encoder.Close()).To(MatchError(ErrorEncoderClosed))
+		})
+		It("should not write items that cannot be marshaled", func() {
+			// Arrange
+			encoder := NewWriter(recorder).NewArrayEncoder(http.StatusOK)
+
+			// Act
+			Expect(encoder.Encode(row{ID: 1})).To(Succeed())
+			err := encoder.Encode(floatStruct{F: math.Inf(1)})
+			Expect(encoder.Close()).To(Succeed())
+
+			// Assert
+			Expect(err).To(MatchError(SvcErrorJsonMarshalFailed))
+			Expect(recorder.Body.String()).To(Equal(`[{"id":1,"name":""}]`))
+		})
+		It("should write an error response when failing before the first item", func() {
+			// Arrange
+			encoder := NewWriter(recorder).NewArrayEncoder(http.StatusOK)
+
+			// Act
+			err := encoder.Fail(SvcErrorInvalidResourceId)
+
+			// Assert
+			Expect(err).To(MatchError(SvcErrorInvalidResourceId))
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"code":10500,"description":"invalid resource id","wrapped":""}`))
+		})
+		It("should leave the array unterminated and send the trailer when failing mid-stream", func() {
+			// Arrange
+			encoder := NewWriter(recorder).WithRedaction(RedactionPolicy{Exposure: ExposeCorrelationId, NewCorrelationId: func() string { return "abc" }}).
+				NewArrayEncoder(http.StatusOK)
+			Expect(encoder.Encode(row{ID: 1})).To(Succeed())
+
+			// Act
+			err := encoder.Fail(errors.New("database gone"))
+
+			// Assert
+			Expect(err).To(MatchError(SvcErrorStreamFailed))
+			result := recorder.Result()
+			Expect(result.StatusCode).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal(`[{"id":1,"name":""}`))
+			Expect(json.Valid(recorder.Body.Bytes())).To(BeFalse())
+			Expect(result.Trailer.Get(header.StreamError)).To(Equal("10201: stream response failed (correlationId: abc)"))
+			Expect(encoder.Close()).To(MatchError(ErrorEncoderClosed))
+		})
+		It("should stream to a real client", func() {
+			// Arrange
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				encoder := NewWriter(w).NewArrayEncoder(http.StatusOK).WithFlushInterval(1)
+				for index := 0; index < 3; index++ {
+					_ = encoder.Encode(row{ID: index})
+				}
+				_ = encoder.Fail(errors.New("database gone"))
+			}))
+			defer server.Close()
+
+			// Act
+			resp, err := http.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+
+			// Assert
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal(`[{"id":0,"name":""},{"id":1,"name":""},{"id":2,"name":""}`))
+			Expect(resp.Trailer.Get(header.StreamError)).To(Equal("10201: stream response failed: database gone"))
+		})
+	})
+})
@@ -0,0 +1,183 @@
+package rw
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/keithpaterson/resweave-utils/header"
+)
+
+var (
+	ErrorUnsupportedMimeType = errors.New("unsupported mime type")
+	ErrorMarshalFailed       = errors.New("failed to marshal data")
+	ErrorUnmarshalFailed     = errors.New("failed to unmarshal data")
+)
+
+// Encodes and decodes objects for a specific MIME type
+type Codec interface {
+	MimeType() string
+	Marshal(object interface{}) ([]byte, error)
+	Unmarshal(data []byte, object interface{}) error
+}
+
+type MarshalFunc func(object interface{}) ([]byte, error)
+type UnmarshalFunc func(data []byte, object interface{}) error
+
+// Make a codec from a pair of marshal/unmarshal functions
+func NewCodec(mimeType string, marshal MarshalFunc, unmarshal UnmarshalFunc) Codec {
+	return &funcCodec{mimeType: mimeType, marshal: marshal, unmarshal: unmarshal}
+}
+
+// Hook for protobuf support, so that this package doesn't have to depend on a protobuf implementation.
+//
+// e.g.
+//
+//	rw.RegisterCodec(rw.NewProtobufCodec(
+//	  func(object interface{}) ([]byte, error) { return proto.Marshal(object.(proto.Message)) },
+//	  func(data []byte, object interface{}) error { return proto.Unmarshal(data, object.(proto.Message)) },
+//	))
+func NewProtobufCodec(marshal MarshalFunc, unmarshal UnmarshalFunc) Codec {
+	return NewCodec(header.MimeTypeProtobuf, marshal, unmarshal)
+}
+
+type funcCodec struct {
+	mimeType  string
+	marshal   MarshalFunc
+	unmarshal UnmarshalFunc
+}
+
+func (c *funcCodec) MimeType() string {
+	return c.mimeType
+}
+
+func (c *funcCodec) Marshal(object interface{}) ([]byte, error) {
+	return c.marshal(object)
+}
+
+func (c *funcCodec) Unmarshal(data []byte, object interface{}) error {
+	return c.unmarshal(data, object)
+}
+
+// built-in codecs
+var (
+	JsonCodec = NewCodec(header.MimeTypeJson, json.Marshal, json.Unmarshal)
+	XmlCodec  = NewCodec(header.MimeTypeXml, xml.Marshal, xml.Unmarshal)
+	CborCodec = NewCodec(header.MimeTypeCbor, cbor.Marshal, cbor.Unmarshal)
+)
+
+type codecRegistry struct {
+	mtx    sync.RWMutex
+	codecs map[string]Codec
+}
+
+var codecs = &codecRegistry{
+	codecs: map[string]Codec{
+		header.MimeTypeJson: JsonCodec,
+		header.MimeTypeXml:  XmlCodec,
+		"text/xml":          XmlCodec,
+		header.MimeTypeCbor: CborCodec,
+	},
+}
+
+// Register a codec for its MIME type, replacing any codec previously registered for that type.
+func RegisterCodec(codec Codec) {
+	RegisterCodecAs(codec.MimeType(), codec)
+}
+
+// Register a codec for an additional MIME type, e.g. "text/xml" as well as "application/xml"
+func RegisterCodecAs(mimeType string, codec Codec) {
+	codecs.mtx.Lock()
+	defer codecs.mtx.Unlock()
+	codecs.codecs[strings.ToLower(mimeType)] = codec
+}
+
+// The MIME types that have a registered codec; the default codec's type is first, the rest are sorted.
+func MimeTypes() []string {
+	codecs.mtx.RLock()
+	defer codecs.mtx.RUnlock()
+
+	defaultType := DefaultCodec().MimeType()
+	mimeTypes := make([]string, 0, len(codecs.codecs))
+	for mimeType := range codecs.codecs {
+		if mimeType != defaultType {
+			mimeTypes = append(mimeTypes, mimeType)
+		}
+	}
+	sort.Strings(mimeTypes)
+	return append([]string{defaultType}, mimeTypes...)
+}
+
+// The codec used when no MIME type is specified (JSON)
+func DefaultCodec() Codec {
+	return JsonCodec
+}
+
+// Find the codec for a MIME type.
+//
+// MIME type parameters (e.g. "; charset=utf-8") are ignored, an empty MIME type returns the default codec,
+// and structured syntax suffixes fall back to the codec for the suffix (e.g. "application/problem+json" uses
+// the JSON codec) unless a codec has been registered for the full type.
+func LookupCodec(mimeType string) (Codec, bool) {
+	if mimeType == "" {
+		return DefaultCodec(), true
+	}
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return nil, false
+	}
+
+	codecs.mtx.RLock()
+	defer codecs.mtx.RUnlock()
+	if codec, found := codecs.codecs[mediaType]; found {
+		return codec, true
+	}
+	if index := strings.LastIndex(mediaType, "+"); index >= 0 {
+		codec, found := codecs.codecs["application/"+mediaType[index+1:]]
+		return codec, found
+	}
+	return nil, false
+}
+
+// Marshal an object using the codec for the MIME type
+func Marshal(object interface{}, mimeType string) ([]byte, error) {
+	codec, found := LookupCodec(mimeType)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrorUnsupportedMimeType, mimeType)
+	}
+	data, err := codec.Marshal(object)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrorMarshalFailed, err)
+	}
+	return data, nil
+}
+
+// Read all of the data from a reader and unmarshal it using the codec for the MIME type
+func Unmarshal(reader io.Reader, mimeType string, object interface{}) error {
+	codec, found := LookupCodec(mimeType)
+	if !found {
+		return fmt.Errorf("%w: %s", ErrorUnsupportedMimeType, mimeType)
+	}
+
+	data, err := ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return ErrorNoData
+	}
+
+	if err = codec.Unmarshal(data, object); err != nil {
+		return fmt.Errorf("%w: %w", ErrorUnmarshalFailed, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package rw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/keithpaterson/resweave-utils/header"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type testCodecData struct {
+	Name  string `json:"name" xml:"name" cbor:"name"`
+	Count int    `json:"count" xml:"count" cbor:"count"`
+}
+
+var _ = Describe("Codecs", func() {
+	Context("LookupCodec", func() {
+		DescribeTable("Validation",
+			func(mimeType string, expectCodec Codec) {
+				// Act
+				codec, found := LookupCodec(mimeType)
+
+				// Assert
+				if expectCodec == nil {
+					Expect(found).To(BeFalse())
+					Expect(codec).To(BeNil())
+				} else {
+					Expect(found).To(BeTrue())
+					Expect(codec).To(BeIdenticalTo(expectCodec))
+				}
+			},
+			Entry("with no mime type returns default", "", JsonCodec),
+			Entry("with json returns json", header.MimeTypeJson, JsonCodec),
+			Entry("with parameters ignores them", "application/json; charset=utf-8", JsonCodec),
+			Entry("with mixed case ignores case", "Application/JSON", JsonCodec),
+			Entry("with structured suffix returns suffix codec", "application/problem+json", JsonCodec),
+			Entry("with xml returns xml", header.MimeTypeXml, XmlCodec),
+			Entry("with text/xml returns xml", "text/xml", XmlCodec),
+			Entry("with cbor returns cbor", header.MimeTypeCbor, CborCodec),
+			Entry("with unknown type returns nothing", "text/csv", nil),
+			Entry("with unknown suffix returns nothing", "application/vnd.foo+yaml", nil),
+			Entry("with invalid type returns nothing", "not a / mime type", nil),
+		)
+	})
+
+	Context("MimeTypes", func() {
+		It("should list the default type first", func() {
+			mimeTypes := MimeTypes()
+			Expect(mimeTypes[0]).To(Equal(header.MimeTypeJson))
+			Expect(mimeTypes).To(ContainElements(header.MimeTypeXml, "text/xml", header.MimeTypeCbor))
+		})
+	})
+
+	Context("Marshal and Unmarshal", func() {
+		DescribeTable("should round-trip data",
+			func(mimeType string) {
+				// Arrange
+				expect := testCodecData{Name: "foo", Count: 10}
+
+				// Act
+				data, err := Marshal(expect, mimeType)
+				Expect(err).ToNot(HaveOccurred())
+
+				var actual testCodecData
+				err = Unmarshal(bytes.NewReader(data), mimeType, &actual)
+
+				// Assert
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actual).To(Equal(expect))
+			},
+			Entry(nil, header.MimeTypeJson),
+			Entry(nil, header.MimeTypeXml),
+			Entry(nil, header.MimeTypeCbor),
+		)
+		It("Marshal should return an error for unsupported mime types", func() {
+			data, err := Marshal(testCodecData{}, "text/csv")
+			Expect(data).To(BeNil())
+			Expect(err).To(MatchError(ErrorUnsupportedMimeType))
+		})
+		It("Marshal should return an error when the codec fails", func() {
+			data, err := Marshal(func() {}, header.MimeTypeJson)
+			Expect(data).To(BeNil())
+			Expect(err).To(MatchError(ErrorMarshalFailed))
+		})
+		DescribeTable("Unmarshal errors",
+			func(reader io.Reader, mimeType string, expectErr error) {
+				var actual testCodecData
+				err := Unmarshal(reader, mimeType, &actual)
+				Expect(err).To(MatchError(expectErr))
+			},
+			Entry("with unsupported mime type", bytes.NewReader([]byte("a,b")), "text/csv", ErrorUnsupportedMimeType),
+			Entry("with nil reader", nil, header.MimeTypeJson, ErrorNilReader),
+			Entry("with no data", bytes.NewReader(nil), header.MimeTypeCbor, ErrorNoData),
+			Entry("with invalid data", bytes.NewReader([]byte("not xml")), header.MimeTypeXml, ErrorUnmarshalFailed),
+		)
+	})
+
+	Context("Custom codecs", func() {
+		It("should use a registered protobuf codec", func() {
+			// Arrange
+			// not really protobuf, but it's enough to see that the hook is used
+			marshalled := false
+			codec := NewProtobufCodec(
+				func(object interface{}) ([]byte, error) {
+					marshalled = true
+					return json.Marshal(object)
+				},
+				func(data []byte, object interface{}) error {
+					return errors.New("irreconcilable differences")
+				})
+			RegisterCodec(codec)
+
+			// Act
+			data, err := Marshal(testCodecData{Name: "foo"}, header.MimeTypeProtobuf)
+			Expect(err).ToNot(HaveOccurred())
+			err = Unmarshal(bytes.NewReader(data), header.MimeTypeProtobuf, &testCodecData{})
+
+			// Assert
+			Expect(codec.MimeType()).To(Equal(header.MimeTypeProtobuf))
+			Expect(marshalled).To(BeTrue())
+			Expect(err).To(MatchError(ErrorUnmarshalFailed))
+			Expect(err).To(MatchError(ContainSubstring("irreconcilable differences")))
+		})
+		It("should prefer a codec registered for a full structured type", func() {
+			// Arrange
+			codec := NewCodec("application/vnd.test+json", json.Marshal, json.Unmarshal)
+			RegisterCodec(codec)
+
+			// Act
+			actual, found := LookupCodec("application/vnd.test+json")
+
+			// Assert
+			Expect(found).To(BeTrue())
+			Expect(actual).To(BeIdenticalTo(codec))
+		})
+	})
+})